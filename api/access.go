@@ -0,0 +1,291 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/docker/swarm/ca"
+	"github.com/docker/swarm/cluster"
+	gcontext "github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/samalba/dockerclient"
+)
+
+// Roles of the API clients, each one allowed what the previous ones are.
+const (
+	// Read the state of the cluster.
+	RoleReadOnly = "read-only"
+	// Create and manage containers, images, volumes and networks.
+	RoleDeploy = "deploy"
+	// Manage the nodes, and act on behalf of the other identities.
+	RoleAdmin = "admin"
+)
+
+var roleLevels = map[string]int{
+	RoleReadOnly: 1,
+	RoleDeploy:   2,
+	RoleAdmin:    3,
+}
+
+// Environment variable holding the namespace of a container, as with the
+// other swarm settings of the containers.
+const namespaceEnv = "com.docker.swarm.namespace="
+
+// Header an admin, like a replica forwarding a request, sets to act on behalf
+// of another identity.
+const identityHeader = "X-Swarm-Identity"
+
+// Routes only the admins may call.
+var adminRoutes = map[string]bool{
+	"/nodes/{name:.*}/drain":    true,
+	"/nodes/{name:.*}/activate": true,
+	"/admin/reload":             true,
+}
+
+// An Identity is an API client, authenticated by a bearer token or by the
+// common name of its client certificate. If Namespace is set, it only sees
+// and acts on the containers of its namespace, and the containers it creates
+// join it.
+type Identity struct {
+	Name        string
+	Token       string `json:",omitempty"`
+	Certificate string `json:",omitempty"`
+	Role        string
+	Namespace   string `json:",omitempty"`
+}
+
+// AccessControl authenticates the API clients, and checks they are allowed
+// to make their requests.
+type AccessControl struct {
+	byName        map[string]*Identity
+	byToken       map[string]*Identity
+	byCertificate map[string]*Identity
+}
+
+// NewAccessControl returns an access control letting in the `identities`.
+func NewAccessControl(identities []*Identity) (*AccessControl, error) {
+	a := &AccessControl{
+		byName:        make(map[string]*Identity),
+		byToken:       make(map[string]*Identity),
+		byCertificate: make(map[string]*Identity),
+	}
+	for _, id := range identities {
+		if id.Name == "" {
+			return nil, fmt.Errorf("an identity has no name")
+		}
+		if _, ok := roleLevels[id.Role]; !ok {
+			return nil, fmt.Errorf("invalid role %q for %s, must be one of %s, %s or %s", id.Role, id.Name, RoleReadOnly, RoleDeploy, RoleAdmin)
+		}
+		if id.Token == "" && id.Certificate == "" {
+			return nil, fmt.Errorf("no token nor certificate for %s", id.Name)
+		}
+		if _, exists := a.byName[id.Name]; exists {
+			return nil, fmt.Errorf("several identities are named %s", id.Name)
+		}
+		a.byName[id.Name] = id
+		if id.Token != "" {
+			if _, exists := a.byToken[id.Token]; exists {
+				return nil, fmt.Errorf("the token of %s is already used", id.Name)
+			}
+			a.byToken[id.Token] = id
+		}
+		if id.Certificate != "" {
+			a.byCertificate[id.Certificate] = id
+		}
+	}
+	return a, nil
+}
+
+// LoadAccessControl reads the identities from the JSON file at `path`, of the
+// form {"Identities": [{"Name": ..., "Token": ..., "Role": ...}, ...]}.
+func LoadAccessControl(path string) (*AccessControl, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := struct {
+		Identities []*Identity
+	}{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid access control file %s: %v", path, err)
+	}
+	return NewAccessControl(config.Identities)
+}
+
+// authenticate returns the identity of the client, nil if unknown.
+func (a *AccessControl) authenticate(r *http.Request) *Identity {
+	var id *Identity
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		id = a.byToken[strings.TrimPrefix(auth, "Bearer ")]
+	} else if hasVerifiedCert(r) {
+		// The common names of the certificates the built-in CA issues to the
+		// nodes are their addresses, they don't identify anyone.
+		if cert := r.TLS.PeerCertificates[0]; !ca.IssuedToNode(cert) {
+			id = a.byCertificate[cert.Subject.CommonName]
+		}
+	}
+
+	if id != nil && id.Role == RoleAdmin {
+		if name := r.Header.Get(identityHeader); name != "" {
+			return a.byName[name]
+		}
+	}
+	return id
+}
+
+// allowed returns true if the role of `id` lets it call `route`.
+func (id *Identity) allowed(method, route string) bool {
+	switch {
+	case adminRoutes[route]:
+		return id.Role == RoleAdmin
+	case method == "GET" || method == "HEAD" || method == "OPTIONS":
+		return true
+	default:
+		return roleLevels[id.Role] >= roleLevels[RoleDeploy]
+	}
+}
+
+// owns returns true if `container` is in the namespace of `id`.
+func (id *Identity) owns(container *cluster.Container) bool {
+	if id.Namespace == "" {
+		return true
+	}
+	return container.Info.Config != nil && namespaceOf(container.Info.Config.Env) == id.Namespace
+}
+
+// ownedEvents returns a filter letting through the events of the containers
+// `id` owns. The containers destroyed are no longer known to their node when
+// their last events come, so the filter remembers the ones it has seen.
+func (c *context) ownedEvents(id *Identity) func(*cluster.Event) bool {
+	owned := make(map[string]bool)
+	for _, container := range c.cluster.Containers() {
+		if id.owns(container) {
+			owned[container.Id] = true
+		}
+	}
+	return func(e *cluster.Event) bool {
+		if container := e.Node.Container(e.Id); container != nil {
+			if !id.owns(container) {
+				return false
+			}
+			owned[container.Id] = true
+		}
+		allowed := owned[e.Id]
+		if e.Status == "destroy" {
+			delete(owned, e.Id)
+		}
+		return allowed
+	}
+}
+
+func namespaceOf(env []string) string {
+	for _, e := range env {
+		if strings.HasPrefix(e, namespaceEnv) {
+			return strings.TrimPrefix(e, namespaceEnv)
+		}
+	}
+	return ""
+}
+
+// claim puts the container of the environment `env` in the namespace of
+// `id`, failing if it asks for another one.
+func (id *Identity) claim(env []string) ([]string, error) {
+	if id == nil || id.Namespace == "" {
+		return env, nil
+	}
+	switch ns := namespaceOf(env); ns {
+	case id.Namespace:
+		return env, nil
+	case "":
+		return append(env, namespaceEnv+id.Namespace), nil
+	default:
+		return nil, fmt.Errorf("%s can't create containers in the namespace %s", id.Name, ns)
+	}
+}
+
+// checkReferences fails if the container of `config` refers to a container
+// of another namespace than the one of `id`, through a link, its volumes, its
+// network or an affinity.
+func (c *context) checkReferences(id *Identity, config *dockerclient.ContainerConfig) error {
+	if id == nil || id.Namespace == "" {
+		return nil
+	}
+	for _, env := range config.Env {
+		// The patterns could match the containers of any namespace.
+		if value := affinityValue(env); strings.Contains(value, "*") || strings.HasPrefix(value, "/") {
+			return fmt.Errorf("%s can't use patterns in the container affinities", id.Name)
+		}
+	}
+	for _, name := range cluster.Dependencies(config) {
+		if container := c.cluster.Container(name); container != nil && !id.owns(container) {
+			return fmt.Errorf("%s isn't allowed to refer to the container %s of another namespace", id.Name, name)
+		}
+	}
+	return nil
+}
+
+// affinityValue returns the containers the container affinity `env` names,
+// empty if it isn't one.
+func affinityValue(env string) string {
+	if !strings.HasPrefix(env, "affinity:container") {
+		return ""
+	}
+	value := strings.TrimPrefix(env, "affinity:container")
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "=="), "!=")
+	return strings.TrimPrefix(value, "~")
+}
+
+type identityKey int
+
+// identityOf returns the identity of the client making `r`, nil if access
+// control is disabled.
+func identityOf(r *http.Request) *Identity {
+	if id, ok := gcontext.Get(r, identityKey(0)).(*Identity); ok {
+		return id
+	}
+	return nil
+}
+
+// forwardIdentity names the client in `r`, about to be forwarded to the
+// primary with the certificate of this manager, so that the primary acts on
+// behalf of the client rather than of the manager.
+func forwardIdentity(r *http.Request) {
+	if id := identityOf(r); id != nil {
+		r.Header.Set(identityHeader, id.Name)
+	} else {
+		r.Header.Del(identityHeader)
+	}
+}
+
+// authorize checks the client may call `route`, and act on the container it
+// targets, if any. It writes the error and returns false if not.
+func (c *context) authorize(method, route string, w http.ResponseWriter, r *http.Request) bool {
+	if c.access == nil || publicRoutes[route] {
+		return true
+	}
+
+	id := c.access.authenticate(r)
+	if id == nil {
+		httpError(w, "A valid token or client certificate is required", http.StatusUnauthorized)
+		return false
+	}
+	if !id.allowed(method, route) {
+		httpError(w, fmt.Sprintf("%s isn't allowed to %s %s", id.Name, method, route), http.StatusForbidden)
+		return false
+	}
+	if id.Namespace != "" && (strings.HasPrefix(route, "/containers/{name") || strings.HasPrefix(route, "/exec/{execid")) {
+		// Unknown containers are left to the handlers.
+		if container, err := getContainerFromVars(c, mux.Vars(r)); err == nil && !id.owns(container) {
+			httpError(w, fmt.Sprintf("%s isn't allowed to access the containers of another namespace", id.Name), http.StatusForbidden)
+			return false
+		}
+	}
+
+	gcontext.Set(r, identityKey(0), id)
+	// The header only reaches the primary, set by forwardIdentity.
+	r.Header.Del(identityHeader)
+	return true
+}
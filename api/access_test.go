@@ -0,0 +1,229 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/docker/swarm/ca"
+	"github.com/docker/swarm/cluster"
+	"github.com/samalba/dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// Cluster running a container in each of the namespaces team-a and team-b.
+type namespacedCluster struct {
+	fakeCluster
+	created *dockerclient.ContainerConfig
+}
+
+func (c *namespacedCluster) Containers() []*cluster.Container {
+	containers := []*cluster.Container{}
+	for _, ns := range []string{"team-a", "team-b"} {
+		containers = append(containers, &cluster.Container{
+			Container: dockerclient.Container{Id: ns + "_id", Names: []string{"/" + ns}, Status: "Up 1 second"},
+			Info:      dockerclient.ContainerInfo{Config: &dockerclient.ContainerConfig{Env: []string{namespaceEnv + ns}}},
+			Node:      &FakeNode{},
+		})
+	}
+	return containers
+}
+
+func (c *namespacedCluster) Container(IdOrName string) *cluster.Container {
+	for _, container := range c.Containers() {
+		if container.Id == IdOrName || container.Names[0] == "/"+IdOrName {
+			return container
+		}
+	}
+	return nil
+}
+
+func (c *namespacedCluster) CreateContainer(config *dockerclient.ContainerConfig, name string) (*cluster.Container, error) {
+	c.created = config
+	return &cluster.Container{Container: dockerclient.Container{Id: "created"}}, nil
+}
+
+// Node running the containers of a namespacedCluster.
+type namespacedNode struct {
+	FakeNode
+	cluster *namespacedCluster
+}
+
+func (n *namespacedNode) Container(IdOrName string) *cluster.Container {
+	return n.cluster.Container(IdOrName)
+}
+
+func newAccessRequest(t *testing.T, c cluster.Cluster, access *AccessControl, method, url, token, body string) *httptest.ResponseRecorder {
+	return newContextRequest(t, &context{cluster: c, access: access}, method, url, token, body)
+}
+
+func newContextRequest(t *testing.T, c *context, method, url, token, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	r := httptest.NewRecorder()
+	createRouter(c, false).ServeHTTP(r, req)
+	return r
+}
+
+func TestNewAccessControl(t *testing.T) {
+	for _, identities := range [][]*Identity{
+		{{Token: "t", Role: RoleAdmin}},
+		{{Name: "ci", Token: "t", Role: "root"}},
+		{{Name: "ci", Role: RoleDeploy}},
+		{{Name: "ci", Token: "t", Role: RoleDeploy}, {Name: "ci", Token: "u", Role: RoleDeploy}},
+		{{Name: "ci", Token: "t", Role: RoleDeploy}, {Name: "ops", Token: "t", Role: RoleAdmin}},
+	} {
+		_, err := NewAccessControl(identities)
+		assert.Error(t, err)
+	}
+}
+
+func TestAccessControl(t *testing.T) {
+	access, err := NewAccessControl([]*Identity{
+		{Name: "viewer", Token: "viewer-token", Role: RoleReadOnly},
+		{Name: "team-a", Token: "team-a-token", Role: RoleDeploy, Namespace: "team-a"},
+		{Name: "manager", Certificate: "manager.swarm", Role: RoleAdmin},
+	})
+	assert.NoError(t, err)
+	c := &namespacedCluster{}
+
+	assert.Equal(t, newAccessRequest(t, c, access, "GET", "/_ping", "", "").Code, http.StatusOK)
+	assert.Equal(t, newAccessRequest(t, c, access, "GET", "/info", "", "").Code, http.StatusUnauthorized)
+	assert.Equal(t, newAccessRequest(t, c, access, "GET", "/info", "unknown", "").Code, http.StatusUnauthorized)
+
+	// Read-only identities can't change anything.
+	r := newAccessRequest(t, c, access, "GET", "/containers/json", "viewer-token", "")
+	assert.Equal(t, r.Code, http.StatusOK)
+	assert.Contains(t, r.Body.String(), "team-b_id")
+	assert.Equal(t, newAccessRequest(t, c, access, "POST", "/containers/create", "viewer-token", `{"Image":"busybox"}`).Code, http.StatusForbidden)
+
+	// Namespaced identities only see their containers.
+	r = newAccessRequest(t, c, access, "GET", "/containers/json", "team-a-token", "")
+	assert.Equal(t, r.Code, http.StatusOK)
+	containers := []dockerclient.Container{}
+	assert.NoError(t, json.NewDecoder(r.Body).Decode(&containers))
+	assert.Len(t, containers, 1)
+	assert.Equal(t, containers[0].Id, "team-a_id")
+	assert.Equal(t, newAccessRequest(t, c, access, "DELETE", "/containers/team-b", "team-a-token", "").Code, http.StatusForbidden)
+	assert.Equal(t, newAccessRequest(t, c, access, "GET", "/containers/team-b/json", "team-a-token", "").Code, http.StatusForbidden)
+
+	// And create them in their namespace.
+	assert.Equal(t, newAccessRequest(t, c, access, "POST", "/containers/create", "team-a-token", `{"Image":"busybox"}`).Code, http.StatusCreated)
+	assert.Equal(t, c.created.Env, []string{namespaceEnv + "team-a"})
+	r = newAccessRequest(t, c, access, "POST", "/containers/create", "team-a-token", `{"Image":"busybox","Env":["com.docker.swarm.namespace=team-b"]}`)
+	assert.Equal(t, r.Code, http.StatusForbidden)
+
+	// The names taken in other namespaces don't tell by whom.
+	r = newAccessRequest(t, c, access, "POST", "/containers/create?name=team-b", "team-a-token", `{"Image":"busybox"}`)
+	assert.Equal(t, r.Code, http.StatusConflict)
+	assert.NotContains(t, r.Body.String(), "team-b_id")
+	r = newAccessRequest(t, c, access, "POST", "/containers/create?name=team-a", "team-a-token", `{"Image":"busybox"}`)
+	assert.Equal(t, r.Code, http.StatusConflict)
+	assert.Contains(t, r.Body.String(), "team-a_id")
+
+	// Without referring to the containers of the other namespaces.
+	for _, body := range []string{
+		`{"Image":"busybox","HostConfig":{"Links":["/team-b:db"]}}`,
+		`{"Image":"busybox","HostConfig":{"VolumesFrom":["team-b_id:ro"]}}`,
+		`{"Image":"busybox","HostConfig":{"NetworkMode":"container:team-b"}}`,
+		`{"Image":"busybox","Env":["affinity:container==~team-b"]}`,
+		`{"Image":"busybox","Env":["affinity:container==team-*"]}`,
+	} {
+		assert.Equal(t, newAccessRequest(t, c, access, "POST", "/containers/create", "team-a-token", body).Code, http.StatusForbidden, body)
+	}
+	assert.Equal(t, newAccessRequest(t, c, access, "POST", "/containers/create", "team-a-token", `{"Image":"busybox","HostConfig":{"Links":["team-a:db","unknown:other"]}}`).Code, http.StatusCreated)
+	// Including when starting their containers.
+	assert.Equal(t, newAccessRequest(t, c, access, "POST", "/containers/team-a/start", "team-a-token", `{"Links":["/team-b:db"]}`).Code, http.StatusForbidden)
+
+	// Only the admins may manage the nodes.
+	assert.Equal(t, newAccessRequest(t, c, access, "PUT", "/nodes/node_id/drain", "team-a-token", "").Code, http.StatusForbidden)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "manager.swarm"}}
+	req, err := http.NewRequest("PUT", "/nodes/node_id/drain", nil)
+	assert.NoError(t, err)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	r = httptest.NewRecorder()
+	createRouter(&context{cluster: c, access: access}, false).ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusNoContent)
+
+	// Unless acting on behalf of another identity.
+	req.Header.Set(identityHeader, "team-a")
+	r = httptest.NewRecorder()
+	createRouter(&context{cluster: c, access: access}, false).ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusForbidden)
+
+	// The common names of the certificates of the nodes don't identify them.
+	cert.Subject.OrganizationalUnit = []string{ca.NodeUnit}
+	req.Header.Del(identityHeader)
+	r = httptest.NewRecorder()
+	createRouter(&context{cluster: c, access: access}, false).ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusUnauthorized)
+}
+
+func TestOwnedEvents(t *testing.T) {
+	c := &namespacedCluster{}
+	allow := (&context{cluster: c}).ownedEvents(&Identity{Name: "team-a", Namespace: "team-a"})
+	event := func(node cluster.Node, id, status string) *cluster.Event {
+		e := &cluster.Event{Node: node}
+		e.Id = id
+		e.Status = status
+		return e
+	}
+	node := &namespacedNode{cluster: c}
+
+	assert.True(t, allow(event(node, "team-a_id", "start")))
+	assert.False(t, allow(event(node, "team-b_id", "start")))
+	assert.False(t, allow(event(node, "busybox", "pull")))
+	assert.False(t, allow(event(node, "node_id", "node_disconnect")))
+
+	// The containers destroyed are gone from their node.
+	assert.True(t, allow(event(&FakeNode{}, "team-a_id", "destroy")))
+	assert.False(t, allow(event(&FakeNode{}, "team-a_id", "destroy")))
+}
+
+func TestReplicaForwardsIdentity(t *testing.T) {
+	forwarded := ""
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(identityHeader)
+	}))
+	defer primary.Close()
+	u, err := url.Parse(primary.URL)
+	assert.NoError(t, err)
+
+	access, err := NewAccessControl([]*Identity{
+		{Name: "team-a", Token: "team-a-token", Role: RoleDeploy, Namespace: "team-a"},
+		{Name: "ops", Certificate: "ops.example.com", Role: RoleAdmin},
+	})
+	assert.NoError(t, err)
+	router := createRouter(&context{cluster: &namespacedCluster{}, access: access, elector: &fakeElector{leader: u.Host}}, false)
+
+	// The primary only sees the certificate of the replica, and acts on
+	// behalf of the client it names.
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ops.example.com"}}
+	req, err := http.NewRequest("GET", "/info", nil)
+	assert.NoError(t, err)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	r := httptest.NewRecorder()
+	router.ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusOK)
+	assert.Equal(t, forwarded, "ops")
+
+	// Whatever the client claims to be.
+	req, err = http.NewRequest("GET", "/info", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer team-a-token")
+	req.Header.Set(identityHeader, "ops")
+	r = httptest.NewRecorder()
+	router.ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusOK)
+	assert.Equal(t, forwarded, "team-a")
+}
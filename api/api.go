@@ -5,17 +5,23 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/http"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	dockerfilters "github.com/docker/docker/pkg/parsers/filters"
+	"github.com/docker/swarm/ca"
 	"github.com/docker/swarm/cluster"
 	"github.com/docker/swarm/cluster/swarm"
+	"github.com/docker/swarm/metrics"
+	"github.com/docker/swarm/scheduler"
 	"github.com/docker/swarm/scheduler/filter"
 	"github.com/docker/swarm/version"
 	"github.com/gorilla/mux"
@@ -29,6 +35,46 @@ type context struct {
 	eventsHandler *eventsHandler
 	debug         bool
 	tlsConfig     *tls.Config
+	elector       Elector
+	authority     *ca.Authority
+	audit         *scheduler.AuditLog
+	access        *AccessControl
+	reloader      Reloader
+	// Review the containers before they are created, in order.
+	hooks []CreateHook
+}
+
+// Elector tells whether this manager is the primary one. Replicas forward the
+// API requests to the primary.
+type Elector interface {
+	IsLeader() bool
+	Leader() string
+}
+
+// Routes served to the clients without a certificate signed by the built-in
+// CA, when enabled.
+var publicRoutes = map[string]bool{
+	"/_ping":   true,
+	"/ca/sign": true,
+}
+
+// Routes served by every manager, rather than forwarded to the primary.
+var localRoutes = map[string]bool{
+	"/_ping":        true,
+	"/metrics":      true,
+	"/ca/sign":      true,
+	"/admin/reload": true,
+}
+
+// Routes hijacking the connection, which have to be forwarded as such.
+var hijackRoutes = map[string]bool{
+	"/containers/{name:.*}/attach": true,
+	"/exec/{execid:.*}/start":      true,
+}
+
+// Reloader reloads the configuration of the manager.
+type Reloader interface {
+	Reload() error
 }
 
 type handler func(c *context, w http.ResponseWriter, r *http.Request)
@@ -40,17 +86,126 @@ func getInfo(c *context, w http.ResponseWriter, r *http.Request) {
 		DriverStatus    [][2]string
 		NEventsListener int
 		Debug           bool
+		NCPU            int64
+		MemTotal        int64
 	}{
-		len(c.cluster.Containers()),
-		c.cluster.Info(),
-		c.eventsHandler.Size(),
-		c.debug,
+		Containers:      len(c.cluster.Containers()),
+		DriverStatus:    c.cluster.Info(),
+		NEventsListener: c.eventsHandler.Size(),
+		Debug:           c.debug,
+	}
+	for _, node := range c.cluster.Nodes() {
+		info.NCPU += node.TotalCpus()
+		info.MemTotal += node.TotalMemory()
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(info)
 }
 
+// GET /cluster/nodes
+func getClusterNodes(c *context, w http.ResponseWriter, r *http.Request) {
+	type nodeJSON struct {
+		ID             string
+		Name           string
+		Addr           string
+		IP             string
+		Healthy        bool
+		Drained        bool
+		Labels         map[string]string
+		EngineVersion  string
+		Containers     int
+		ReservedCpus   int64
+		TotalCpus      int64
+		ReservedMemory int64
+		TotalMemory    int64
+	}
+
+	nodes := []nodeJSON{}
+	for _, node := range c.cluster.Nodes() {
+		nodes = append(nodes, nodeJSON{
+			ID:             node.ID(),
+			Name:           node.Name(),
+			Addr:           node.Addr(),
+			IP:             node.IP(),
+			Healthy:        node.IsHealthy(),
+			Drained:        node.IsDrained(),
+			Labels:         node.Labels(),
+			EngineVersion:  node.Version(),
+			Containers:     len(node.Containers()),
+			ReservedCpus:   node.UsedCpus(),
+			TotalCpus:      node.TotalCpus(),
+			ReservedMemory: node.UsedMemory(),
+			TotalMemory:    node.TotalMemory(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nodes)
+}
+
+// GET /cluster/decisions
+func getClusterDecisions(c *context, w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil {
+			httpError(w, fmt.Sprintf("invalid limit %q", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	decisions := []*cluster.Decision{}
+	if c.audit != nil {
+		decisions = c.audit.Decisions(r.URL.Query().Get("name"), limit)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decisions)
+}
+
+// PUT /nodes/{name:.*}/drain
+func drainNode(c *context, w http.ResponseWriter, r *http.Request) {
+	containers := r.URL.Query().Get("containers")
+	switch containers {
+	case cluster.DrainKeep, cluster.DrainStop, cluster.DrainReschedule:
+	default:
+		httpError(w, fmt.Sprintf("Invalid containers mode %q, expected %q to keep them, %q or %q", containers, cluster.DrainKeep, cluster.DrainStop, cluster.DrainReschedule), http.StatusBadRequest)
+		return
+	}
+
+	nodeError(w, c.cluster.DrainNode(mux.Vars(r)["name"], containers))
+}
+
+// POST /admin/reload
+func postAdminReload(c *context, w http.ResponseWriter, r *http.Request) {
+	if c.reloader == nil {
+		httpError(w, "Reloading the configuration is not supported", http.StatusNotImplemented)
+		return
+	}
+	if err := c.reloader.Reload(); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /nodes/{name:.*}/activate
+func activateNode(c *context, w http.ResponseWriter, r *http.Request) {
+	nodeError(w, c.cluster.ActivateNode(mux.Vars(r)["name"]))
+}
+
+func nodeError(w http.ResponseWriter, err error) {
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case cluster.ErrNodeNotFound:
+		httpError(w, err.Error(), http.StatusNotFound)
+	default:
+		httpError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 // GET /version
 func getVersion(c *context, w http.ResponseWriter, r *http.Request) {
 	version := struct {
@@ -119,8 +274,13 @@ func getContainersJSON(c *context, w http.ResponseWriter, r *http.Request) {
 
 	all := r.Form.Get("all") == "1"
 
+	id := identityOf(r)
 	out := []*dockerclient.Container{}
 	for _, container := range c.cluster.Containers() {
+		// Skip the containers of the other namespaces.
+		if id != nil && !id.owns(container) {
+			continue
+		}
 		tmp := (*container).Container
 		// Skip stopped containers unless -a was specified.
 		if !strings.Contains(tmp.Status, "Up") && !all {
@@ -205,18 +365,30 @@ func postContainersCreate(c *context, w http.ResponseWriter, r *http.Request) {
 		name   = r.Form.Get("name")
 	)
 
-	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+	if err := decodeContainerConfig(r.Body, &config); err != nil {
 		httpError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !c.reviewCreate(w, r, &config, name) {
+		return
+	}
 
 	if container := c.cluster.Container(name); container != nil {
+		// Without telling which container of another namespace has it.
+		if id := identityOf(r); id != nil && !id.owns(container) {
+			httpError(w, fmt.Sprintf("Conflict, The name %s is already assigned.", name), http.StatusConflict)
+			return
+		}
 		httpError(w, fmt.Sprintf("Conflict, The name %s is already assigned to %s. You have to delete (or rename) that container to be able to assign %s to a container again.", name, container.Id, name), http.StatusConflict)
 		return
 	}
 
 	container, err := c.cluster.CreateContainer(&config, name)
 	if err != nil {
+		if _, ok := err.(*cluster.NameConflictError); ok {
+			httpError(w, err.Error(), http.StatusConflict)
+			return
+		}
 		httpError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -227,6 +399,344 @@ func postContainersCreate(c *context, w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// decodeContainerConfig decodes the config of a container, keeping in its
+// environment the volume driver the Docker client doesn't know of.
+func decodeContainerConfig(body io.Reader, config *dockerclient.ContainerConfig) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return err
+	}
+	extra := struct {
+		HostConfig struct {
+			VolumeDriver string
+		}
+	}{}
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return err
+	}
+	cluster.SetVolumeDriver(config, extra.HostConfig.VolumeDriver)
+	return nil
+}
+
+// POST /containers/place-dryrun
+func postContainersPlaceDryRun(c *context, w http.ResponseWriter, r *http.Request) {
+	var config dockerclient.ContainerConfig
+	if err := decodeContainerConfig(r.Body, &config); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if !c.reviewCreate(w, r, &config, name) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.cluster.PlaceDryRun(&config, name))
+}
+
+// deployRequest lists the containers to deploy together.
+type deployRequest struct {
+	Containers []*cluster.ContainerSpec
+}
+
+// deployedJSON is a container of a deploy, as created.
+type deployedJSON struct {
+	Name string
+	Id   string
+	Node string
+}
+
+// POST /containers/deploy
+func postContainersDeploy(c *context, w http.ResponseWriter, r *http.Request) {
+	var request deployRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(request.Containers) == 0 {
+		httpError(w, "no container to deploy", http.StatusBadRequest)
+		return
+	}
+	for _, spec := range request.Containers {
+		if spec.Config == nil {
+			httpError(w, fmt.Sprintf("no config for the container %q", spec.Name), http.StatusBadRequest)
+			return
+		}
+		if !c.reviewCreate(w, r, spec.Config, spec.Name) {
+			return
+		}
+	}
+
+	containers, err := c.cluster.Deploy(request.Containers)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if _, ok := err.(*cluster.NameConflictError); ok {
+			status = http.StatusConflict
+		} else if err == cluster.ErrDuplicateName || err == cluster.ErrDependencyCycle {
+			status = http.StatusBadRequest
+		}
+		httpError(w, err.Error(), status)
+		return
+	}
+
+	deployed := []deployedJSON{}
+	for _, container := range containers {
+		name := ""
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		deployed = append(deployed, deployedJSON{Name: name, Id: container.Id, Node: container.Node.Name()})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(deployed)
+}
+
+// volumeJSON is the volume as listed by the engines, its name prefixed by the
+// name of its node.
+type volumeJSON struct {
+	Name       string
+	Driver     string
+	Mountpoint string
+}
+
+func newVolumeJSON(volume *cluster.Volume) *volumeJSON {
+	return &volumeJSON{
+		Name:       volume.Node.Name() + "/" + volume.Name,
+		Driver:     volume.Driver,
+		Mountpoint: volume.Mountpoint,
+	}
+}
+
+// GET /volumes
+func getVolumes(c *context, w http.ResponseWriter, r *http.Request) {
+	list := struct {
+		Volumes []*volumeJSON
+	}{Volumes: []*volumeJSON{}}
+	for _, volume := range c.cluster.Volumes() {
+		list.Volumes = append(list.Volumes, newVolumeJSON(volume))
+	}
+	sort.Sort(volumesByName(list.Volumes))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+type volumesByName []*volumeJSON
+
+func (v volumesByName) Len() int           { return len(v) }
+func (v volumesByName) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v volumesByName) Less(i, j int) bool { return v[i].Name < v[j].Name }
+
+// GET /volumes/{volumename:.*}
+func getVolume(c *context, w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["volumename"]
+	volume := c.cluster.Volume(name)
+	if volume == nil {
+		httpError(w, fmt.Sprintf("No such volume: %s", name), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newVolumeJSON(volume))
+}
+
+// POST /volumes/create
+func postVolumesCreate(c *context, w http.ResponseWriter, r *http.Request) {
+	request := &cluster.VolumeCreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	volumes, err := c.cluster.CreateVolume(request)
+	if err == cluster.ErrNodeNotFound {
+		httpError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		httpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newVolumeJSON(volumes[0]))
+}
+
+// networkJSON is the network as listed by the engines, the name of the
+// networks local to a node prefixed by the name of the node.
+type networkJSON struct {
+	Name   string
+	ID     string `json:"Id"`
+	Scope  string
+	Driver string
+}
+
+func newNetworkJSON(network *cluster.Network) *networkJSON {
+	name := network.Name
+	if network.Scope != "global" {
+		name = network.Node.Name() + "/" + name
+	}
+	return &networkJSON{Name: name, ID: network.ID, Scope: network.Scope, Driver: network.Driver}
+}
+
+// GET /networks
+func getNetworks(c *context, w http.ResponseWriter, r *http.Request) {
+	networks := []*networkJSON{}
+	seen := make(map[string]bool)
+	for _, network := range c.cluster.Networks() {
+		// The nodes share the networks of the global scope.
+		if network.Scope == "global" {
+			if seen[network.ID] {
+				continue
+			}
+			seen[network.ID] = true
+		}
+		networks = append(networks, newNetworkJSON(network))
+	}
+	sort.Sort(networksByName(networks))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(networks)
+}
+
+type networksByName []*networkJSON
+
+func (n networksByName) Len() int           { return len(n) }
+func (n networksByName) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n networksByName) Less(i, j int) bool { return n[i].Name < n[j].Name }
+
+// GET /networks/{networkid:.*}
+func getNetwork(c *context, w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["networkid"]
+	network := c.cluster.Network(id)
+	if network == nil {
+		httpError(w, fmt.Sprintf("No such network: %s", id), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newNetworkJSON(network))
+}
+
+// POST /networks/create
+func postNetworksCreate(c *context, w http.ResponseWriter, r *http.Request) {
+	request := &cluster.NetworkCreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.CheckDuplicate && c.cluster.Network(request.Name) != nil {
+		httpError(w, fmt.Sprintf("network with name %s already exists", request.Name), http.StatusConflict)
+		return
+	}
+
+	networks, err := c.cluster.CreateNetwork(request)
+	if err == cluster.ErrNodeNotFound {
+		httpError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		httpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "{%q:%q}", "Id", networks[0].ID)
+}
+
+// POST /images/create
+func postImagesCreate(c *context, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := query.Get("fromImage")
+	if name == "" {
+		// Importing an image from a tarball isn't supported.
+		notImplementedHandler(c, w, r)
+		return
+	}
+	if tag := query.Get("tag"); tag != "" {
+		name += ":" + tag
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	wf := NewWriteFlusher(w)
+	encoder := json.NewEncoder(wf)
+
+	results, err := c.cluster.Pull(name, r.Header.Get("X-Registry-Auth"), query["constraint"], func(node cluster.Node, progress *cluster.PullProgress) {
+		// Tell the nodes apart in the multiplexed stream.
+		progress.ID = pullID(node, progress.ID)
+		encoder.Encode(progress)
+	})
+	if err != nil {
+		httpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			encoder.Encode(&cluster.PullProgress{ID: pullID(result.Node, ""), Status: "Pull failed: " + result.Err.Error()})
+		}
+	}
+	if failed > 0 {
+		encoder.Encode(&cluster.PullProgress{Error: fmt.Sprintf("Failed to pull %s on %d of %d nodes", name, failed, len(results))})
+	}
+}
+
+func pullID(node cluster.Node, id string) string {
+	if id == "" {
+		return node.Name()
+	}
+	return node.Name() + ": " + id
+}
+
+// POST /images/prefetch
+func postImagesPrefetch(c *context, w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Images      []string
+		Constraints []string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(request.Images) == 0 {
+		httpError(w, "no image to prefetch", http.StatusBadRequest)
+		return
+	}
+
+	type resultJSON struct {
+		Node  string
+		Image string
+		Error string `json:",omitempty"`
+	}
+	results := []resultJSON{}
+	for _, image := range request.Images {
+		pulled, err := c.cluster.Pull(image, r.Header.Get("X-Registry-Auth"), request.Constraints, func(cluster.Node, *cluster.PullProgress) {})
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, result := range pulled {
+			res := resultJSON{Node: result.Node.Name(), Image: image}
+			if result.Err != nil {
+				res.Error = result.Err.Error()
+			}
+			results = append(results, res)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
 // DELETE /containers/{name:.*}
 func deleteContainer(c *context, w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
@@ -241,7 +751,11 @@ func deleteContainer(c *context, w http.ResponseWriter, r *http.Request) {
 		httpError(w, fmt.Sprintf("Container %s not found", name), http.StatusNotFound)
 		return
 	}
-	if err := c.cluster.RemoveContainer(container, force); err != nil {
+	remove := c.cluster.RemoveContainer
+	if r.Form.Get("global") == "1" {
+		remove = c.cluster.RemoveGlobalContainer
+	}
+	if err := remove(container, force); err != nil {
 		httpError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -250,15 +764,58 @@ func deleteContainer(c *context, w http.ResponseWriter, r *http.Request) {
 
 // GET /events
 func getEvents(c *context, w http.ResponseWriter, r *http.Request) {
-	c.eventsHandler.Add(r.RemoteAddr, w)
-
 	w.Header().Set("Content-Type", "application/json")
 
 	if f, ok := w.(http.Flusher); ok {
 		f.Flush()
 	}
 
-	c.eventsHandler.Wait(r.RemoteAddr)
+	// Events are streamed from all the nodes, including the ones joining the
+	// cluster later.
+	var allow func(*cluster.Event) bool
+	if id := identityOf(r); id != nil && id.Namespace != "" {
+		allow = c.ownedEvents(id)
+	}
+	c.eventsHandler.Add(r.RemoteAddr, w, allow)
+
+	var closed <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closed = cn.CloseNotify()
+	}
+	c.eventsHandler.Wait(r.RemoteAddr, closed)
+}
+
+// POST /ca/sign
+func postCASign(c *context, w http.ResponseWriter, r *http.Request) {
+	if c.authority == nil {
+		httpError(w, "The built-in CA is not enabled", http.StatusNotFound)
+		return
+	}
+
+	var req ca.SignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Issued to the address the node connects from, whatever it asks for.
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	cert, err := c.authority.Sign([]byte(req.CSR), req.Token, host)
+	if err == ca.ErrInvalidToken {
+		httpError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&ca.SignResponse{Certificate: string(cert), CA: string(c.authority.CertPEM())})
+}
+
+// GET /metrics
+func getMetrics(c *context, w http.ResponseWriter, r *http.Request) {
+	metrics.Handler().ServeHTTP(w, r)
 }
 
 // GET /_ping
@@ -266,6 +823,35 @@ func ping(c *context, w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte{'O', 'K'})
 }
 
+// POST /containers/{name:.*}/start
+func postContainersStart(c *context, w http.ResponseWriter, r *http.Request) {
+	container, err := getContainerFromVars(c, mux.Vars(r))
+	if err != nil {
+		httpError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !c.reviewStart(w, r, container) {
+		return
+	}
+
+	if err := proxy(c.tlsConfig, container.Node.Addr(), w, r); err != nil {
+		httpError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// POST /containers/{name:.*}/exec
+func postContainersExec(c *context, w http.ResponseWriter, r *http.Request) {
+	container, err := getContainerFromVars(c, mux.Vars(r))
+	if err != nil {
+		httpError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !c.reviewExec(w, r, container) {
+		return
+	}
+	proxyContainerAndForceRefresh(c, w, r)
+}
+
 // Proxy a request to the right node and do a force refresh
 func proxyContainerAndForceRefresh(c *context, w http.ResponseWriter, r *http.Request) {
 	container, err := getContainerFromVars(c, mux.Vars(r))
@@ -354,6 +940,24 @@ func notImplementedHandler(c *context, w http.ResponseWriter, r *http.Request) {
 	httpError(w, "Not supported in clustering mode.", http.StatusNotImplemented)
 }
 
+// Forward a request received by a replica to the primary manager.
+func proxyPrimary(c *context, hijacking bool, w http.ResponseWriter, r *http.Request) {
+	leader := c.elector.Leader()
+	if leader == "" {
+		httpError(w, "No elected primary cluster manager", http.StatusServiceUnavailable)
+		return
+	}
+
+	forwardIdentity(r)
+	forward := proxy
+	if hijacking {
+		forward = hijack
+	}
+	if err := forward(c.tlsConfig, leader, w, r); err != nil {
+		httpError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func optionsHandler(c *context, w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
@@ -364,6 +968,10 @@ func writeCorsHeaders(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Access-Control-Allow-Methods", "GET, POST, DELETE, PUT, OPTIONS")
 }
 
+func hasVerifiedCert(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
 func httpError(w http.ResponseWriter, err string, status int) {
 	log.WithField("status", status).Errorf("HTTP error: %v", err)
 	http.Error(w, err, status)
@@ -374,8 +982,11 @@ func createRouter(c *context, enableCors bool) *mux.Router {
 	m := map[string]map[string]handler{
 		"GET": {
 			"/_ping":                          ping,
+			"/metrics":                        getMetrics,
 			"/events":                         getEvents,
 			"/info":                           getInfo,
+			"/cluster/nodes":                  getClusterNodes,
+			"/cluster/decisions":              getClusterDecisions,
 			"/version":                        getVersion,
 			"/images/json":                    getImagesJSON,
 			"/images/viz":                     notImplementedHandler,
@@ -394,30 +1005,45 @@ func createRouter(c *context, enableCors bool) *mux.Router {
 			"/containers/{name:.*}/stats":     proxyContainer,
 			"/containers/{name:.*}/attach/ws": notImplementedHandler,
 			"/exec/{execid:.*}/json":          proxyContainer,
+			"/volumes":                        getVolumes,
+			"/volumes/{volumename:.*}":        getVolume,
+			"/networks":                       getNetworks,
+			"/networks/{networkid:.*}":        getNetwork,
 		},
 		"POST": {
 			"/auth":                         proxyRandom,
+			"/admin/reload":                 postAdminReload,
+			"/ca/sign":                      postCASign,
 			"/commit":                       notImplementedHandler,
 			"/build":                        notImplementedHandler,
-			"/images/create":                notImplementedHandler,
+			"/images/create":                postImagesCreate,
+			"/images/prefetch":              postImagesPrefetch,
 			"/images/load":                  notImplementedHandler,
 			"/images/{name:.*}/push":        notImplementedHandler,
 			"/images/{name:.*}/tag":         notImplementedHandler,
 			"/containers/create":            postContainersCreate,
+			"/containers/deploy":            postContainersDeploy,
+			"/containers/place-dryrun":      postContainersPlaceDryRun,
 			"/containers/{name:.*}/kill":    proxyContainer,
 			"/containers/{name:.*}/pause":   proxyContainer,
 			"/containers/{name:.*}/unpause": proxyContainer,
 			"/containers/{name:.*}/rename":  proxyContainer,
 			"/containers/{name:.*}/restart": proxyContainer,
-			"/containers/{name:.*}/start":   proxyContainer,
+			"/containers/{name:.*}/start":   postContainersStart,
 			"/containers/{name:.*}/stop":    proxyContainer,
 			"/containers/{name:.*}/wait":    proxyContainer,
 			"/containers/{name:.*}/resize":  proxyContainer,
 			"/containers/{name:.*}/attach":  proxyHijack,
 			"/containers/{name:.*}/copy":    proxyContainer,
-			"/containers/{name:.*}/exec":    proxyContainerAndForceRefresh,
+			"/containers/{name:.*}/exec":    postContainersExec,
 			"/exec/{execid:.*}/start":       proxyHijack,
 			"/exec/{execid:.*}/resize":      proxyContainer,
+			"/volumes/create":               postVolumesCreate,
+			"/networks/create":              postNetworksCreate,
+		},
+		"PUT": {
+			"/nodes/{name:.*}/drain":    drainNode,
+			"/nodes/{name:.*}/activate": activateNode,
 		},
 		"DELETE": {
 			"/containers/{name:.*}": deleteContainer,
@@ -435,18 +1061,30 @@ func createRouter(c *context, enableCors bool) *mux.Router {
 			// NOTE: scope issue, make sure the variables are local and won't be changed
 			localRoute := route
 			localFct := fct
+			localMethod := method
 			wrap := func(w http.ResponseWriter, r *http.Request) {
 				log.WithFields(log.Fields{"method": r.Method, "uri": r.RequestURI}).Info("HTTP request received")
 				if enableCors {
 					writeCorsHeaders(w, r)
 				}
+				if c.authority != nil && !publicRoutes[localRoute] && !hasVerifiedCert(r) {
+					httpError(w, "A certificate signed by the cluster CA is required", http.StatusUnauthorized)
+					return
+				}
+				if !c.authorize(localMethod, localRoute, w, r) {
+					return
+				}
+				if c.elector != nil && !c.elector.IsLeader() && !localRoutes[localRoute] {
+					proxyPrimary(c, hijackRoutes[localRoute], w, r)
+					return
+				}
 				localFct(c, w, r)
 			}
-			localMethod := method
+			handler := instrument(localMethod, localRoute, wrap)
 
 			// add the new route
-			r.Path("/v{version:[0-9.]+}" + localRoute).Methods(localMethod).HandlerFunc(wrap)
-			r.Path(localRoute).Methods(localMethod).HandlerFunc(wrap)
+			r.Path("/v{version:[0-9.]+}" + localRoute).Methods(localMethod).HandlerFunc(handler)
+			r.Path(localRoute).Methods(localMethod).HandlerFunc(handler)
 		}
 	}
 
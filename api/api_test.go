@@ -1,9 +1,22 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/swarm/ca"
 	"github.com/docker/swarm/cluster"
+	"github.com/docker/swarm/scheduler"
+	"github.com/docker/swarm/scheduler/filter"
+	"github.com/docker/swarm/scheduler/strategy"
 	"github.com/docker/swarm/version"
+	"github.com/samalba/dockerclient"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
@@ -35,3 +48,480 @@ func TestGetVersion(t *testing.T) {
 	json.NewDecoder(r.Body).Decode(&v)
 	assert.Equal(t, v.Version, "swarm/"+version.VERSION)
 }
+
+// Cluster made of a single FakeNode.
+type fakeCluster struct{}
+
+func (c *fakeCluster) CreateContainer(config *dockerclient.ContainerConfig, name string) (*cluster.Container, error) {
+	return nil, nil
+}
+func (c *fakeCluster) RemoveContainer(container *cluster.Container, force bool) error { return nil }
+func (c *fakeCluster) RemoveGlobalContainer(container *cluster.Container, force bool) error {
+	return nil
+}
+func (c *fakeCluster) PlaceDryRun(config *dockerclient.ContainerConfig, name string) *cluster.Decision {
+	binpacking, _ := strategy.New("binpacking", nil)
+	return scheduler.New(binpacking, []filter.Filter{&filter.ConstraintFilter{}}).Explain([]cluster.Node{&FakeNode{}}, config, name, false)
+}
+func (c *fakeCluster) Deploy(specs []*cluster.ContainerSpec) ([]*cluster.Container, error) {
+	ordered, err := cluster.OrderSpecs(specs)
+	if err != nil {
+		return nil, err
+	}
+	containers := []*cluster.Container{}
+	for _, spec := range ordered {
+		if spec.Name == "taken" {
+			return nil, &cluster.NameConflictError{Name: spec.Name}
+		}
+		containers = append(containers, &cluster.Container{
+			Container: dockerclient.Container{Id: spec.Name + "_id", Names: []string{"/" + spec.Name}},
+			Node:      &FakeNode{},
+		})
+	}
+	return containers, nil
+}
+func (c *fakeCluster) Images() []*cluster.Image                     { return nil }
+func (c *fakeCluster) Image(IdOrName string) *cluster.Image         { return nil }
+func (c *fakeCluster) Containers() []*cluster.Container             { return nil }
+func (c *fakeCluster) Container(IdOrName string) *cluster.Container { return nil }
+func (c *fakeCluster) Nodes() []cluster.Node                        { return []cluster.Node{&FakeNode{}} }
+func (c *fakeCluster) DrainNode(IdOrName string, containers string) error {
+	if IdOrName != "node_id" {
+		return cluster.ErrNodeNotFound
+	}
+	return nil
+}
+func (c *fakeCluster) ActivateNode(IdOrName string) error { return c.DrainNode(IdOrName, "") }
+func (c *fakeCluster) Info() [][2]string                  { return nil }
+func (c *fakeCluster) Volumes() []*cluster.Volume {
+	return []*cluster.Volume{{Name: "data", Driver: "local", Mountpoint: "/var/lib/docker/volumes/data/_data", Node: &FakeNode{}}}
+}
+func (c *fakeCluster) Volume(name string) *cluster.Volume {
+	for _, volume := range c.Volumes() {
+		if volume.Name == name || "node_name/"+volume.Name == name {
+			return volume
+		}
+	}
+	return nil
+}
+func (c *fakeCluster) Networks() []*cluster.Network {
+	return []*cluster.Network{
+		{ID: "bridge_id", Name: "bridge", Driver: "bridge", Scope: "local", Node: &FakeNode{}},
+		{ID: "overlay_id", Name: "backend", Driver: "overlay", Scope: "global", Node: &FakeNode{}},
+		{ID: "overlay_id", Name: "backend", Driver: "overlay", Scope: "global", Node: &FakeNode{}},
+	}
+}
+func (c *fakeCluster) Network(IdOrName string) *cluster.Network {
+	for _, network := range c.Networks() {
+		if network.ID == IdOrName || network.Name == IdOrName {
+			return network
+		}
+	}
+	return nil
+}
+func (c *fakeCluster) CreateNetwork(request *cluster.NetworkCreateRequest) ([]*cluster.Network, error) {
+	return []*cluster.Network{{ID: request.Name + "_id", Name: request.Name, Node: &FakeNode{}}}, nil
+}
+func (c *fakeCluster) CreateVolume(request *cluster.VolumeCreateRequest) ([]*cluster.Volume, error) {
+	return []*cluster.Volume{{Name: request.Name, Driver: "local", Node: &FakeNode{}}}, nil
+}
+func (c *fakeCluster) Pull(name string, authConfig string, constraints []string, callback func(cluster.Node, *cluster.PullProgress)) ([]*cluster.PullResult, error) {
+	if len(constraints) > 0 {
+		return nil, errors.New("no node satisfies the constraints")
+	}
+	node := &FakeNode{}
+	if name == "unknown" {
+		return []*cluster.PullResult{{Node: node, Err: errors.New("image not found")}}, nil
+	}
+	callback(node, &cluster.PullProgress{ID: "latest", Status: "Pulling from " + name})
+	callback(node, &cluster.PullProgress{Status: "Status: Image is up to date for " + name})
+	return []*cluster.PullResult{{Node: node}}, nil
+}
+
+func TestGetClusterNodes(t *testing.T) {
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/v1.17/cluster/nodes", nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusOK)
+
+	nodes := []struct {
+		ID            string
+		Addr          string
+		Healthy       bool
+		EngineVersion string
+		TotalCpus     int64
+	}{}
+	assert.NoError(t, json.NewDecoder(r.Body).Decode(&nodes))
+	assert.Len(t, nodes, 1)
+	assert.Equal(t, nodes[0].ID, "node_id")
+	assert.Equal(t, nodes[0].Addr, "node_addr")
+	assert.True(t, nodes[0].Healthy)
+	assert.Equal(t, nodes[0].EngineVersion, "1.6.0")
+}
+
+func TestDrainNode(t *testing.T) {
+	for _, test := range []struct {
+		url  string
+		code int
+	}{
+		{"/nodes/node_id/drain", http.StatusNoContent},
+		{"/nodes/node_id/drain?containers=reschedule", http.StatusNoContent},
+		{"/nodes/node_id/drain?containers=delete", http.StatusBadRequest},
+		{"/nodes/unknown/drain", http.StatusNotFound},
+		{"/v1.17/nodes/node_id/activate", http.StatusNoContent},
+		{"/nodes/unknown/activate", http.StatusNotFound},
+	} {
+		r := httptest.NewRecorder()
+		req, err := http.NewRequest("PUT", test.url, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+		assert.Equal(t, r.Code, test.code, test.url)
+	}
+
+	// The error lists all the modes.
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("PUT", "/nodes/node_id/drain?containers=delete", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Contains(t, r.Body.String(), `expected "" to keep them, "stop" or "reschedule"`)
+}
+
+type fakeReloader struct {
+	err error
+}
+
+func (r *fakeReloader) Reload() error { return r.err }
+
+func TestPostAdminReload(t *testing.T) {
+	for _, test := range []struct {
+		reloader Reloader
+		code     int
+	}{
+		{nil, http.StatusNotImplemented},
+		{&fakeReloader{}, http.StatusNoContent},
+		{&fakeReloader{err: errors.New("invalid config")}, http.StatusBadRequest},
+	} {
+		r := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/admin/reload", nil)
+		assert.NoError(t, err)
+		createRouter(&context{cluster: &fakeCluster{}, reloader: test.reloader}, false).ServeHTTP(r, req)
+		assert.Equal(t, r.Code, test.code)
+	}
+}
+
+func TestAutoCaRequiresCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-ca")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	authority, err := ca.Load(dir, "secret", time.Hour)
+	assert.NoError(t, err)
+
+	context := &context{cluster: &fakeCluster{}, authority: authority}
+	router := createRouter(context, false)
+
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/cluster/nodes", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusUnauthorized)
+
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/_ping", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusOK)
+
+	// Nodes get their certificate with the token.
+	_, csr, err := ca.NewKeyAndCSR("node-1", []string{"192.168.0.42"})
+	assert.NoError(t, err)
+	body, err := json.Marshal(&ca.SignRequest{CSR: string(csr), Token: "secret"})
+	assert.NoError(t, err)
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("POST", "/ca/sign", bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.RemoteAddr = "192.168.0.42:51234"
+	router.ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusOK)
+	signed := &ca.SignResponse{}
+	assert.NoError(t, json.NewDecoder(r.Body).Decode(signed))
+	assert.NotEmpty(t, signed.Certificate)
+	assert.Equal(t, signed.CA, string(authority.CertPEM()))
+}
+
+// Elector of a replica.
+type fakeElector struct {
+	leader string
+}
+
+func (e *fakeElector) IsLeader() bool { return false }
+func (e *fakeElector) Leader() string { return e.leader }
+
+func TestReplicaForwardsToPrimary(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/info")
+		w.Write([]byte("from primary"))
+	}))
+	defer primary.Close()
+
+	u, err := url.Parse(primary.URL)
+	assert.NoError(t, err)
+
+	context := &context{elector: &fakeElector{leader: u.Host}}
+	router := createRouter(context, false)
+
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/info", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusOK)
+	assert.Equal(t, r.Body.String(), "from primary")
+
+	// Replicas answer pings themselves.
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/_ping", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusOK)
+	assert.True(t, strings.Contains(r.Body.String(), "OK"))
+
+	context.elector = &fakeElector{}
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/info", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusServiceUnavailable)
+}
+
+func TestGetMetrics(t *testing.T) {
+	// Even replicas serve their own metrics.
+	context := &context{cluster: &fakeCluster{}, elector: &fakeElector{}}
+	router := createRouter(context, false)
+
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/version", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(r, req)
+
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/metrics", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusOK)
+	assert.Contains(t, r.Body.String(), `swarm_api_requests_total{method="GET",route="/version",code="200"}`)
+	assert.Contains(t, r.Body.String(), "# TYPE swarm_api_request_seconds histogram")
+	assert.Contains(t, r.Body.String(), "# TYPE swarm_scheduler_placements_total counter")
+}
+
+func TestGetClusterDecisions(t *testing.T) {
+	random, err := strategy.New("random", nil)
+	assert.NoError(t, err)
+	sched := scheduler.New(random, []filter.Filter{&filter.HealthFilter{}})
+	_, err = sched.SelectNodeForContainer([]cluster.Node{&FakeNode{}}, &dockerclient.ContainerConfig{Image: "busybox"}, "app")
+	assert.NoError(t, err)
+	_, err = sched.SelectNodeForContainer([]cluster.Node{}, &dockerclient.ContainerConfig{Image: "redis"}, "db")
+	assert.Error(t, err)
+
+	context := &context{cluster: &fakeCluster{}, audit: sched.AuditLog()}
+	router := createRouter(context, false)
+
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/cluster/decisions?name=app", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusOK)
+
+	decisions := []*cluster.Decision{}
+	assert.NoError(t, json.NewDecoder(r.Body).Decode(&decisions))
+	assert.Len(t, decisions, 1)
+	assert.Equal(t, decisions[0].Image, "busybox")
+	assert.Equal(t, decisions[0].Selected, []string{"node_name"})
+
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/cluster/decisions?limit=1", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(r, req)
+	assert.NoError(t, json.NewDecoder(r.Body).Decode(&decisions))
+	assert.Len(t, decisions, 1)
+	assert.Equal(t, decisions[0].Name, "db")
+	assert.NotEmpty(t, decisions[0].Error)
+
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/cluster/decisions?limit=all", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusBadRequest)
+}
+
+func TestPostContainersPlaceDryRun(t *testing.T) {
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/containers/place-dryrun?name=app", strings.NewReader(`{"Image":"busybox"}`))
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusOK)
+
+	decision := &cluster.Decision{}
+	assert.NoError(t, json.NewDecoder(r.Body).Decode(decision))
+	assert.Equal(t, decision.Name, "app")
+	assert.Equal(t, decision.Strategy, "binpacking")
+	assert.Equal(t, decision.Selected, []string{"node_name"})
+	assert.Len(t, decision.Scores, 1)
+
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("POST", "/containers/place-dryrun", strings.NewReader(`{"Image":"busybox","Env":["constraint:node==other"]}`))
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusOK)
+
+	decision = &cluster.Decision{}
+	assert.NoError(t, json.NewDecoder(r.Body).Decode(decision))
+	assert.Empty(t, decision.Selected)
+	assert.Len(t, decision.Rejected, 1)
+	assert.Equal(t, decision.Rejected[0].Filter, "constraint")
+	assert.NotEmpty(t, decision.Error)
+}
+
+func TestDecodeContainerConfig(t *testing.T) {
+	config := dockerclient.ContainerConfig{}
+	assert.NoError(t, decodeContainerConfig(strings.NewReader(`{"Image":"mysql","Env":["A=1"],"HostConfig":{"VolumeDriver":"flocker"}}`), &config))
+	assert.Equal(t, config.Image, "mysql")
+	assert.Equal(t, cluster.VolumeDriver(&config), "flocker")
+
+	// Only HostConfig sets the driver.
+	config = dockerclient.ContainerConfig{}
+	assert.NoError(t, decodeContainerConfig(strings.NewReader(`{"Env":["com.docker.swarm.volume-driver=flocker"]}`), &config))
+	assert.Equal(t, cluster.VolumeDriver(&config), "")
+	assert.Error(t, decodeContainerConfig(strings.NewReader(`{`), &config))
+}
+
+func TestPostImagesCreate(t *testing.T) {
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/images/create?fromImage=busybox&tag=latest", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusOK)
+	assert.Equal(t, r.Body.String(), `{"id":"node_name: latest","status":"Pulling from busybox:latest"}
+{"id":"node_name","status":"Status: Image is up to date for busybox:latest"}
+`)
+
+	// The stream ends with an error if a node failed.
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("POST", "/images/create?fromImage=unknown", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Body.String(), `{"id":"node_name","status":"Pull failed: image not found"}
+{"error":"Failed to pull unknown on 1 of 1 nodes"}
+`)
+
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("POST", "/images/create?fromImage=busybox&constraint=storage==ssd", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusInternalServerError)
+}
+
+func TestPostImagesPrefetch(t *testing.T) {
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/images/prefetch", strings.NewReader(`{"Images":["busybox","unknown"]}`))
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusOK)
+
+	results := []struct {
+		Node  string
+		Image string
+		Error string
+	}{}
+	assert.NoError(t, json.NewDecoder(r.Body).Decode(&results))
+	assert.Len(t, results, 2)
+	assert.Equal(t, results[0].Image, "busybox")
+	assert.Empty(t, results[0].Error)
+	assert.Equal(t, results[1].Error, "image not found")
+
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("POST", "/images/prefetch", strings.NewReader(`{}`))
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusBadRequest)
+}
+
+func TestPostContainersDeploy(t *testing.T) {
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/containers/deploy", strings.NewReader(`{"Containers":[
+		{"Name":"web","Config":{"Image":"nginx","HostConfig":{"Links":["db:db"]}},"Start":true},
+		{"Name":"db","Config":{"Image":"redis"}}]}`))
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusCreated)
+	assert.Equal(t, r.Body.String(), `[{"Name":"db","Id":"db_id","Node":"node_name"},{"Name":"web","Id":"web_id","Node":"node_name"}]`+"\n")
+
+	for body, code := range map[string]int{
+		`{}`:                              http.StatusBadRequest,
+		`{"Containers":[{"Name":"web"}]}`: http.StatusBadRequest,
+		`{"Containers":[{"Name":"a","Config":{"HostConfig":{"VolumesFrom":["b"]}}},{"Name":"b","Config":{"HostConfig":{"Links":["a:a"]}}}]}`: http.StatusBadRequest,
+		`{"Containers":[{"Name":"taken","Config":{}}]}`: http.StatusConflict,
+	} {
+		r = httptest.NewRecorder()
+		req, err = http.NewRequest("POST", "/containers/deploy", strings.NewReader(body))
+		assert.NoError(t, err)
+		assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+		assert.Equal(t, r.Code, code, body)
+	}
+}
+
+func TestVolumes(t *testing.T) {
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/v1.21/volumes", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusOK)
+	assert.Equal(t, r.Body.String(), `{"Volumes":[{"Name":"node_name/data","Driver":"local","Mountpoint":"/var/lib/docker/volumes/data/_data"}]}`+"\n")
+
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/volumes/node_name/data", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusOK)
+
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/volumes/unknown", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusNotFound)
+
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("POST", "/volumes/create", strings.NewReader(`{"Name":"db"}`))
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusCreated)
+	assert.Contains(t, r.Body.String(), `"Name":"node_name/db"`)
+}
+
+func TestNetworks(t *testing.T) {
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/v1.21/networks", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusOK)
+	assert.Equal(t, r.Body.String(), `[{"Name":"backend","Id":"overlay_id","Scope":"global","Driver":"overlay"},{"Name":"node_name/bridge","Id":"bridge_id","Scope":"local","Driver":"bridge"}]`+"\n")
+
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/networks/overlay_id", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusOK)
+
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("POST", "/networks/create", strings.NewReader(`{"Name":"frontend","Driver":"overlay","CheckDuplicate":true}`))
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusCreated)
+	assert.Equal(t, r.Body.String(), `{"Id":"frontend_id"}`)
+
+	r = httptest.NewRecorder()
+	req, err = http.NewRequest("POST", "/networks/create", strings.NewReader(`{"Name":"backend","Driver":"overlay","CheckDuplicate":true}`))
+	assert.NoError(t, err)
+	assert.NoError(t, serveRequest(&fakeCluster{}, r, req))
+	assert.Equal(t, r.Code, http.StatusConflict)
+}
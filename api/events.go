@@ -13,28 +13,59 @@ type eventsHandler struct {
 	sync.RWMutex
 	ws map[string]io.Writer
 	cs map[string]chan struct{}
+	fs map[string]func(*cluster.Event) bool
 }
 
 func NewEventsHandler() *eventsHandler {
 	return &eventsHandler{
 		ws: make(map[string]io.Writer),
 		cs: make(map[string]chan struct{}),
+		fs: make(map[string]func(*cluster.Event) bool),
 	}
 }
 
-func (eh *eventsHandler) Add(remoteAddr string, w io.Writer) {
+// Add streams the events to `w`, only those `allow` returns true for unless
+// it is nil.
+func (eh *eventsHandler) Add(remoteAddr string, w io.Writer, allow func(*cluster.Event) bool) {
 	eh.Lock()
 	eh.ws[remoteAddr] = w
 	eh.cs[remoteAddr] = make(chan struct{})
+	if allow != nil {
+		eh.fs[remoteAddr] = allow
+	}
 	eh.Unlock()
 }
 
-func (eh *eventsHandler) Wait(remoteAddr string) {
-	<-eh.cs[remoteAddr]
+// Wait blocks until the writer of `remoteAddr` fails or `closed` is
+// signaled, when the client went away, and then forgets about it.
+func (eh *eventsHandler) Wait(remoteAddr string, closed <-chan bool) {
+	eh.RLock()
+	c := eh.cs[remoteAddr]
+	eh.RUnlock()
+
+	select {
+	case <-c:
+	case <-closed:
+		eh.remove(remoteAddr)
+	}
+}
+
+func (eh *eventsHandler) remove(remoteAddr string) {
+	eh.Lock()
+	defer eh.Unlock()
+
+	if c, ok := eh.cs[remoteAddr]; ok {
+		close(c)
+		delete(eh.ws, remoteAddr)
+		delete(eh.cs, remoteAddr)
+		delete(eh.fs, remoteAddr)
+	}
 }
 
+// Handle multiplexes the events of all the nodes to the clients, tagging each
+// event with the node it comes from.
 func (eh *eventsHandler) Handle(e *cluster.Event) error {
-	eh.RLock()
+	eh.Lock()
 
 	str := fmt.Sprintf("{%q:%q,%q:%q,%q:%q,%q:%d,%q:%q,%q:%q,%q:%q,%q:%q}",
 		"status", e.Status,
@@ -47,10 +78,14 @@ func (eh *eventsHandler) Handle(e *cluster.Event) error {
 		"node_ip", e.Node.IP())
 
 	for key, w := range eh.ws {
-		if _, err := fmt.Fprintf(w, str); err != nil {
+		if allow, ok := eh.fs[key]; ok && !allow(e) {
+			continue
+		}
+		if _, err := fmt.Fprint(w, str); err != nil {
 			close(eh.cs[key])
 			delete(eh.ws, key)
 			delete(eh.cs, key)
+			delete(eh.fs, key)
 			continue
 		}
 
@@ -59,7 +94,7 @@ func (eh *eventsHandler) Handle(e *cluster.Event) error {
 		}
 
 	}
-	eh.RUnlock()
+	eh.Unlock()
 	return nil
 }
 
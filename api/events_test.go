@@ -23,6 +23,7 @@ func (fn *FakeNode) ID() string                            { return "node_id" }
 func (fn *FakeNode) Name() string                          { return "node_name" }
 func (fn *FakeNode) IP() string                            { return "node_ip" }
 func (fn *FakeNode) Addr() string                          { return "node_addr" }
+func (fn *FakeNode) Version() string                       { return "1.6.0" }
 func (fn *FakeNode) Images() []*cluster.Image              { return nil }
 func (fn *FakeNode) Image(_ string) *cluster.Image         { return nil }
 func (fn *FakeNode) Containers() []*cluster.Container      { return nil }
@@ -33,13 +34,19 @@ func (fn *FakeNode) TotalMemory() int64                    { return 0 }
 func (fn *FakeNode) UsedMemory() int64                     { return 0 }
 func (fn *FakeNode) Labels() map[string]string             { return nil }
 func (fn *FakeNode) IsHealthy() bool                       { return true }
+func (fn *FakeNode) IsDrained() bool                       { return false }
+func (fn *FakeNode) Volumes() []*cluster.Volume            { return nil }
+func (fn *FakeNode) VolumeDrivers() []string               { return nil }
+func (fn *FakeNode) Networks() []*cluster.Network          { return nil }
+func (fn *FakeNode) CpuUsage() float64                     { return 0 }
+func (fn *FakeNode) MemoryUsage() float64                  { return 0 }
 
 func TestHandle(t *testing.T) {
 	eh := NewEventsHandler()
 	assert.Equal(t, eh.Size(), 0)
 
 	fw := &FakeWriter{Tmp: []byte{}}
-	eh.Add("test", fw)
+	eh.Add("test", fw, nil)
 
 	assert.Equal(t, eh.Size(), 1)
 
@@ -66,3 +73,22 @@ func TestHandle(t *testing.T) {
 
 	assert.Equal(t, str, string(fw.Tmp))
 }
+
+func TestHandleClosedClient(t *testing.T) {
+	eh := NewEventsHandler()
+	eh.Add("test", &FakeWriter{Tmp: []byte{}}, nil)
+	assert.Equal(t, eh.Size(), 1)
+
+	closed := make(chan bool, 1)
+	closed <- true
+	eh.Wait("test", closed)
+	assert.Equal(t, eh.Size(), 0)
+
+	// Events keep flowing to the other clients.
+	fw := &FakeWriter{Tmp: []byte{}}
+	eh.Add("other", fw, nil)
+	event := &cluster.Event{Node: &FakeNode{}}
+	event.Event.Id = "100%"
+	assert.NoError(t, eh.Handle(event))
+	assert.Contains(t, string(fw.Tmp), `"id":"100%"`)
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/samalba/dockerclient"
+)
+
+// Timeout of the requests to the webhooks.
+const webhookTimeout = 10 * time.Second
+
+// A CreateRequest is a container about to be created.
+type CreateRequest struct {
+	Name string
+	// Name of the client, if authenticated.
+	Identity string `json:",omitempty"`
+	Config   *dockerclient.ContainerConfig
+}
+
+// A CreateHook reviews the containers before they are created. It may change
+// their config, or reject them by returning a *Rejection. Any other error
+// fails the creation.
+type CreateHook interface {
+	Review(request *CreateRequest) error
+}
+
+// CreateHookFunc makes a CreateHook of a function.
+type CreateHookFunc func(request *CreateRequest) error
+
+func (f CreateHookFunc) Review(request *CreateRequest) error {
+	return f(request)
+}
+
+// A Rejection is returned by the hooks refusing a container.
+type Rejection struct {
+	Reason string
+}
+
+func (r *Rejection) Error() string {
+	return r.Reason
+}
+
+// reviewCreate runs the hooks on the container about to be created, and writes
+// the error if one of them fails or if the container refers to another
+// namespace.
+func (c *context) reviewCreate(w http.ResponseWriter, r *http.Request, config *dockerclient.ContainerConfig, name string) bool {
+	env, err := identityOf(r).claim(config.Env)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	config.Env = env
+
+	request := &CreateRequest{Name: name, Config: config}
+	if id := identityOf(r); id != nil {
+		request.Identity = id.Name
+	}
+
+	for _, hook := range c.hooks {
+		if err := hook.Review(request); err != nil {
+			if _, ok := err.(*Rejection); ok {
+				httpError(w, fmt.Sprintf("Container %s rejected: %v", name, err), http.StatusForbidden)
+			} else {
+				httpError(w, err.Error(), http.StatusInternalServerError)
+			}
+			return false
+		}
+	}
+	// The namespace can't be changed by the hooks.
+	if env, err = identityOf(r).claim(config.Env); err != nil {
+		httpError(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	config.Env = env
+	if err := c.checkReferences(identityOf(r), config); err != nil {
+		httpError(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// reviewStart reviews the HostConfig the engines before 1.10 take when
+// starting a container, as if the container were created with it, and
+// replaces the body of `r` with the reviewed one.
+func (c *context) reviewStart(w http.ResponseWriter, r *http.Request, container *cluster.Container) bool {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if body := strings.TrimSpace(string(data)); body != "" && body != "null" {
+		hostConfig := dockerclient.HostConfig{}
+		if err := json.Unmarshal(data, &hostConfig); err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return false
+		}
+		config := containerConfig(container)
+		config.HostConfig = hostConfig
+		if !c.reviewCreate(w, r, config, containerName(container)) {
+			return false
+		}
+		if data, err = json.Marshal(&config.HostConfig); err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+	}
+	setBody(r, data)
+	return true
+}
+
+// reviewExec reviews the privileged execs as if the container were created
+// privileged. The hooks can't change the exec.
+func (c *context) reviewExec(w http.ResponseWriter, r *http.Request, container *cluster.Container) bool {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	setBody(r, data)
+
+	exec := struct {
+		Privileged bool
+	}{}
+	if err := json.Unmarshal(data, &exec); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if !exec.Privileged {
+		return true
+	}
+	config := containerConfig(container)
+	if container.Info.HostConfig != nil {
+		config.HostConfig = *container.Info.HostConfig
+	}
+	config.HostConfig.Privileged = true
+	return c.reviewCreate(w, r, config, containerName(container))
+}
+
+// containerConfig returns a copy of the config of `container`.
+func containerConfig(container *cluster.Container) *dockerclient.ContainerConfig {
+	config := &dockerclient.ContainerConfig{}
+	if container.Info.Config != nil {
+		*config = *container.Info.Config
+		config.Env = append([]string{}, config.Env...)
+	}
+	return config
+}
+
+func containerName(container *cluster.Container) string {
+	if len(container.Names) > 0 {
+		return strings.TrimPrefix(container.Names[0], "/")
+	}
+	return strings.TrimPrefix(container.Info.Name, "/")
+}
+
+// setBody replaces the body of `r` with `data`.
+func setBody(r *http.Request, data []byte) {
+	r.Body = ioutil.NopCloser(bytes.NewReader(data))
+	r.ContentLength = int64(len(data))
+}
+
+// DenyPrivileged rejects the privileged containers.
+var DenyPrivileged = CreateHookFunc(func(request *CreateRequest) error {
+	if request.Config.HostConfig.Privileged {
+		return &Rejection{Reason: "privileged containers are not allowed"}
+	}
+	return nil
+})
+
+// A Webhook reviews the containers through an external HTTP service. The
+// CreateRequest is POSTed as JSON to its URL, which answers with
+// {"Allowed": <bool>, "Reason": <string>, "Config": <config>}: the container
+// is rejected for Reason unless allowed, and created with Config if set.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook returns a webhook POSTing to `url`.
+func NewWebhook(url string) *Webhook {
+	return &Webhook{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+type webhookResponse struct {
+	Allowed bool
+	Reason  string
+	Config  *dockerclient.ContainerConfig
+}
+
+func (h *Webhook) Review(request *CreateRequest) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("webhook %s: %v", h.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook %s: %s", h.url, resp.Status)
+	}
+
+	review := &webhookResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(review); err != nil {
+		return fmt.Errorf("webhook %s: %v", h.url, err)
+	}
+	if !review.Allowed {
+		if review.Reason == "" {
+			review.Reason = "rejected by " + h.url
+		}
+		return &Rejection{Reason: review.Reason}
+	}
+	if review.Config != nil {
+		*request.Config = *review.Config
+	}
+	return nil
+}
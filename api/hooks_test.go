@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/samalba/dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := &CreateRequest{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(request))
+		switch request.Name {
+		case "unlimited":
+			request.Config.Memory = 512 * 1024 * 1024
+			json.NewEncoder(w).Encode(&webhookResponse{Allowed: true, Config: request.Config})
+		case "forbidden":
+			json.NewEncoder(w).Encode(&webhookResponse{Reason: "not on this cluster"})
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			json.NewEncoder(w).Encode(&webhookResponse{Allowed: true})
+		}
+	}))
+	defer server.Close()
+	hook := NewWebhook(server.URL)
+
+	config := &dockerclient.ContainerConfig{Image: "busybox"}
+	assert.NoError(t, hook.Review(&CreateRequest{Name: "unlimited", Config: config}))
+	assert.Equal(t, config.Image, "busybox")
+	assert.Equal(t, config.Memory, int64(512*1024*1024))
+
+	config = &dockerclient.ContainerConfig{Image: "busybox"}
+	assert.NoError(t, hook.Review(&CreateRequest{Name: "other", Config: config}))
+	assert.Equal(t, config.Memory, int64(0))
+
+	err := hook.Review(&CreateRequest{Name: "forbidden", Config: config})
+	assert.Equal(t, err, &Rejection{Reason: "not on this cluster"})
+
+	err = hook.Review(&CreateRequest{Name: "broken", Config: config})
+	assert.EqualError(t, err, "webhook "+server.URL+": 500 Internal Server Error")
+}
+
+func TestCreateHooks(t *testing.T) {
+	hooks := []CreateHook{DenyPrivileged, CreateHookFunc(func(request *CreateRequest) error {
+		if request.Name == "broken" {
+			return errors.New("unavailable")
+		}
+		request.Config.Env = append(request.Config.Env, "REVIEWED_FOR="+request.Identity)
+		return nil
+	})}
+
+	access, err := NewAccessControl([]*Identity{{Name: "ci", Token: "ci-token", Role: RoleDeploy}})
+	assert.NoError(t, err)
+	c := &namespacedCluster{}
+	newAccessRequest := func(t *testing.T, c cluster.Cluster, access *AccessControl, method, url, token, body string) *httptest.ResponseRecorder {
+		return newContextRequest(t, &context{cluster: c, access: access, hooks: hooks}, method, url, token, body)
+	}
+
+	r := newAccessRequest(t, c, access, "POST", "/containers/create?name=app", "ci-token", `{"Image":"busybox"}`)
+	assert.Equal(t, r.Code, http.StatusCreated)
+	assert.Equal(t, c.created.Env, []string{"REVIEWED_FOR=ci"})
+
+	r = newAccessRequest(t, c, access, "POST", "/containers/create", "ci-token", `{"Image":"busybox","HostConfig":{"Privileged":true}}`)
+	assert.Equal(t, r.Code, http.StatusForbidden)
+	assert.Contains(t, r.Body.String(), "privileged containers are not allowed")
+
+	r = newAccessRequest(t, c, access, "POST", "/containers/create?name=broken", "ci-token", `{"Image":"busybox"}`)
+	assert.Equal(t, r.Code, http.StatusInternalServerError)
+
+	// So are the containers of a deploy.
+	r = newAccessRequest(t, c, access, "POST", "/containers/deploy", "ci-token", `{"Containers":[{"Name":"db","Config":{"HostConfig":{"Privileged":true}}}]}`)
+	assert.Equal(t, r.Code, http.StatusForbidden)
+
+	// And those of a dry run.
+	r = newAccessRequest(t, c, access, "POST", "/containers/place-dryrun", "ci-token", `{"Image":"busybox","HostConfig":{"Privileged":true}}`)
+	assert.Equal(t, r.Code, http.StatusForbidden)
+
+	// And the HostConfig given when starting a container, or a privileged
+	// exec.
+	r = newAccessRequest(t, c, access, "POST", "/containers/team-a/start", "ci-token", `{"Privileged":true}`)
+	assert.Equal(t, r.Code, http.StatusForbidden)
+	assert.Contains(t, r.Body.String(), "privileged containers are not allowed")
+	r = newAccessRequest(t, c, access, "POST", "/containers/team-a/exec", "ci-token", `{"Cmd":["sh"],"Privileged":true}`)
+	assert.Equal(t, r.Code, http.StatusForbidden)
+
+	// The hooks are those of the context only.
+	r = newContextRequest(t, &context{cluster: c, access: access}, "POST", "/containers/create", "ci-token", `{"Image":"busybox","HostConfig":{"Privileged":true}}`)
+	assert.Equal(t, r.Code, http.StatusCreated)
+}
+
+func TestCreateHooksKeepNamespace(t *testing.T) {
+	hooks := []CreateHook{CreateHookFunc(func(request *CreateRequest) error {
+		request.Config.Env = []string{"REVIEWED=1"}
+		return nil
+	})}
+	access, err := NewAccessControl([]*Identity{{Name: "team-a", Token: "a-token", Role: RoleDeploy, Namespace: "team-a"}})
+	assert.NoError(t, err)
+	c := &namespacedCluster{}
+
+	// The namespace dropped by a hook is put back.
+	r := newContextRequest(t, &context{cluster: c, access: access, hooks: hooks}, "POST", "/containers/create?name=app", "a-token", `{"Image":"busybox"}`)
+	assert.Equal(t, r.Code, http.StatusCreated)
+	assert.Equal(t, c.created.Env, []string{"REVIEWED=1", namespaceEnv + "team-a"})
+}
+
+func TestReviewStart(t *testing.T) {
+	c := &context{hooks: []CreateHook{CreateHookFunc(func(request *CreateRequest) error {
+		request.Config.HostConfig.Dns = []string{"10.0.0.53"}
+		return nil
+	})}}
+	container := &cluster.Container{
+		Container: dockerclient.Container{Id: "app_id", Names: []string{"/app"}},
+		Info:      dockerclient.ContainerInfo{Config: &dockerclient.ContainerConfig{Image: "busybox"}},
+	}
+
+	// The engine gets the reviewed HostConfig.
+	req, err := http.NewRequest("POST", "/containers/app/start", strings.NewReader(`{"PublishAllPorts":true}`))
+	assert.NoError(t, err)
+	assert.True(t, c.reviewStart(httptest.NewRecorder(), req, container))
+	hostConfig := dockerclient.HostConfig{}
+	assert.NoError(t, json.NewDecoder(req.Body).Decode(&hostConfig))
+	assert.True(t, hostConfig.PublishAllPorts)
+	assert.Equal(t, hostConfig.Dns, []string{"10.0.0.53"})
+
+	// Nothing to review without one.
+	req, err = http.NewRequest("POST", "/containers/app/start", strings.NewReader(""))
+	assert.NoError(t, err)
+	assert.True(t, c.reviewStart(httptest.NewRecorder(), req, container))
+	assert.Equal(t, req.ContentLength, int64(0))
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/swarm/metrics"
+)
+
+var (
+	requests       = metrics.NewCounter("swarm_api_requests_total", "API requests served, by route and status code.", "method", "route", "code")
+	requestLatency = metrics.NewHistogram("swarm_api_request_seconds", "Time spent serving the API requests.", metrics.DefaultBuckets, "method", "route")
+)
+
+// statusWriter records the status code of a response, passing through the
+// optional interfaces of the underlying writer.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return nil
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can't be hijacked")
+	}
+	w.code = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// instrument records the metrics of the requests served by `handler` for
+// `route`.
+func instrument(method, route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		handler(sw, r)
+		requests.Inc(method, route, strconv.Itoa(sw.code))
+		requestLatency.Observe(time.Since(start).Seconds(), method, route)
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/docker/swarm/ca"
 	"github.com/docker/swarm/cluster"
+	"github.com/docker/swarm/scheduler"
 )
 
 const DefaultDockerPort = ":2375"
@@ -28,11 +30,24 @@ func newListener(proto, addr string, tlsConfig *tls.Config) (net.Listener, error
 	return l, nil
 }
 
-func ListenAndServe(c cluster.Cluster, hosts []string, enableCors bool, tlsConfig *tls.Config, eventsHandler *eventsHandler) error {
+// ListenAndServe serves the API on `hosts`. If `elector` isn't nil, the
+// requests are forwarded to the primary manager while this one is a replica.
+// If `authority` isn't nil, it signs the certificates of the nodes, and the
+// clients must present one. If `access` isn't nil, the clients must be
+// authenticated by it, and are restricted to what their role allows. If
+// `reloader` isn't nil, the admins can reload the configuration of the
+// manager. The `hooks` review the containers before they are created.
+func ListenAndServe(c cluster.Cluster, hosts []string, enableCors bool, tlsConfig *tls.Config, eventsHandler *eventsHandler, elector Elector, authority *ca.Authority, audit *scheduler.AuditLog, access *AccessControl, reloader Reloader, hooks []CreateHook) error {
 	context := &context{
 		cluster:       c,
 		eventsHandler: eventsHandler,
 		tlsConfig:     tlsConfig,
+		elector:       elector,
+		authority:     authority,
+		audit:         audit,
+		access:        access,
+		reloader:      reloader,
+		hooks:         hooks,
 	}
 	r := createRouter(context, enableCors)
 	chErrors := make(chan error, len(hosts))
@@ -0,0 +1,269 @@
+// Package ca implements the certificate authority built in the managers,
+// issuing short lived certificates to the managers, agents and engines of a
+// cluster.
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	certFile = "ca.pem"
+	keyFile  = "ca-key.pem"
+
+	// Lifetime of the CA itself.
+	caLifetime = 10 * 365 * 24 * time.Hour
+)
+
+// Organizational units the CA sets itself in the certificates it issues,
+// whatever the requests ask for.
+const (
+	// Certificates of the nodes and clients presenting the cluster token.
+	NodeUnit = "swarm node"
+	// Certificates of the managers, issued by the CA of the manager itself.
+	ManagerUnit = "swarm manager"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// An Authority signs the certificate requests of the nodes presenting the
+// cluster token.
+type Authority struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+	token   string
+	ttl     time.Duration
+}
+
+// Load the CA stored in `dir`, creating it on the first run. The certificates
+// it issues are valid for `ttl`.
+func Load(dir, token string, ttl time.Duration) (*Authority, error) {
+	if token == "" {
+		return nil, errors.New("a token is required to issue certificates")
+	}
+	a := &Authority{token: token, ttl: ttl}
+
+	certPEM, err := ioutil.ReadFile(filepath.Join(dir, certFile))
+	if os.IsNotExist(err) {
+		return a, a.create(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(filepath.Join(dir, keyFile))
+	if err != nil {
+		return nil, err
+	}
+	return a, a.parse(certPEM, keyPEM)
+}
+
+func (a *Authority) create(dir string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "swarm CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caLifetime),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, keyFile), keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, certFile), certPEM, 0644); err != nil {
+		return err
+	}
+	return a.parse(certPEM, keyPEM)
+}
+
+func (a *Authority) parse(certPEM, keyPEM []byte) error {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return errors.New("invalid CA certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return errors.New("invalid CA key")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	a.cert, a.certPEM, a.key = cert, certPEM, key
+	return nil
+}
+
+// CertPEM returns the certificate of the CA, PEM encoded.
+func (a *Authority) CertPEM() []byte {
+	return a.certPEM
+}
+
+// Pool returns a pool trusting only the CA.
+func (a *Authority) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(a.cert)
+	return pool
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the CA, which the nodes pin
+// to get their first certificate.
+func (a *Authority) Fingerprint() string {
+	return fingerprint(a.cert)
+}
+
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Sign issues a certificate for the PEM encoded `csr` of the node at `host`,
+// the address it connects from, if `token` is the one of the cluster. Only
+// the key of the request is used: the certificate is issued to `host`, valid
+// on `host`, usable both as a client and as a server, and in the NodeUnit.
+func (a *Authority) Sign(csr []byte, token, host string) ([]byte, error) {
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		return nil, ErrInvalidToken
+	}
+	if host == "" {
+		return nil, errors.New("unknown address of the node")
+	}
+	return a.sign(csr, pkix.Name{CommonName: host, OrganizationalUnit: []string{NodeUnit}}, []string{host})
+}
+
+// SignManager issues the certificate of the manager owning the CA, valid on
+// `hosts` and in the ManagerUnit, for the PEM encoded `csr`.
+func (a *Authority) SignManager(csr []byte, hosts []string) ([]byte, error) {
+	return a.sign(csr, pkix.Name{CommonName: ManagerUnit, OrganizationalUnit: []string{ManagerUnit}}, hosts)
+}
+
+func (a *Authority) sign(csr []byte, subject pkix.Name, hosts []string) ([]byte, error) {
+	block, _ := pem.Decode(csr)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("invalid certificate request")
+	}
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := request.CheckSignature(); err != nil {
+		return nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-5 * time.Minute),
+		NotAfter:     time.Now().Add(a.ttl),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, request.PublicKey, a.key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// IssuedToNode returns true if `cert` was issued by Sign to a node presenting
+// the cluster token: its common name is the address of the node, not a name
+// the operator of the cluster chose.
+func IssuedToNode(cert *x509.Certificate) bool {
+	for _, unit := range cert.Subject.OrganizationalUnit {
+		if unit == NodeUnit {
+			return true
+		}
+	}
+	return false
+}
+
+// NewKeyAndCSR generates a private key and a certificate request for
+// `commonName`, valid for `hosts` (IP addresses or DNS names), both PEM
+// encoded.
+func NewKeyAndCSR(commonName string, hosts []string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}), nil
+}
+
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate a serial number: %v", err)
+	}
+	return serial, nil
+}
@@ -0,0 +1,168 @@
+package ca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAuthority(t *testing.T) (*Authority, string) {
+	dir, err := ioutil.TempDir("", "swarm-ca")
+	assert.NoError(t, err)
+	a, err := Load(dir, "secret", time.Hour)
+	assert.NoError(t, err)
+	return a, dir
+}
+
+func parseCert(t *testing.T, certPEM []byte) *x509.Certificate {
+	block, _ := pem.Decode(certPEM)
+	assert.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	return cert
+}
+
+func TestLoad(t *testing.T) {
+	a, dir := newTestAuthority(t)
+	defer os.RemoveAll(dir)
+
+	// The CA is created once and then reloaded.
+	b, err := Load(dir, "secret", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, a.CertPEM(), b.CertPEM())
+
+	_, err = Load(dir, "", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestSign(t *testing.T) {
+	a, dir := newTestAuthority(t)
+	defer os.RemoveAll(dir)
+
+	_, csr, err := NewKeyAndCSR("node-1", []string{"192.168.0.42", "node-1.example.com"})
+	assert.NoError(t, err)
+
+	_, err = a.Sign(csr, "wrong", "192.168.0.42")
+	assert.Equal(t, err, ErrInvalidToken)
+	_, err = a.Sign([]byte("garbage"), "secret", "192.168.0.42")
+	assert.Error(t, err)
+	_, err = a.Sign(csr, "secret", "")
+	assert.Error(t, err)
+
+	certPEM, err := a.Sign(csr, "secret", "192.168.0.42")
+	assert.NoError(t, err)
+	cert := parseCert(t, certPEM)
+	assert.True(t, cert.NotAfter.Before(time.Now().Add(time.Hour+time.Minute)))
+
+	// Issued to the address of the node, whatever the request asks for.
+	assert.Equal(t, cert.Subject.CommonName, "192.168.0.42")
+	assert.Equal(t, cert.Subject.OrganizationalUnit, []string{NodeUnit})
+	assert.True(t, IssuedToNode(cert))
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		_, err = cert.Verify(x509.VerifyOptions{Roots: a.Pool(), DNSName: "192.168.0.42", KeyUsages: []x509.ExtKeyUsage{usage}})
+		assert.NoError(t, err)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{Roots: a.Pool(), DNSName: "node-1.example.com"})
+	assert.Error(t, err)
+
+	certPEM, err = a.SignManager(csr, []string{"localhost"})
+	assert.NoError(t, err)
+	cert = parseCert(t, certPEM)
+	assert.Equal(t, cert.Subject.CommonName, ManagerUnit)
+	assert.False(t, IssuedToNode(cert))
+	_, err = cert.Verify(x509.VerifyOptions{Roots: a.Pool(), DNSName: "localhost"})
+	assert.NoError(t, err)
+}
+
+func TestRenewer(t *testing.T) {
+	a, dir := newTestAuthority(t)
+	defer os.RemoveAll(dir)
+
+	issued := 0
+	r, err := NewRenewer(func() ([]byte, []byte, error) {
+		issued++
+		keyPEM, csr, err := NewKeyAndCSR("manager", []string{"localhost"})
+		if err != nil {
+			return nil, nil, err
+		}
+		certPEM, err := a.SignManager(csr, []string{"localhost"})
+		return certPEM, keyPEM, err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, issued, 1)
+	assert.NotNil(t, r.Certificate())
+
+	// Renewed after 40 minutes of its hour of validity.
+	until := r.untilRenewal()
+	assert.True(t, until > 30*time.Minute && until < 40*time.Minute, until.String())
+
+	first := r.Certificate()
+	assert.NoError(t, r.renew())
+	assert.Equal(t, issued, 2)
+	assert.NotEqual(t, r.Certificate(), first)
+
+	config := r.TLSConfig(a.Pool())
+	cert, err := config.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, cert, r.Certificate())
+}
+
+func TestFetch(t *testing.T) {
+	a, dir := newTestAuthority(t)
+	defer os.RemoveAll(dir)
+
+	// A manager presenting a certificate of the CA, and the CA.
+	keyPEM, csr, err := NewKeyAndCSR("", nil)
+	assert.NoError(t, err)
+	certPEM, err := a.SignManager(csr, []string{"127.0.0.1"})
+	assert.NoError(t, err)
+	managerCert, err := tls.X509KeyPair(append(certPEM, a.CertPEM()...), keyPEM)
+	assert.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/ca/sign")
+		var req SignRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		cert, err := a.Sign([]byte(req.CSR), req.Token, "192.168.0.42")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(&SignResponse{Certificate: string(cert), CA: string(a.CertPEM())})
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{managerCert}}
+	server.StartTLS()
+	defer server.Close()
+
+	certPEM, keyPEM, caPEM, err := Fetch(server.URL, "secret", a.Pool(), "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, keyPEM)
+	assert.Equal(t, caPEM, a.CertPEM())
+	assert.Equal(t, parseCert(t, certPEM).Subject.CommonName, "192.168.0.42")
+
+	_, _, _, err = Fetch(server.URL, "wrong", a.Pool(), "")
+	assert.EqualError(t, err, "certificate request refused: invalid token")
+
+	// Or with the fingerprint of the CA.
+	_, _, _, err = Fetch(server.URL, "secret", nil, a.Fingerprint())
+	assert.NoError(t, err)
+
+	// The token isn't sent to unknown managers.
+	_, _, _, err = Fetch(server.URL, "secret", nil, "")
+	assert.Equal(t, err, ErrUntrustedManager)
+	other, otherDir := newTestAuthority(t)
+	defer os.RemoveAll(otherDir)
+	_, _, _, err = Fetch(server.URL, "secret", other.Pool(), "")
+	assert.Error(t, err)
+	_, _, _, err = Fetch(server.URL, "secret", nil, other.Fingerprint())
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SignRequest is the body of the signing requests sent to the managers.
+type SignRequest struct {
+	CSR   string
+	Token string
+}
+
+// SignResponse is the answer of the managers to a SignRequest.
+type SignResponse struct {
+	Certificate string
+	CA          string
+}
+
+// ErrUntrustedManager is returned when the manager to get a certificate from
+// can't be verified: the token is never sent to an unknown manager.
+var ErrUntrustedManager = errors.New("the CA of the manager must be given, or its fingerprint")
+
+// Fetch asks the manager at `managerURL` for a certificate, returning it
+// along with its key and the CA. The manager must have a certificate signed
+// by a CA of `pool` or, if `pool` is nil, by the CA of fingerprint
+// `fingerprint` it presents.
+func Fetch(managerURL, token string, pool *x509.CertPool, fingerprint string) (certPEM, keyPEM, caPEM []byte, err error) {
+	if pool == nil && fingerprint == "" {
+		return nil, nil, nil, ErrUntrustedManager
+	}
+	// The names are set by the manager.
+	keyPEM, csr, err := NewKeyAndCSR("", nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	body, err := json.Marshal(&SignRequest{CSR: string(csr), Token: token})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	config := &tls.Config{RootCAs: pool}
+	if pool == nil {
+		// Verified against the pinned CA instead of the system roots.
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = pinned(fingerprint)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}, Timeout: 30 * time.Second}
+	resp, err := client.Post(strings.TrimSuffix(managerURL, "/")+"/ca/sign", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, nil, nil, fmt.Errorf("certificate request refused: %s", strings.TrimSpace(string(msg)))
+	}
+
+	signed := &SignResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(signed); err != nil {
+		return nil, nil, nil, err
+	}
+	if signed.Certificate == "" || signed.CA == "" {
+		return nil, nil, nil, errors.New("incomplete certificate response")
+	}
+	return []byte(signed.Certificate), keyPEM, []byte(signed.CA), nil
+}
+
+// pinned verifies that the chain of the manager holds the CA of fingerprint
+// `fingerprint`, and that the CA signed its certificate.
+func pinned(fp string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		certs := []*x509.Certificate{}
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs = append(certs, cert)
+		}
+		for _, cert := range certs {
+			if fingerprint(cert) != fp {
+				continue
+			}
+			pool := x509.NewCertPool()
+			pool.AddCert(cert)
+			_, err := certs[0].Verify(x509.VerifyOptions{Roots: pool})
+			return err
+		}
+		return fmt.Errorf("the manager doesn't present the CA %s", fp)
+	}
+}
@@ -0,0 +1,101 @@
+package ca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Delay before retrying a failed renewal.
+const retryDelay = time.Minute
+
+// An IssueFunc returns a new certificate and its private key, PEM encoded.
+type IssueFunc func() (certPEM, keyPEM []byte, err error)
+
+// A Renewer keeps a certificate valid, replacing it once two thirds of its
+// lifetime have elapsed.
+type Renewer struct {
+	sync.RWMutex
+
+	issue IssueFunc
+	cert  *tls.Certificate
+	leaf  *x509.Certificate
+}
+
+// NewRenewer returns a renewer holding a first certificate from `issue`.
+func NewRenewer(issue IssueFunc) (*Renewer, error) {
+	r := &Renewer{issue: issue}
+	if err := r.renew(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Run renews the certificate forever.
+func (r *Renewer) Run() {
+	for {
+		time.Sleep(r.untilRenewal())
+		if err := r.renew(); err != nil {
+			log.WithField("name", "ca").Errorf("Certificate renewal failed: %v", err)
+			time.Sleep(retryDelay)
+		}
+	}
+}
+
+func (r *Renewer) untilRenewal() time.Duration {
+	r.RLock()
+	defer r.RUnlock()
+
+	lifetime := r.leaf.NotAfter.Sub(r.leaf.NotBefore)
+	return r.leaf.NotBefore.Add(lifetime * 2 / 3).Sub(time.Now())
+}
+
+func (r *Renewer) renew() error {
+	certPEM, keyPEM, err := r.issue()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.cert, r.leaf = &cert, leaf
+	log.WithFields(log.Fields{"name": "ca", "expires": leaf.NotAfter}).Debug("Certificate renewed")
+	return nil
+}
+
+// Certificate returns the current certificate.
+func (r *Renewer) Certificate() *tls.Certificate {
+	r.RLock()
+	defer r.RUnlock()
+	return r.cert
+}
+
+// TLSConfig returns a configuration presenting the current certificate, both
+// as a client and as a server, and trusting only the certificates signed by
+// `pool`. Clients without a certificate are accepted, it's up to the server to
+// reject them where needed.
+func (r *Renewer) TLSConfig(pool *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.Certificate(), nil
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.Certificate(), nil
+		},
+		RootCAs:    pool,
+		ClientCAs:  pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		MinVersion: tls.VersionTLS10,
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/docker/swarm/ca"
+)
+
+// fetchCertificates gets a certificate from the built-in CA of the manager
+// `manager`, and writes it to `dir` with its key and the CA the way Docker
+// expects them. The manager is verified against the CA of --tlscacert or, the
+// first time, against the CA of fingerprint --tls-auto-ca-fingerprint, which
+// is trusted from then on.
+func fetchCertificates(c *cli.Context, manager string) ca.IssueFunc {
+	var (
+		mu          sync.Mutex
+		pool        *x509.CertPool
+		url         = "https://" + strings.TrimPrefix(manager, "tcp://")
+		token       = c.String("tls-auto-ca-token")
+		fingerprint = c.String("tls-auto-ca-fingerprint")
+		dir         = c.String("tls-cert-dir")
+	)
+	if file := c.String("tlscacert"); file != "" {
+		caPEM, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			log.Fatalf("no certificate found in %s", file)
+		}
+	}
+
+	return func() ([]byte, []byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		certPEM, keyPEM, caPEM, err := ca.Fetch(url, token, pool, fingerprint)
+		if err != nil {
+			return nil, nil, err
+		}
+		if pool == nil {
+			pool = x509.NewCertPool()
+			pool.AppendCertsFromPEM(caPEM)
+		}
+
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, nil, err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0600); err != nil {
+			return nil, nil, err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "cert.pem"), certPEM, 0644); err != nil {
+			return nil, nil, err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "ca.pem"), caPEM, 0644); err != nil {
+			return nil, nil, err
+		}
+		log.WithField("dir", dir).Info("Certificate written")
+		return certPEM, keyPEM, nil
+	}
+}
+
+// Keep the certificate of the engine valid.
+func renewEngineCertificate(c *cli.Context) {
+	// The certificate is issued to the address the node connects from.
+	renewer, err := ca.NewRenewer(fetchCertificates(c, c.String("tls-auto-ca-manager")))
+	if err != nil {
+		log.Fatal(err)
+	}
+	go renewer.Run()
+}
+
+func cert(c *cli.Context) {
+	if _, _, err := fetchCertificates(c, c.String("host"))(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Set up mutual TLS with a certificate issued by the built-in CA for the
+// manager reachable on `hosts`, and renewed as needed.
+func autoCaTlsConfig(c *cli.Context, hosts []string) (*ca.Authority, *ca.Renewer) {
+	ttl := time.Duration(c.Int("tls-cert-ttl")) * time.Hour
+	authority, err := ca.Load(filepath.Join(c.String("rootdir"), "ca"), c.String("tls-auto-ca-token"), ttl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.WithField("fingerprint", authority.Fingerprint()).Info("Built-in CA loaded, pass --tls-auto-ca-fingerprint=<fingerprint> to the nodes")
+
+	names := []string{"localhost", "127.0.0.1"}
+	if hostname, err := os.Hostname(); err == nil {
+		names = append(names, hostname)
+	}
+	for _, host := range append(hosts, c.String("advertise")) {
+		if parts := strings.SplitN(host, "://", 2); len(parts) == 2 {
+			host = parts[1]
+		}
+		if h, _, err := net.SplitHostPort(host); err == nil && h != "" && h != "0.0.0.0" {
+			names = append(names, h)
+		}
+	}
+
+	renewer, err := ca.NewRenewer(func() ([]byte, []byte, error) {
+		keyPEM, csr, err := ca.NewKeyAndCSR("swarm manager", names)
+		if err != nil {
+			return nil, nil, err
+		}
+		certPEM, err := authority.SignManager(csr, names)
+		// The CA is part of the chain, for the nodes pinning its fingerprint.
+		return append(certPEM, authority.CertPEM()...), keyPEM, err
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	go renewer.Run()
+	return authority, renewer
+}
@@ -1,15 +1,65 @@
 package cluster
 
-import "github.com/samalba/dockerclient"
+import (
+	"errors"
+
+	"github.com/samalba/dockerclient"
+)
+
+var ErrNodeNotFound = errors.New("node not found")
+
+// What becomes of the containers of a drained node.
+const (
+	DrainKeep       = ""
+	DrainStop       = "stop"
+	DrainReschedule = "reschedule"
+)
 
 type Cluster interface {
 	CreateContainer(config *dockerclient.ContainerConfig, name string) (*Container, error)
 	RemoveContainer(container *Container, force bool) error
+	// RemoveGlobalContainer removes all the instances of the global container
+	// `container` is one of, including the ones of the nodes gone.
+	RemoveGlobalContainer(container *Container, force bool) error
+	// PlaceDryRun returns how the container would be scheduled, without
+	// creating it. Only the swarm cluster implements the interface in this
+	// tree: there is no mesos cluster to support it too.
+	PlaceDryRun(config *dockerclient.ContainerConfig, name string) *Decision
+
+	// Deploy creates, and starts if asked to, the containers in the order of
+	// their dependencies. If one of them fails, the ones already created are
+	// removed.
+	Deploy(specs []*ContainerSpec) ([]*Container, error)
 
 	Images() []*Image
 	Image(IdOrName string) *Image
 	Containers() []*Container
 	Container(IdOrName string) *Container
 
+	Nodes() []Node
+
+	Volumes() []*Volume
+	Volume(name string) *Volume
+	// CreateVolume creates the volume on the node prefixing its name, as in
+	// `<node>/<name>`, or else on all the healthy nodes.
+	CreateVolume(request *VolumeCreateRequest) ([]*Volume, error)
+
+	Networks() []*Network
+	Network(IdOrName string) *Network
+	// CreateNetwork creates the network on the node prefixing its name, as in
+	// `<node>/<name>`, once for the overlay networks, or else on all the
+	// healthy nodes.
+	CreateNetwork(request *NetworkCreateRequest) ([]*Network, error)
+
+	// Pull the image `name` in parallel on the healthy nodes satisfying the
+	// `constraints`, all of them if none, with the encoded registry
+	// `authConfig` if not empty. `callback` gets the progress of each node.
+	Pull(name string, authConfig string, constraints []string, callback func(node Node, progress *PullProgress)) ([]*PullResult, error)
+
+	// DrainNode stops scheduling containers on the node, and keeps, stops or
+	// reschedules the ones it runs. ActivateNode brings it back.
+	DrainNode(IdOrName string, containers string) error
+	ActivateNode(IdOrName string) error
+
 	Info() [][2]string
 }
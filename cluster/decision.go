@@ -0,0 +1,30 @@
+package cluster
+
+import "time"
+
+// A Decision records how the nodes of a container were selected.
+type Decision struct {
+	Time       time.Time
+	Name       string
+	Image      string
+	Global     bool `json:",omitempty"`
+	Considered []string
+	Rejected   []Rejection
+	Strategy   string      `json:",omitempty"`
+	Scores     []NodeScore `json:",omitempty"`
+	Selected   []string
+	Error      string `json:",omitempty"`
+}
+
+// A Rejection records the nodes ruled out by a filter.
+type Rejection struct {
+	Filter string
+	Nodes  []string
+	Reason string
+}
+
+// A NodeScore is the score given to a node by the strategy.
+type NodeScore struct {
+	Node  string
+	Score float64
+}
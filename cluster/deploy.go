@@ -0,0 +1,97 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/samalba/dockerclient"
+)
+
+var (
+	ErrDuplicateName   = errors.New("several containers of the deploy have the same name")
+	ErrDependencyCycle = errors.New("the containers of the deploy depend on each other")
+)
+
+// ContainerSpec is a container of a deploy, started once created if Start is
+// true.
+type ContainerSpec struct {
+	Name   string
+	Config *dockerclient.ContainerConfig
+	Start  bool
+}
+
+// NameConflictError is returned when the name of a new container is taken.
+type NameConflictError struct {
+	Name string
+}
+
+func (e *NameConflictError) Error() string {
+	return fmt.Sprintf("Conflict, the name %s is already in use", e.Name)
+}
+
+// OrderSpecs sorts the containers of a deploy so that each comes after the
+// containers of the deploy it depends on, through links, shared volumes or
+// network stacks and container affinities. The order is kept otherwise.
+func OrderSpecs(specs []*ContainerSpec) ([]*ContainerSpec, error) {
+	byName := make(map[string]*ContainerSpec)
+	for _, spec := range specs {
+		if spec.Name == "" {
+			continue
+		}
+		if _, exists := byName[spec.Name]; exists {
+			return nil, ErrDuplicateName
+		}
+		byName[spec.Name] = spec
+	}
+
+	var (
+		ordered = []*ContainerSpec{}
+		placed  = make(map[*ContainerSpec]bool)
+	)
+	for len(ordered) < len(specs) {
+		progress := false
+		for _, spec := range specs {
+			if placed[spec] || !dependenciesPlaced(spec, byName, placed) {
+				continue
+			}
+			ordered = append(ordered, spec)
+			placed[spec] = true
+			progress = true
+		}
+		if !progress {
+			return nil, ErrDependencyCycle
+		}
+	}
+	return ordered, nil
+}
+
+func dependenciesPlaced(spec *ContainerSpec, byName map[string]*ContainerSpec, placed map[*ContainerSpec]bool) bool {
+	for _, name := range Dependencies(spec.Config) {
+		if dependency, ok := byName[name]; ok && !placed[dependency] {
+			return false
+		}
+	}
+	return true
+}
+
+// Dependencies returns the names of the containers `config` refers to,
+// through its links, its volumes, its network or an affinity.
+func Dependencies(config *dockerclient.ContainerConfig) []string {
+	names := []string{}
+	for _, link := range config.HostConfig.Links {
+		names = append(names, strings.TrimPrefix(strings.SplitN(link, ":", 2)[0], "/"))
+	}
+	for _, volumes := range config.HostConfig.VolumesFrom {
+		names = append(names, strings.SplitN(volumes, ":", 2)[0])
+	}
+	if strings.HasPrefix(config.HostConfig.NetworkMode, "container:") {
+		names = append(names, strings.TrimPrefix(config.HostConfig.NetworkMode, "container:"))
+	}
+	for _, env := range config.Env {
+		if strings.HasPrefix(env, "affinity:container==") {
+			names = append(names, strings.TrimPrefix(strings.TrimPrefix(env, "affinity:container=="), "~"))
+		}
+	}
+	return names
+}
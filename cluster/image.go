@@ -1,9 +1,29 @@
 package cluster
 
-import "github.com/samalba/dockerclient"
+import (
+	"encoding/json"
+
+	"github.com/samalba/dockerclient"
+)
 
 type Image struct {
 	dockerclient.Image
 
 	Node Node
 }
+
+// PullProgress is a progress message of an image pull, as streamed by the
+// Docker engine.
+type PullProgress struct {
+	ID             string          `json:"id,omitempty"`
+	Status         string          `json:"status,omitempty"`
+	Progress       string          `json:"progress,omitempty"`
+	ProgressDetail json.RawMessage `json:"progressDetail,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+// PullResult is the outcome of an image pull on a node.
+type PullResult struct {
+	Node Node
+	Err  error
+}
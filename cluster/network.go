@@ -0,0 +1,23 @@
+package cluster
+
+import "encoding/json"
+
+// Network is a network of a node, as reported by the Docker engine. Networks
+// of the global scope, such as the overlay ones, are shared by the nodes.
+type Network struct {
+	ID     string `json:"Id"`
+	Name   string
+	Driver string
+	Scope  string
+
+	Node Node `json:"-"`
+}
+
+// NetworkCreateRequest is the configuration of a new network.
+type NetworkCreateRequest struct {
+	Name           string
+	CheckDuplicate bool
+	Driver         string
+	IPAM           json.RawMessage   `json:",omitempty"`
+	Options        map[string]string `json:",omitempty"`
+}
@@ -7,17 +7,26 @@ type Node interface {
 	IP() string   //to inject the actual IP of the machine in docker ps (hostname:port or ip:port)
 	Addr() string //to know where to connect with the proxy
 
+	Version() string //used by the API, version of the Docker engine
+
 	Images() []*Image                     //used by the API
 	Image(IdOrName string) *Image         //used by the filters
 	Containers() []*Container             //used by the filters
 	Container(IdOrName string) *Container //used by the filters
+	Volumes() []*Volume                   //used by the filters
+	VolumeDrivers() []string              //used by the filters, nil if the engine doesn't report them
+	Networks() []*Network                 //used by the filters
 
 	TotalCpus() int64   //used by the strategy
 	UsedCpus() int64    //used by the strategy
 	TotalMemory() int64 //used by the strategy
 	UsedMemory() int64  //used by the strategy
 
+	CpuUsage() float64    //used by the strategy, actual usage (0 to 1) if sampled
+	MemoryUsage() float64 //used by the strategy, actual usage (0 to 1) if sampled
+
 	Labels() map[string]string //used by the filters
 
 	IsHealthy() bool
+	IsDrained() bool //used by the scheduler, drained nodes don't get new containers
 }
@@ -1,10 +1,44 @@
 package cluster
 
-import "crypto/tls"
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/docker/swarm/discovery"
+)
 
 type Options struct {
 	TLSConfig       *tls.Config
 	OvercommitRatio float64
-	Discovery       string
+	Discovery       discovery.DiscoveryService
 	Heartbeat       int
+
+	// Sample the actual usage of the nodes every StatsInterval if not 0,
+	// from cAdvisor if StatsCadvisorPort is set or from the engines.
+	StatsInterval     time.Duration
+	StatsCadvisorPort int
+
+	// Probe the nodes every HealthInterval if not 0. A node is flagged as
+	// dead after HealthFailures consecutive failed probes, and back to life
+	// after HealthSuccesses successful ones. Dead nodes are probed less and
+	// less often, down to every HealthMaxBackoff.
+	HealthInterval   time.Duration
+	HealthFailures   int
+	HealthSuccesses  int
+	HealthMaxBackoff time.Duration
+
+	// Refresh the state of at most RefreshWorkers nodes at the same time,
+	// each one about every RefreshInterval. Failing nodes are refreshed less
+	// and less often, down to every RefreshMaxBackoff.
+	RefreshWorkers    int
+	RefreshInterval   time.Duration
+	RefreshMaxBackoff time.Duration
+
+	// Evaluate at most SchedulerWorkers placements at the same time.
+	SchedulerWorkers int
+
+	// IsLeader tells whether this manager is the primary one, nil if it's the
+	// only one. Only the primary reschedules the containers and starts the
+	// global ones on the nodes joining.
+	IsLeader func() bool
 }
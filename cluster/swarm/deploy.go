@@ -0,0 +1,68 @@
+package swarm
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/swarm/cluster"
+)
+
+// Deploy creates the containers in the order of their dependencies, rolling
+// back on failure.
+func (s *SwarmCluster) Deploy(specs []*cluster.ContainerSpec) ([]*cluster.Container, error) {
+	ordered, err := cluster.OrderSpecs(specs)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, spec := range ordered {
+		// Rolling back would only remove one instance.
+		if hasEnv(spec.Config, globalScheduling) {
+			return nil, errors.New("global containers can't be deployed")
+		}
+		names = append(names, spec.Name)
+	}
+	held, err := s.reserveNames(names...)
+	if err != nil {
+		return nil, err
+	}
+	defer s.reservations.release(held...)
+
+	created := []*cluster.Container{}
+	for i, spec := range ordered {
+		container, err := s.create(spec.Config, spec.Name, held[i])
+		if err == nil {
+			created = append(created, container)
+			if spec.Start {
+				err = startContainer(container)
+			}
+		}
+		if err != nil {
+			s.rollback(created)
+			return nil, fmt.Errorf("failed to deploy %s: %v", spec.Name, err)
+		}
+	}
+	return created, nil
+}
+
+func startContainer(container *cluster.Container) error {
+	n, ok := container.Node.(*Node)
+	if !ok {
+		return nil
+	}
+	if err := n.client.StartContainer(container.Id, nil); err != nil {
+		return err
+	}
+	return n.RefreshContainer(container.Id, true)
+}
+
+// rollback removes the containers of a failed deploy, the last created first.
+func (s *SwarmCluster) rollback(containers []*cluster.Container) {
+	for i := len(containers) - 1; i >= 0; i-- {
+		if err := s.RemoveContainer(containers[i], true); err != nil {
+			log.WithField("id", containers[i].Id).Errorf("Failed to roll back the container: %v", err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package swarm
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/docker/swarm/scheduler"
+	"github.com/docker/swarm/scheduler/filter"
+	"github.com/docker/swarm/scheduler/strategy"
+	"github.com/docker/swarm/state"
+	"github.com/samalba/dockerclient"
+	"github.com/samalba/dockerclient/mockclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func expectNamedCreate(client *mockclient.MockClient, name string) {
+	id := name + "_id"
+	client.On("CreateContainer", mock.Anything, name).Return(id, nil).Once()
+	client.On("ListContainers", true, false, fmt.Sprintf(`{"id":[%q]}`, id)).Return([]dockerclient.Container{{Id: id, Names: []string{"/" + name}}}, nil).Once()
+	client.On("InspectContainer", id).Return(&dockerclient.ContainerInfo{Config: &dockerclient.ContainerConfig{}}, nil).Once()
+}
+
+func newDeployCluster(t *testing.T) (*SwarmCluster, *mockclient.MockClient, func()) {
+	dir, err := ioutil.TempDir("", "swarm-state")
+	assert.NoError(t, err)
+	store := state.NewStore(dir)
+	assert.NoError(t, store.Initialize())
+
+	random, err := strategy.New("random", nil)
+	assert.NoError(t, err)
+	s := &SwarmCluster{
+		nodes:        make(map[string]*Node),
+		reservations: newReservations(nil),
+		placers:      make(chan struct{}, defaultSchedulerWorkers),
+		scheduler:    scheduler.New(random, []filter.Filter{}),
+		store:        store,
+	}
+	node, client := connectMockNode(t, "node-1")
+	s.nodes[node.id] = node
+	return s, client, func() { os.RemoveAll(dir) }
+}
+
+func TestOrderSpecs(t *testing.T) {
+	specs := []*cluster.ContainerSpec{
+		{Name: "web", Config: &dockerclient.ContainerConfig{HostConfig: dockerclient.HostConfig{Links: []string{"/db:db"}}}},
+		{Name: "proxy", Config: &dockerclient.ContainerConfig{Env: []string{"affinity:container==web"}}},
+		{Name: "db", Config: &dockerclient.ContainerConfig{HostConfig: dockerclient.HostConfig{VolumesFrom: []string{"data:ro"}}}},
+		{Name: "data", Config: &dockerclient.ContainerConfig{HostConfig: dockerclient.HostConfig{Links: []string{"outside:alias"}}}},
+	}
+	ordered, err := cluster.OrderSpecs(specs)
+	assert.NoError(t, err)
+	names := []string{}
+	for _, spec := range ordered {
+		names = append(names, spec.Name)
+	}
+	assert.Equal(t, names, []string{"data", "db", "web", "proxy"})
+
+	specs[3].Config.HostConfig.NetworkMode = "container:proxy"
+	_, err = cluster.OrderSpecs(specs)
+	assert.Equal(t, err, cluster.ErrDependencyCycle)
+
+	_, err = cluster.OrderSpecs(append(specs, &cluster.ContainerSpec{Name: "db", Config: &dockerclient.ContainerConfig{}}))
+	assert.Equal(t, err, cluster.ErrDuplicateName)
+}
+
+func TestDeploy(t *testing.T) {
+	s, client, cleanup := newDeployCluster(t)
+	defer cleanup()
+
+	expectNamedCreate(client, "db")
+	expectNamedCreate(client, "web")
+	containers, err := s.Deploy([]*cluster.ContainerSpec{
+		{Name: "web", Config: &dockerclient.ContainerConfig{Image: "nginx", HostConfig: dockerclient.HostConfig{Links: []string{"db:db"}}}},
+		{Name: "db", Config: &dockerclient.ContainerConfig{Image: "redis"}},
+	})
+	assert.NoError(t, err)
+	client.AssertExpectations(t)
+	assert.Len(t, containers, 2)
+	assert.Equal(t, containers[0].Id, "db_id")
+	assert.Equal(t, containers[1].Id, "web_id")
+	assert.Empty(t, s.reservations.byKey)
+
+	// The names are taken now.
+	_, err = s.Deploy([]*cluster.ContainerSpec{{Name: "db", Config: &dockerclient.ContainerConfig{}}})
+	assert.EqualError(t, err, "Conflict, the name db is already in use")
+}
+
+func TestDeployRollback(t *testing.T) {
+	s, client, cleanup := newDeployCluster(t)
+	defer cleanup()
+
+	expectNamedCreate(client, "db")
+	expectNamedCreate(client, "web")
+	client.On("StartContainer", "web_id", mock.Anything).Return(errors.New("port already allocated")).Once()
+	client.On("RemoveContainer", "web_id", true, true).Return(nil).Once()
+	client.On("RemoveContainer", "db_id", true, true).Return(nil).Once()
+
+	_, err := s.Deploy([]*cluster.ContainerSpec{
+		{Name: "db", Config: &dockerclient.ContainerConfig{Image: "redis"}},
+		{Name: "web", Config: &dockerclient.ContainerConfig{Image: "nginx"}, Start: true},
+	})
+	assert.EqualError(t, err, "failed to deploy web: port already allocated")
+	client.AssertExpectations(t)
+	assert.Empty(t, s.Containers())
+	assert.Empty(t, s.reservations.byKey)
+}
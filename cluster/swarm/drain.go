@@ -0,0 +1,159 @@
+package swarm
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/swarm/cluster"
+)
+
+const (
+	// Seconds given to the containers of a drained node to stop.
+	drainStopTimeout = 10
+
+	// Bucket of the discovery service the drained nodes are persisted to.
+	drainedBucket = "drained"
+)
+
+// DrainNode takes a node out of the scheduling, then keeps, stops or
+// reschedules its containers depending on `containers`.
+func (s *SwarmCluster) DrainNode(IdOrName string, containers string) error {
+	switch containers {
+	case cluster.DrainKeep, cluster.DrainStop, cluster.DrainReschedule:
+	default:
+		return fmt.Errorf("invalid drain mode %q", containers)
+	}
+
+	// Wait for the placements in progress, none will select the node once
+	// it's drained.
+	s.Lock()
+	n := s.lookupNode(IdOrName)
+	if n != nil {
+		n.setDrained(true)
+		s.recordDrainedLocked(n.id, true)
+	}
+	s.Unlock()
+
+	if n == nil {
+		return cluster.ErrNodeNotFound
+	}
+	s.persistDrained(n.id, true)
+	// The containers already placed on the node are created outside of the
+	// lock.
+	s.reservations.waitPlaced(n.id)
+	log.WithFields(log.Fields{"name": n.name, "id": n.id}).Info("Node drained")
+	n.emitEvent("node_drain")
+
+	var errs []error
+	for _, container := range n.Containers() {
+		var err error
+		switch containers {
+		case cluster.DrainStop:
+			err = n.client.StopContainer(container.Id, drainStopTimeout)
+		case cluster.DrainReschedule:
+			// Global containers run on every node anyway.
+			if !hasEnv(container.Info.Config, globalScheduling) {
+				err = s.moveContainer(container)
+			}
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"name": n.name, "id": n.id, "container": container.Id}).Errorf("Failed to drain container: %v", err)
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d containers failed to drain, first error: %v", len(errs), errs[0])
+	}
+	return nil
+}
+
+// moveContainer reschedules `container` on another node, starts it there if
+// it was running, and removes the original.
+func (s *SwarmCluster) moveContainer(container *cluster.Container) error {
+	if _, err := s.rescheduleContainer(container); err != nil {
+		return err
+	}
+	if n, ok := container.Node.(*Node); ok {
+		return n.Destroy(container, true)
+	}
+	return nil
+}
+
+// ActivateNode brings a drained node back into the scheduling.
+func (s *SwarmCluster) ActivateNode(IdOrName string) error {
+	s.Lock()
+	n := s.lookupNode(IdOrName)
+	if n != nil {
+		n.setDrained(false)
+		s.recordDrainedLocked(n.id, false)
+	}
+	s.Unlock()
+
+	if n == nil {
+		return cluster.ErrNodeNotFound
+	}
+	s.persistDrained(n.id, false)
+	log.WithFields(log.Fields{"name": n.name, "id": n.id}).Info("Node activated")
+	n.emitEvent("node_activate")
+	return nil
+}
+
+// recordDrainedLocked keeps whether the node `id` is drained, for when it
+// reconnects. The lock must be held.
+func (s *SwarmCluster) recordDrainedLocked(id string, drained bool) {
+	if !drained {
+		delete(s.drained, id)
+		return
+	}
+	if s.drained == nil {
+		s.drained = make(map[string]bool)
+	}
+	s.drained[id] = true
+}
+
+// persistDrained keeps whether the node `id` is drained in the discovery
+// service, for when the manager restarts. The node is drained in memory
+// whether it fails or not.
+func (s *SwarmCluster) persistDrained(id string, drained bool) {
+	if s.kv == nil {
+		return
+	}
+	var err error
+	if drained {
+		err = s.kv.Put(drainedBucket, id, []byte("true"))
+	} else {
+		err = s.kv.Delete(drainedBucket, id)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"name": "swarm", "id": id}).Warnf("Failed to persist the drained node: %v", err)
+	}
+}
+
+// loadDrained reads back the nodes drained before the manager restarted.
+func (s *SwarmCluster) loadDrained() error {
+	if s.kv == nil {
+		return nil
+	}
+	values, err := s.kv.List(drainedBucket)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	for id := range values {
+		s.recordDrainedLocked(id, true)
+	}
+	return nil
+}
+
+// lookupNode returns the node with the ID, name or address `IdOrName`.
+func (s *SwarmCluster) lookupNode(IdOrName string) *Node {
+	for _, n := range s.nodes {
+		if n.id == IdOrName || n.name == IdOrName || n.addr == IdOrName {
+			return n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package swarm
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/docker/swarm/discovery/testutil"
+	"github.com/docker/swarm/scheduler"
+	"github.com/docker/swarm/scheduler/filter"
+	"github.com/docker/swarm/scheduler/strategy"
+	"github.com/docker/swarm/state"
+	"github.com/samalba/dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainNode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := state.NewStore(dir)
+	assert.NoError(t, store.Initialize())
+
+	random, err := strategy.New("random", nil)
+	assert.NoError(t, err)
+	s := &SwarmCluster{
+		eventHandler: &eventRecorder{},
+		nodes:        make(map[string]*Node),
+		scheduler:    scheduler.New(random, []filter.Filter{}),
+		store:        store,
+		reservations: newReservations(nil),
+		placers:      make(chan struct{}, defaultSchedulerWorkers),
+	}
+
+	config := &dockerclient.ContainerConfig{Image: "busybox"}
+	drained, client1 := connectMockNode(t, "node-1")
+	other, client2 := connectMockNode(t, "node-2")
+	s.nodes[drained.id] = drained
+	s.nodes[other.id] = other
+	container := &cluster.Container{Container: dockerclient.Container{Id: "app", Names: []string{"/agent"}}, Node: drained}
+	container.Info.Config = config
+	container.Info.State.Running = true
+	assert.NoError(t, drained.AddContainer(container))
+
+	assert.Equal(t, s.DrainNode("unknown", cluster.DrainKeep), cluster.ErrNodeNotFound)
+	assert.Error(t, s.DrainNode("node-1", "delete"))
+	assert.False(t, drained.IsDrained())
+
+	// The container moves to the other node, and is started there.
+	expectCreate(client2, config, "moved")
+	expectStart(client2, config, "moved")
+	client1.On("RemoveContainer", "app", true, true).Return(nil).Once()
+	assert.NoError(t, s.DrainNode("node-1", cluster.DrainReschedule))
+	client1.AssertExpectations(t)
+	client2.AssertExpectations(t)
+	assert.True(t, drained.IsDrained())
+	assert.Empty(t, drained.Containers())
+	assert.NotNil(t, other.Container("moved"))
+
+	// Drained nodes don't get new containers.
+	assert.Equal(t, s.schedulableNodesLocked(), []cluster.Node{other})
+
+	assert.NoError(t, s.ActivateNode("node-1"))
+	assert.False(t, drained.IsDrained())
+	assert.Len(t, s.schedulableNodesLocked(), 2)
+}
+
+func TestDrainedNodesPersisted(t *testing.T) {
+	kv := testutil.NewFakeDiscoveryService()
+	s := &SwarmCluster{
+		nodes:        make(map[string]*Node),
+		reservations: newReservations(nil),
+		kv:           kv,
+	}
+	n, _ := connectMockNode(t, "node-1")
+	s.nodes[n.id] = n
+	assert.NoError(t, s.DrainNode("node-1", cluster.DrainKeep))
+	assert.True(t, s.drained["node-1"])
+
+	// A restarted manager drains the node again when it connects.
+	restarted := &SwarmCluster{kv: kv}
+	assert.NoError(t, restarted.loadDrained())
+	assert.True(t, restarted.drained["node-1"])
+
+	assert.NoError(t, s.ActivateNode("node-1"))
+	assert.False(t, s.drained["node-1"])
+	values, err := kv.List(drainedBucket)
+	assert.NoError(t, err)
+	assert.Empty(t, values)
+}
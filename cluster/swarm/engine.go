@@ -0,0 +1,60 @@
+package swarm
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Returned for the endpoints the engine doesn't serve.
+var errEndpointNotFound = errors.New("endpoint not found")
+
+// An engineAPI calls the endpoints of the engines which the Docker client
+// doesn't support, such as the volumes and the networks.
+type engineAPI struct {
+	scheme string
+	client *http.Client
+}
+
+func newEngineAPI(config *tls.Config) *engineAPI {
+	scheme, client := newEngineClient(config)
+	return &engineAPI{scheme: scheme, client: client}
+}
+
+// do sends `in` as JSON to the engine at `addr`, and decodes the response in
+// `out` unless it is nil.
+func (e *engineAPI) do(method, addr, path string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%s://%s%s", e.scheme, addr, path), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errEndpointNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,98 @@
+package swarm
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/docker/swarm/cluster"
+)
+
+// A healthChecker actively probes the engines through their ping endpoint.
+type healthChecker struct {
+	scheme string
+	client *http.Client
+
+	interval   time.Duration
+	failures   int
+	successes  int
+	maxBackoff time.Duration
+}
+
+func newHealthChecker(options *cluster.Options) *healthChecker {
+	scheme, client := newEngineClient(options.TLSConfig)
+	h := &healthChecker{
+		scheme:     scheme,
+		client:     client,
+		interval:   options.HealthInterval,
+		failures:   options.HealthFailures,
+		successes:  options.HealthSuccesses,
+		maxBackoff: options.HealthMaxBackoff,
+	}
+	if h.failures < 1 {
+		h.failures = 1
+	}
+	if h.successes < 1 {
+		h.successes = 1
+	}
+	if h.maxBackoff < h.interval {
+		h.maxBackoff = h.interval
+	}
+	return h
+}
+
+func (h *healthChecker) probe(n *Node) error {
+	resp, err := h.client.Get(fmt.Sprintf("%s://%s/_ping", h.scheme, n.addr))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ping: %s", resp.Status)
+	}
+	return nil
+}
+
+// Probe the node until it's disconnected, flagging it as dead or alive once
+// enough consecutive probes agree.
+func (n *Node) checkHealth(h *healthChecker) {
+	var (
+		failures, successes int
+		delay               = h.interval
+	)
+	for {
+		n.probeHealth(h, &failures, &successes)
+
+		// Back off while the node is dead.
+		if n.IsHealthy() {
+			delay = h.interval
+		} else {
+			delay *= 2
+			if delay > h.maxBackoff {
+				delay = h.maxBackoff
+			}
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-n.done:
+			return
+		}
+	}
+}
+
+func (n *Node) probeHealth(h *healthChecker, failures, successes *int) {
+	err := h.probe(n)
+	if err != nil {
+		*failures, *successes = *failures+1, 0
+	} else {
+		*failures, *successes = 0, *successes+1
+	}
+
+	switch {
+	case n.IsHealthy() && *failures >= h.failures:
+		n.setHealthy(false, fmt.Errorf("%d consecutive health checks failed: %v", *failures, err))
+	case !n.IsHealthy() && *successes >= h.successes:
+		n.setHealthy(true, nil)
+	}
+}
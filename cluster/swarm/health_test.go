@@ -0,0 +1,79 @@
+package swarm
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/samalba/dockerclient"
+	"github.com/samalba/dockerclient/mockclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHealthChecker(t *testing.T) {
+	up := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/_ping")
+		if !up {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	node := NewNode(strings.TrimPrefix(server.URL, "http://"), 0)
+	client := mockclient.NewMockClient()
+	client.On("Info").Return(mockInfo, nil)
+	client.On("Version").Return(mockVersion, nil)
+	client.On("ListContainers", true, false, "").Return([]dockerclient.Container{}, nil)
+	client.On("ListImages").Return([]*dockerclient.Image{}, nil)
+	client.On("StartMonitorEvents", mock.Anything, mock.Anything, mock.Anything).Return()
+	client.On("StopAllMonitorEvents").Return()
+	node.probed = true
+	assert.NoError(t, node.connectClient(client))
+
+	h := newHealthChecker(&cluster.Options{HealthInterval: time.Second, HealthFailures: 2, HealthSuccesses: 2})
+	var failures, successes int
+
+	// A single failure isn't enough to flag the node as dead.
+	up = false
+	node.probeHealth(h, &failures, &successes)
+	assert.True(t, node.IsHealthy())
+	node.probeHealth(h, &failures, &successes)
+	assert.False(t, node.IsHealthy())
+
+	// Nor is a single success enough to bring it back.
+	up = true
+	node.probeHealth(h, &failures, &successes)
+	assert.False(t, node.IsHealthy())
+	node.probeHealth(h, &failures, &successes)
+	assert.True(t, node.IsHealthy())
+}
+
+func TestHealthCheckerDefaults(t *testing.T) {
+	h := newHealthChecker(&cluster.Options{HealthInterval: 10 * time.Second})
+	assert.Equal(t, h.failures, 1)
+	assert.Equal(t, h.successes, 1)
+	assert.Equal(t, h.maxBackoff, 10*time.Second)
+}
+
+func TestSetHealthyConcurrently(t *testing.T) {
+	n := NewNode("node", 0)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			n.setHealthy(false, errors.New("unreachable"))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		n.IsHealthy()
+	}
+	<-done
+	assert.False(t, n.IsHealthy())
+}
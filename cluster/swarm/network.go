@@ -0,0 +1,143 @@
+package swarm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/swarm/cluster"
+)
+
+// Engines older than 1.9 don't know about networks.
+var errNetworksNotSupported = errors.New("networks are not supported by this engine")
+
+func (e *engineAPI) listNetworks(n *Node) ([]*cluster.Network, error) {
+	networks := []*cluster.Network{}
+	if err := e.do("GET", n.addr, "/networks", nil, &networks); err != nil {
+		if err == errEndpointNotFound {
+			err = errNetworksNotSupported
+		}
+		return nil, err
+	}
+	return networks, nil
+}
+
+func (e *engineAPI) createNetwork(n *Node, request *cluster.NetworkCreateRequest) (*cluster.Network, error) {
+	created := struct {
+		ID string `json:"Id"`
+	}{}
+	if err := e.do("POST", n.addr, "/networks/create", request, &created); err != nil {
+		if err == errEndpointNotFound {
+			err = errNetworksNotSupported
+		}
+		return nil, err
+	}
+	return &cluster.Network{ID: created.ID, Name: request.Name, Driver: request.Driver, Node: n}, nil
+}
+
+// Refresh the list of networks on the node, if its engine API is reachable.
+func (n *Node) refreshNetworks() error {
+	if n.engineAPI == nil {
+		return nil
+	}
+
+	networks, err := n.engineAPI.listNetworks(n)
+	if err == errNetworksNotSupported {
+		networks, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	n.networks = networks
+	for _, network := range n.networks {
+		network.Node = n
+	}
+	return nil
+}
+
+// Networks returns the networks of the node.
+func (n *Node) Networks() []*cluster.Network {
+	n.RLock()
+	defer n.RUnlock()
+	return append([]*cluster.Network{}, n.networks...)
+}
+
+// Networks returns the networks of all the nodes, the networks of the global
+// scope once per node.
+func (s *SwarmCluster) Networks() []*cluster.Network {
+	s.RLock()
+	defer s.RUnlock()
+
+	networks := []*cluster.Network{}
+	for _, n := range s.nodes {
+		networks = append(networks, n.Networks()...)
+	}
+	return networks
+}
+
+// Network returns the network of ID or name `IdOrName`, or `<node>/<name>` to
+// tell apart the networks of the same name on several nodes.
+func (s *SwarmCluster) Network(IdOrName string) *cluster.Network {
+	for _, network := range s.Networks() {
+		if network.ID == IdOrName || network.Name == IdOrName || network.Node.Name()+"/"+network.Name == IdOrName {
+			return network
+		}
+	}
+	return nil
+}
+
+// CreateNetwork creates the network on the node prefixing its name, as in
+// `<node>/<name>`. Otherwise, overlay networks are created once, the engines
+// sharing them, and the other networks on all the healthy nodes.
+func (s *SwarmCluster) CreateNetwork(request *cluster.NetworkCreateRequest) ([]*cluster.Network, error) {
+	local := *request
+	prefixed := strings.SplitN(request.Name, "/", 2)
+	if len(prefixed) == 2 {
+		local.Name = prefixed[1]
+	}
+
+	s.RLock()
+	nodes, all := []*Node{}, []*Node{}
+	for _, n := range s.nodes {
+		all = append(all, n)
+		if len(prefixed) == 2 {
+			if n.name == prefixed[0] || n.id == prefixed[0] {
+				nodes = append(nodes, n)
+			}
+		} else if n.IsHealthy() {
+			nodes = append(nodes, n)
+		}
+	}
+	s.RUnlock()
+
+	if len(nodes) == 0 {
+		return nil, cluster.ErrNodeNotFound
+	}
+	if len(prefixed) == 1 && request.Driver == "overlay" {
+		nodes = nodes[:1]
+	}
+
+	networks := []*cluster.Network{}
+	for _, n := range nodes {
+		if n.engineAPI == nil {
+			return nil, errNetworksNotSupported
+		}
+		network, err := n.engineAPI.createNetwork(n, &local)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the network on %s: %v", n.name, err)
+		}
+		networks = append(networks, network)
+	}
+
+	// Overlay networks show up on all the nodes.
+	for _, n := range all {
+		if err := n.refreshNetworks(); err != nil {
+			log.WithFields(log.Fields{"name": n.name, "id": n.id}).Errorf("Failed to refresh the networks: %v", err)
+		}
+	}
+	return networks, nil
+}
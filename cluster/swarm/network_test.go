@@ -0,0 +1,89 @@
+package swarm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEngine serves the networks of an engine, the overlay ones being shared
+// through `overlays`.
+type fakeEngine struct {
+	sync.Mutex
+
+	networks []*cluster.Network
+	overlays *[]*cluster.Network
+	created  int
+}
+
+func (e *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.Lock()
+	defer e.Unlock()
+
+	switch r.URL.Path {
+	case "/networks":
+		json.NewEncoder(w).Encode(append(append([]*cluster.Network{}, e.networks...), *e.overlays...))
+	case "/networks/create":
+		request := &cluster.NetworkCreateRequest{}
+		json.NewDecoder(r.Body).Decode(request)
+		e.created++
+		network := &cluster.Network{ID: request.Name + "_id", Name: request.Name, Driver: request.Driver, Scope: "local"}
+		if request.Driver == "overlay" {
+			network.Scope = "global"
+			*e.overlays = append(*e.overlays, network)
+		} else {
+			e.networks = append(e.networks, network)
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"Id": network.ID})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestNetworks(t *testing.T) {
+	overlays := []*cluster.Network{}
+	s := &SwarmCluster{nodes: make(map[string]*Node)}
+	engines := []*fakeEngine{}
+	for _, id := range []string{"node-1", "node-2"} {
+		engine := &fakeEngine{networks: []*cluster.Network{{ID: id + "_bridge", Name: "bridge", Driver: "bridge", Scope: "local"}}, overlays: &overlays}
+		server := httptest.NewServer(engine)
+		defer server.Close()
+
+		n, _ := connectMockNode(t, id)
+		n.addr = strings.TrimPrefix(server.URL, "http://")
+		n.engineAPI = newEngineAPI(nil)
+		assert.NoError(t, n.refreshNetworks())
+		s.nodes[n.id] = n
+		engines = append(engines, engine)
+	}
+
+	assert.Len(t, s.Networks(), 2)
+	assert.Equal(t, s.Network("node-2/bridge").ID, "node-2_bridge")
+
+	// Overlay networks are created once, and show up on all the nodes.
+	created, err := s.CreateNetwork(&cluster.NetworkCreateRequest{Name: "backend", Driver: "overlay"})
+	assert.NoError(t, err)
+	assert.Len(t, created, 1)
+	assert.Equal(t, engines[0].created+engines[1].created, 1)
+	for _, n := range s.nodes {
+		assert.Len(t, n.Networks(), 2)
+	}
+
+	// Local networks are created on all the nodes, or on the one prefixing
+	// their name.
+	created, err = s.CreateNetwork(&cluster.NetworkCreateRequest{Name: "frontend", Driver: "bridge"})
+	assert.NoError(t, err)
+	assert.Len(t, created, 2)
+	created, err = s.CreateNetwork(&cluster.NetworkCreateRequest{Name: "node-1/private", Driver: "bridge"})
+	assert.NoError(t, err)
+	assert.Len(t, created, 1)
+	assert.Equal(t, s.Network("node-1/private").Node, s.nodes["node-1"])
+	assert.Nil(t, s.Network("node-2/private"))
+}
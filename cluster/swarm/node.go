@@ -11,24 +11,29 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/swarm/cluster"
+	"github.com/docker/swarm/metrics"
 	"github.com/samalba/dockerclient"
 )
 
 const (
-	// Force-refresh the state of the node this often.
+	// By default, refresh the state of the nodes this often.
 	stateRefreshPeriod = 30 * time.Second
 
 	// Timeout for requests sent out to the node.
 	requestTimeout = 10 * time.Second
 )
 
+var nodeHealthy = metrics.NewGauge("swarm_node_healthy", "Whether each node is healthy (1) or dead (0).", "name", "addr")
+
 func NewNode(addr string, overcommitRatio float64) *Node {
 	e := &Node{
 		addr:            addr,
 		labels:          make(map[string]string),
 		ch:              make(chan bool),
+		done:            make(chan struct{}),
 		containers:      make(map[string]*cluster.Container),
 		healthy:         true,
+		refresher:       defaultRefresher,
 		overcommitRatio: int64(overcommitRatio * 100),
 	}
 	return e
@@ -37,21 +42,37 @@ func NewNode(addr string, overcommitRatio float64) *Node {
 type Node struct {
 	sync.RWMutex
 
-	id     string
-	ip     string
-	addr   string
-	name   string
-	Cpus   int64
-	Memory int64
-	labels map[string]string
+	id      string
+	ip      string
+	addr    string
+	name    string
+	version string
+	Cpus    int64
+	Memory  int64
+	labels  map[string]string
+
+	engineLabels map[string]string
+	metadata     map[string]string
 
 	ch              chan bool
+	done            chan struct{}
 	containers      map[string]*cluster.Container
 	images          []*cluster.Image
 	client          dockerclient.Client
 	eventHandler    cluster.EventHandler
 	healthy         bool
+	probed          bool
+	refresher       *refresher
+	engineAPI       *engineAPI
+	volumes         []*cluster.Volume
+	volumeDrivers   []string
+	networks        []*cluster.Network
+	drained         bool
 	overcommitRatio int64
+
+	// Actual usage, as a fraction of the total, when sampled.
+	cpuUsage    float64
+	memoryUsage float64
 }
 
 func (n *Node) ID() string {
@@ -70,10 +91,40 @@ func (n *Node) Name() string {
 	return n.name
 }
 
+// Version returns the version of the Docker engine.
+func (n *Node) Version() string {
+	n.RLock()
+	defer n.RUnlock()
+	return n.version
+}
+
 func (n *Node) Labels() map[string]string {
+	n.RLock()
+	defer n.RUnlock()
 	return n.labels
 }
 
+// Set the metadata attached to the node by the discovery service. It is
+// exposed through Labels(), labels reported by the engine taking precedence.
+func (n *Node) SetMetadata(metadata map[string]string) {
+	n.Lock()
+	defer n.Unlock()
+	n.metadata = metadata
+	n.mergeLabels()
+}
+
+// Must be called with the lock held.
+func (n *Node) mergeLabels() {
+	labels := make(map[string]string)
+	for k, v := range n.metadata {
+		labels[k] = v
+	}
+	for k, v := range n.engineLabels {
+		labels[k] = v
+	}
+	n.labels = labels
+}
+
 // Connect will initialize a connection to the Docker daemon running on the
 // host, gather machine specs (memory, cpu, ...) and monitor state changes.
 func (n *Node) Connect(config *tls.Config) error {
@@ -116,8 +167,18 @@ func (n *Node) connectClient(client dockerclient.Client) error {
 		return err
 	}
 
+	if err := n.refreshVolumes(); err != nil {
+		n.client = nil
+		return err
+	}
+
+	if err := n.refreshNetworks(); err != nil {
+		n.client = nil
+		return err
+	}
+
 	// Start the update loop.
-	go n.refreshLoop()
+	go n.refreshLoop(n.refresher)
 
 	// Start monitoring events from the Node.
 	n.client.StartMonitorEvents(n.handler, nil)
@@ -126,15 +187,48 @@ func (n *Node) connectClient(client dockerclient.Client) error {
 	return nil
 }
 
+// Disconnect stops monitoring the node.
+func (n *Node) Disconnect() {
+	if n.client == nil {
+		return
+	}
+	close(n.done)
+	n.client.StopAllMonitorEvents()
+}
+
 // IsConnected returns true if the engine is connected to a remote docker API
 func (n *Node) IsConnected() bool {
 	return n.client != nil
 }
 
+// ping checks the engine of the node answers.
+func (n *Node) ping() error {
+	if n.client == nil {
+		return errors.New("not connected")
+	}
+	_, err := n.client.Version()
+	return err
+}
+
 func (n *Node) IsHealthy() bool {
+	n.RLock()
+	defer n.RUnlock()
 	return n.healthy
 }
 
+// IsDrained returns true if the node is taken out of the scheduling.
+func (n *Node) IsDrained() bool {
+	n.RLock()
+	defer n.RUnlock()
+	return n.drained
+}
+
+func (n *Node) setDrained(drained bool) {
+	n.Lock()
+	defer n.Unlock()
+	n.drained = drained
+}
+
 // Gather node specs (CPU, memory, constraints, ...).
 func (n *Node) updateSpecs() error {
 	info, err := n.client.Info()
@@ -146,11 +240,18 @@ func (n *Node) updateSpecs() error {
 	if len(info.ID) == 0 {
 		return fmt.Errorf("Node %s is running an unsupported version of Docker Engine. Please upgrade.", n.addr)
 	}
+	version, err := n.client.Version()
+	if err != nil {
+		return err
+	}
+	n.Lock()
+	defer n.Unlock()
 	n.id = info.ID
 	n.name = info.Name
+	n.version = version.Version
 	n.Cpus = info.NCPU
 	n.Memory = info.MemTotal
-	n.labels = map[string]string{
+	n.engineLabels = map[string]string{
 		"storagedriver":   info.Driver,
 		"executiondriver": info.ExecutionDriver,
 		"kernelversion":   info.KernelVersion,
@@ -158,8 +259,9 @@ func (n *Node) updateSpecs() error {
 	}
 	for _, label := range info.Labels {
 		kv := strings.SplitN(label, "=", 2)
-		n.labels[kv[0]] = kv[1]
+		n.engineLabels[kv[0]] = kv[1]
 	}
+	n.mergeLabels()
 	return nil
 }
 
@@ -269,41 +371,49 @@ func (n *Node) RefreshContainersAsync() {
 	n.ch <- true
 }
 
-func (n *Node) refreshLoop() {
-	for {
-		var err error
-		select {
-		case <-n.ch:
-			err = n.RefreshContainers(false)
-		case <-time.After(stateRefreshPeriod):
-			err = n.RefreshContainers(false)
-		}
+// setHealthy flags the node as dead, for the reason `err`, or as alive.
+func (n *Node) setHealthy(healthy bool, err error) {
+	defer n.reportHealth()
 
-		if err == nil {
-			err = n.refreshImages()
-		}
+	// The health checks and the refresh loop both set it: only the one
+	// changing it acts on the change.
+	n.Lock()
+	wasHealthy := n.healthy
+	n.healthy = healthy
+	n.Unlock()
 
-		if err != nil {
-			if n.healthy {
-				n.emitEvent("node_disconnect")
-			}
-			n.healthy = false
-			log.WithFields(log.Fields{"name": n.name, "id": n.id}).Errorf("Flagging node as dead. Updated state failed: %v", err)
+	if !healthy {
+		// Only log the first failure of a dead node, which keeps failing
+		// until it comes back.
+		if wasHealthy {
+			n.emitEvent("node_disconnect")
+			log.WithFields(log.Fields{"name": n.name, "id": n.id}).Errorf("Flagging node as dead: %v", err)
 		} else {
-			if !n.healthy {
-				log.WithFields(log.Fields{"name": n.name, "id": n.id}).Info("Node came back to life. Hooray!")
-				n.client.StopAllMonitorEvents()
-				n.client.StartMonitorEvents(n.handler, nil)
-				n.emitEvent("node_reconnect")
-				if err := n.updateSpecs(); err != nil {
-					log.WithFields(log.Fields{"name": n.name, "id": n.id}).Errorf("Update node specs failed: %v", err)
-				}
-			}
-			n.healthy = true
+			log.WithFields(log.Fields{"name": n.name, "id": n.id}).Debugf("Node still dead: %v", err)
+		}
+		return
+	}
+
+	if !wasHealthy {
+		log.WithFields(log.Fields{"name": n.name, "id": n.id}).Info("Node came back to life. Hooray!")
+		n.client.StopAllMonitorEvents()
+		n.client.StartMonitorEvents(n.handler, nil)
+		n.emitEvent("node_reconnect")
+		if err := n.updateSpecs(); err != nil {
+			log.WithFields(log.Fields{"name": n.name, "id": n.id}).Errorf("Update node specs failed: %v", err)
 		}
 	}
 }
 
+// reportHealth exposes the health of the node in the metrics.
+func (n *Node) reportHealth() {
+	value := 0.0
+	if n.IsHealthy() {
+		value = 1
+	}
+	nodeHealthy.Set(value, n.name, n.addr)
+}
+
 func (n *Node) emitEvent(event string) {
 	// If there is no event handler registered, abort right now.
 	if n.eventHandler == nil {
@@ -342,6 +452,20 @@ func (n *Node) UsedCpus() int64 {
 	return r
 }
 
+// Return the fraction of the CPUs actually in use, 0 if not sampled.
+func (n *Node) CpuUsage() float64 {
+	n.RLock()
+	defer n.RUnlock()
+	return n.cpuUsage
+}
+
+// Return the fraction of the memory actually in use, 0 if not sampled.
+func (n *Node) MemoryUsage() float64 {
+	n.RLock()
+	defer n.RUnlock()
+	return n.memoryUsage
+}
+
 func (n *Node) TotalMemory() int64 {
 	return n.Memory + (n.Memory * n.overcommitRatio / 100)
 }
@@ -362,7 +486,19 @@ func (n *Node) Create(config *dockerclient.ContainerConfig, name string, pullIma
 	// nb of CPUs -> real CpuShares
 	newConfig.CpuShares = config.CpuShares * 100 / n.Cpus
 
-	if id, err = client.CreateContainer(&newConfig, name); err != nil {
+	// The Docker client can't send the volume driver.
+	create := client.CreateContainer
+	if driver := cluster.VolumeDriver(config); driver != "" {
+		newConfig.Env = cluster.WithoutVolumeDriver(config.Env)
+		create = func(config *dockerclient.ContainerConfig, name string) (string, error) {
+			if n.engineAPI == nil {
+				return "", fmt.Errorf("the volume driver %s can't be sent to the engine", driver)
+			}
+			return n.engineAPI.createContainer(n, config, name, driver)
+		}
+	}
+
+	if id, err = create(&newConfig, name); err != nil {
 		// If the error is other than not found, abort immediately.
 		if err != dockerclient.ErrNotFound || !pullImage {
 			return nil, err
@@ -372,7 +508,7 @@ func (n *Node) Create(config *dockerclient.ContainerConfig, name string, pullIma
 			return nil, err
 		}
 		// ...And try again.
-		if id, err = client.CreateContainer(&newConfig, name); err != nil {
+		if id, err = create(&newConfig, name); err != nil {
 			return nil, err
 		}
 	}
@@ -500,6 +636,12 @@ func (n *Node) handler(ev *dockerclient.Event, _ chan error, args ...interface{}
 		// If the container is started or stopped, we have to do an inspect in
 		// order to get the new NetworkSettings.
 		n.RefreshContainer(ev.Id, true)
+	case "create", "destroy":
+		// Containers may create or remove volumes.
+		n.RefreshContainer(ev.Id, false)
+		if err := n.refreshVolumes(); err != nil {
+			log.WithFields(log.Fields{"name": n.name, "id": n.id}).Errorf("Failed to refresh the volumes: %v", err)
+		}
 	default:
 		// Otherwise, do a "soft" refresh of the container.
 		n.RefreshContainer(ev.Id, false)
@@ -23,6 +23,10 @@ var (
 		OperatingSystem: "golang",
 		Labels:          []string{"foo=bar"},
 	}
+
+	mockVersion = &dockerclient.Version{
+		Version: "1.6.0",
+	}
 )
 
 func TestNodeConnectionFailure(t *testing.T) {
@@ -57,6 +61,7 @@ func TestNodeCpusMemory(t *testing.T) {
 
 	client := mockclient.NewMockClient()
 	client.On("Info").Return(mockInfo, nil)
+	client.On("Version").Return(mockVersion, nil)
 	client.On("ListContainers", true, false, "").Return([]dockerclient.Container{}, nil)
 	client.On("ListImages").Return([]*dockerclient.Image{}, nil)
 	client.On("StartMonitorEvents", mock.Anything, mock.Anything, mock.Anything).Return()
@@ -77,6 +82,7 @@ func TestNodeSpecs(t *testing.T) {
 
 	client := mockclient.NewMockClient()
 	client.On("Info").Return(mockInfo, nil)
+	client.On("Version").Return(mockVersion, nil)
 	client.On("ListContainers", true, false, "").Return([]dockerclient.Container{}, nil)
 	client.On("ListImages").Return([]*dockerclient.Image{}, nil)
 	client.On("StartMonitorEvents", mock.Anything, mock.Anything, mock.Anything).Return()
@@ -91,6 +97,33 @@ func TestNodeSpecs(t *testing.T) {
 	assert.Equal(t, node.Labels()["executiondriver"], mockInfo.ExecutionDriver)
 	assert.Equal(t, node.Labels()["kernelversion"], mockInfo.KernelVersion)
 	assert.Equal(t, node.Labels()["operatingsystem"], mockInfo.OperatingSystem)
+	assert.Equal(t, node.Version(), mockVersion.Version)
+	assert.Equal(t, node.Labels()["foo"], "bar")
+
+	client.Mock.AssertExpectations(t)
+}
+
+func TestNodeMetadata(t *testing.T) {
+	node := NewNode("test", 0)
+	node.SetMetadata(map[string]string{"region": "us-east", "foo": "metadata"})
+
+	client := mockclient.NewMockClient()
+	client.On("Info").Return(mockInfo, nil)
+	client.On("Version").Return(mockVersion, nil)
+	client.On("ListContainers", true, false, "").Return([]dockerclient.Container{}, nil)
+	client.On("ListImages").Return([]*dockerclient.Image{}, nil)
+	client.On("StartMonitorEvents", mock.Anything, mock.Anything, mock.Anything).Return()
+
+	assert.NoError(t, node.connectClient(client))
+
+	// Metadata is exposed as labels, engine labels take precedence.
+	assert.Equal(t, node.Labels()["region"], "us-east")
+	assert.Equal(t, node.Labels()["foo"], "bar")
+	assert.Equal(t, node.Labels()["storagedriver"], mockInfo.Driver)
+
+	// Updated metadata replaces the previous one.
+	node.SetMetadata(map[string]string{"region": "us-west"})
+	assert.Equal(t, node.Labels()["region"], "us-west")
 	assert.Equal(t, node.Labels()["foo"], "bar")
 
 	client.Mock.AssertExpectations(t)
@@ -102,6 +135,7 @@ func TestNodeState(t *testing.T) {
 
 	client := mockclient.NewMockClient()
 	client.On("Info").Return(mockInfo, nil)
+	client.On("Version").Return(mockVersion, nil)
 	client.On("StartMonitorEvents", mock.Anything, mock.Anything, mock.Anything).Return()
 
 	// The client will return one container at first, then a second one will appear.
@@ -141,6 +175,7 @@ func TestNodeContainerLookup(t *testing.T) {
 
 	client := mockclient.NewMockClient()
 	client.On("Info").Return(mockInfo, nil)
+	client.On("Version").Return(mockVersion, nil)
 	client.On("StartMonitorEvents", mock.Anything, mock.Anything, mock.Anything).Return()
 
 	client.On("ListContainers", true, false, "").Return([]dockerclient.Container{{Id: "container-id", Names: []string{"/container-name1", "/container-name2"}}}, nil).Once()
@@ -180,6 +215,7 @@ func TestCreateContainer(t *testing.T) {
 	)
 
 	client.On("Info").Return(mockInfo, nil)
+	client.On("Version").Return(mockVersion, nil)
 	client.On("StartMonitorEvents", mock.Anything, mock.Anything, mock.Anything).Return()
 	client.On("ListContainers", true, false, "").Return([]dockerclient.Container{}, nil).Once()
 	client.On("ListImages").Return([]*dockerclient.Image{}, nil).Once()
@@ -0,0 +1,124 @@
+package swarm
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/docker/swarm/scheduler/filter"
+	"github.com/samalba/dockerclient"
+)
+
+// ErrNoNodeToPull is returned when no node satisfies the constraints of a pull.
+var ErrNoNodeToPull = errors.New("no healthy node satisfies the constraints")
+
+// An imagePuller pulls the images straight from the engines, to stream their
+// progress.
+type imagePuller struct {
+	scheme string
+	client *http.Client
+}
+
+func newImagePuller(config *tls.Config) *imagePuller {
+	scheme, client := newEngineClient(config)
+	// Pulls take as long as the downloads.
+	client.Timeout = 0
+	return &imagePuller{scheme: scheme, client: client}
+}
+
+func (p *imagePuller) pull(n *Node, name, authConfig string, callback func(*cluster.PullProgress)) error {
+	v := url.Values{}
+	v.Set("fromImage", name)
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s://%s/images/create?%s", p.scheme, n.addr, v.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	if authConfig != "" {
+		req.Header.Set("X-Registry-Auth", authConfig)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		progress := &cluster.PullProgress{}
+		if err := decoder.Decode(progress); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if progress.Error != "" {
+			return errors.New(progress.Error)
+		}
+		callback(progress)
+	}
+	return n.refreshImages()
+}
+
+// Pull the image on the nodes satisfying the constraints.
+func (s *SwarmCluster) Pull(name string, authConfig string, constraints []string, callback func(cluster.Node, *cluster.PullProgress)) ([]*cluster.PullResult, error) {
+	nodes, err := s.pullNodes(constraints)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make([]*cluster.PullResult, len(nodes))
+	)
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, n *Node) {
+			defer wg.Done()
+			err := s.puller.pull(n, name, authConfig, func(progress *cluster.PullProgress) {
+				// Serialize the progress of the nodes.
+				mu.Lock()
+				defer mu.Unlock()
+				callback(n, progress)
+			})
+			results[i] = &cluster.PullResult{Node: n, Err: err}
+		}(i, node.(*Node))
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// pullNodes returns the healthy nodes satisfying the constraints, such as
+// `storage==ssd`.
+func (s *SwarmCluster) pullNodes(constraints []string) ([]cluster.Node, error) {
+	config := &dockerclient.ContainerConfig{}
+	for _, constraint := range constraints {
+		config.Env = append(config.Env, "constraint:"+constraint)
+	}
+
+	s.RLock()
+	nodes := []cluster.Node{}
+	for _, n := range s.nodes {
+		if n.IsHealthy() {
+			nodes = append(nodes, n)
+		}
+	}
+	s.RUnlock()
+
+	if len(nodes) == 0 {
+		return nil, ErrNoNodeToPull
+	}
+	return (&filter.ConstraintFilter{}).Filter(config, nodes)
+}
@@ -0,0 +1,58 @@
+package swarm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/samalba/dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPull(t *testing.T) {
+	engine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/images/create")
+		assert.Equal(t, r.Header.Get("X-Registry-Auth"), "auth")
+		switch r.URL.Query().Get("fromImage") {
+		case "busybox":
+			w.Write([]byte(`{"status":"Pulling repository busybox"}{"id":"8c2e06607696","status":"Downloading","progress":"[==>  ]","progressDetail":{"current":1,"total":2}}`))
+		default:
+			w.Write([]byte(`{"status":"Pulling repository unknown"}{"error":"image not found"}`))
+		}
+	}))
+	defer engine.Close()
+
+	ssd, client := connectMockNode(t, "ssd")
+	ssd.addr = strings.TrimPrefix(engine.URL, "http://")
+	ssd.labels = map[string]string{"storage": "ssd"}
+	client.On("ListImages").Return([]*dockerclient.Image{{Id: "busybox"}}, nil)
+	disk, _ := connectMockNode(t, "disk")
+	disk.labels = map[string]string{"storage": "disk"}
+
+	s := &SwarmCluster{
+		nodes:  map[string]*Node{ssd.id: ssd, disk.id: disk},
+		puller: newImagePuller(nil),
+	}
+
+	progress := []*cluster.PullProgress{}
+	results, err := s.Pull("busybox", "auth", []string{"storage==ssd"}, func(node cluster.Node, p *cluster.PullProgress) {
+		assert.Equal(t, node, ssd)
+		progress = append(progress, p)
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.NoError(t, results[0].Err)
+	assert.Len(t, progress, 2)
+	assert.Equal(t, progress[1].ID, "8c2e06607696")
+	assert.Equal(t, string(progress[1].ProgressDetail), `{"current":1,"total":2}`)
+	assert.Len(t, ssd.Images(), 1)
+
+	results, err = s.Pull("unknown", "auth", []string{"storage==ssd"}, func(cluster.Node, *cluster.PullProgress) {})
+	assert.NoError(t, err)
+	assert.EqualError(t, results[0].Err, "image not found")
+
+	_, err = s.Pull("busybox", "auth", []string{"storage==tape"}, func(cluster.Node, *cluster.PullProgress) {})
+	assert.Error(t, err)
+}
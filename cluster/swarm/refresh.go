@@ -0,0 +1,140 @@
+package swarm
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/swarm/cluster"
+)
+
+const (
+	// Default number of nodes refreshed at the same time.
+	defaultRefreshWorkers = 50
+
+	// Default maximum time between each refresh of a failing node.
+	defaultRefreshMaxBackoff = 5 * time.Minute
+)
+
+// Refresher used by the nodes created outside of a cluster.
+var defaultRefresher = newRefresher(&cluster.Options{})
+
+// A refresher bounds the number of nodes refreshing their state at the same
+// time, and spaces the refreshes of each node: by a jittered interval so that
+// the nodes don't all refresh together, and by an exponential backoff while a
+// node is failing.
+type refresher struct {
+	workers    chan struct{}
+	interval   time.Duration
+	maxBackoff time.Duration
+}
+
+func newRefresher(options *cluster.Options) *refresher {
+	r := &refresher{
+		interval:   options.RefreshInterval,
+		maxBackoff: options.RefreshMaxBackoff,
+	}
+	workers := options.RefreshWorkers
+	if workers < 1 {
+		workers = defaultRefreshWorkers
+	}
+	r.workers = make(chan struct{}, workers)
+	if r.interval <= 0 {
+		r.interval = stateRefreshPeriod
+	}
+	if r.maxBackoff <= 0 {
+		r.maxBackoff = defaultRefreshMaxBackoff
+	}
+	if r.maxBackoff < r.interval {
+		r.maxBackoff = r.interval
+	}
+	return r
+}
+
+// run `refresh` once a worker is available, unless `done` is closed first.
+func (r *refresher) run(done <-chan struct{}, refresh func() error) error {
+	select {
+	case r.workers <- struct{}{}:
+	case <-done:
+		return nil
+	}
+	defer func() { <-r.workers }()
+	return refresh()
+}
+
+// next returns the delay before the next refresh of a node whose last
+// refresh, previously spaced by `delay`, returned `err`.
+func (r *refresher) next(delay time.Duration, err error) time.Duration {
+	if err == nil {
+		return r.interval
+	}
+	delay *= 2
+	if delay > r.maxBackoff {
+		delay = r.maxBackoff
+	}
+	return delay
+}
+
+// jitter spreads `delay` by up to 10% either way.
+func jitter(delay time.Duration) time.Duration {
+	spread := int64(delay / 5)
+	if spread <= 0 {
+		return delay
+	}
+	return delay - delay/10 + time.Duration(rand.Int63n(spread))
+}
+
+// Refresh the state of the node until it's disconnected, whenever asked to
+// and otherwise periodically.
+func (n *Node) refreshLoop(r *refresher) {
+	var (
+		delay    = r.interval
+		failures int
+	)
+	for {
+		select {
+		case <-n.ch:
+		case <-time.After(jitter(delay)):
+		case <-n.done:
+			return
+		}
+
+		err := r.run(n.done, n.refresh)
+		delay = r.next(delay, err)
+		if err != nil {
+			failures++
+		} else {
+			failures = 0
+		}
+
+		// With active health checks, the probes decide of the health.
+		if n.probed {
+			if failures == 1 {
+				log.WithFields(log.Fields{"name": n.name, "id": n.id}).Errorf("Updated state failed: %v", err)
+			} else if failures > 1 {
+				log.WithFields(log.Fields{"name": n.name, "id": n.id}).Debugf("Updated state failed %d times in a row, retrying in %s: %v", failures, delay, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			n.setHealthy(false, fmt.Errorf("updated state failed: %v", err))
+		} else {
+			n.setHealthy(true, nil)
+		}
+	}
+}
+
+func (n *Node) refresh() error {
+	if err := n.RefreshContainers(false); err != nil {
+		return err
+	}
+	if err := n.refreshImages(); err != nil {
+		return err
+	}
+	if err := n.refreshVolumes(); err != nil {
+		return err
+	}
+	return n.refreshNetworks()
+}
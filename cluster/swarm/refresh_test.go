@@ -0,0 +1,80 @@
+package swarm
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefresherDefaults(t *testing.T) {
+	r := newRefresher(&cluster.Options{})
+	assert.Equal(t, cap(r.workers), defaultRefreshWorkers)
+	assert.Equal(t, r.interval, stateRefreshPeriod)
+	assert.Equal(t, r.maxBackoff, defaultRefreshMaxBackoff)
+
+	r = newRefresher(&cluster.Options{RefreshWorkers: 4, RefreshInterval: 10 * time.Minute, RefreshMaxBackoff: time.Minute})
+	assert.Equal(t, cap(r.workers), 4)
+	assert.Equal(t, r.maxBackoff, 10*time.Minute)
+}
+
+func TestRefresherBackoff(t *testing.T) {
+	r := newRefresher(&cluster.Options{RefreshInterval: 10 * time.Second, RefreshMaxBackoff: 30 * time.Second})
+	failed := errors.New("connection refused")
+
+	delay := r.next(r.interval, failed)
+	assert.Equal(t, delay, 20*time.Second)
+	delay = r.next(delay, failed)
+	assert.Equal(t, delay, 30*time.Second)
+	delay = r.next(delay, failed)
+	assert.Equal(t, delay, 30*time.Second)
+	assert.Equal(t, r.next(delay, nil), 10*time.Second)
+
+	for i := 0; i < 100; i++ {
+		delay := jitter(10 * time.Second)
+		assert.True(t, delay >= 9*time.Second && delay < 11*time.Second)
+	}
+}
+
+func TestRefresherWorkers(t *testing.T) {
+	r := newRefresher(&cluster.Options{RefreshWorkers: 2})
+
+	var (
+		wg             sync.WaitGroup
+		mu             sync.Mutex
+		running, limit int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.run(nil, func() error {
+				mu.Lock()
+				running++
+				if running > limit {
+					limit = running
+				}
+				mu.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, limit, 2)
+
+	// Disconnected nodes don't wait for a worker.
+	r.workers <- struct{}{}
+	r.workers <- struct{}{}
+	done := make(chan struct{})
+	close(done)
+	assert.NoError(t, r.run(done, func() error { return errors.New("never run") }))
+}
@@ -0,0 +1,408 @@
+package swarm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/swarm/cluster"
+	"github.com/docker/swarm/discovery"
+	"github.com/docker/swarm/scheduler/filter"
+	"github.com/samalba/dockerclient"
+)
+
+const (
+	// Bucket of the discovery service the reservations are persisted to.
+	reservationsBucket = "reservations"
+
+	// Reservations held longer than this, e.g. by a manager which died
+	// mid-deploy, are dropped.
+	reservationTimeout = 5 * time.Minute
+)
+
+// A reservation holds the name of a container being created and, once its
+// node is selected, the host ports it binds and the CPUs and memory it takes
+// there.
+type reservation struct {
+	Key     string
+	Name    string   `json:",omitempty"`
+	Node    string   `json:",omitempty"`
+	Ports   []string `json:",omitempty"`
+	Cpus    int64    `json:",omitempty"`
+	Memory  int64    `json:",omitempty"`
+	Expires time.Time
+
+	// Reloaded from a previous run of the manager.
+	reloaded bool
+}
+
+func (r *reservation) expired(now time.Time) bool {
+	return now.After(r.Expires)
+}
+
+// reservations are kept in memory and, if the discovery service can store
+// values, persisted to it so that a restarted manager doesn't hand out the
+// names and ports of the containers being created when it stopped.
+//
+// The writes to the discovery service are queued while the lock is held and
+// made once it is released, see flush.
+type reservations struct {
+	sync.Mutex
+
+	kv    discovery.KVService
+	byKey map[string]*reservation
+	// Signaled when reservations are released.
+	released *sync.Cond
+
+	writes []kvWrite
+	// Held while flushing, so that the writes are made in order.
+	flushing sync.Mutex
+}
+
+// A kvWrite puts `data` at `key`, or deletes it if nil.
+type kvWrite struct {
+	key  string
+	data []byte
+}
+
+// newReservations returns reservations persisted to `kv`, if not nil.
+func newReservations(kv discovery.KVService) *reservations {
+	r := &reservations{kv: kv, byKey: make(map[string]*reservation)}
+	r.released = sync.NewCond(&r.Mutex)
+	return r
+}
+
+// load reads back the reservations of the previous run, dropping the expired
+// ones.
+func (r *reservations) load() error {
+	if r.kv == nil {
+		return nil
+	}
+	values, err := r.kv.List(reservationsBucket)
+	if err != nil {
+		return err
+	}
+
+	defer r.flush()
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	for key, value := range values {
+		res := &reservation{}
+		if err := json.Unmarshal(value, res); err != nil || res.expired(now) {
+			r.delete(key)
+			continue
+		}
+		res.Key, res.reloaded = key, true
+		r.byKey[key] = res
+	}
+	if len(r.byKey) > 0 {
+		log.WithField("name", "swarm").Infof("Reloaded %d reservations", len(r.byKey))
+	}
+	return nil
+}
+
+// reserve holds the `names`, each one in a reservation of its own, failing
+// if one of them is already held.
+func (r *reservations) reserve(names ...string) ([]*reservation, error) {
+	defer r.flush()
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	r.purge(now)
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		for _, res := range r.byKey {
+			if res.Name == name {
+				return nil, &cluster.NameConflictError{Name: name}
+			}
+		}
+	}
+
+	held := []*reservation{}
+	for _, name := range names {
+		key, err := newReservationKey()
+		if err != nil {
+			r.releaseLocked(held)
+			return nil, fmt.Errorf("unable to reserve the container: %v", err)
+		}
+		res := &reservation{Key: key, Name: name, Expires: now.Add(reservationTimeout)}
+		r.byKey[key] = res
+		r.put(res)
+		held = append(held, res)
+	}
+	return held, nil
+}
+
+// available returns true if no other reservation holds one of the host
+// `ports` on the node `nodeID`.
+func (r *reservations) available(res *reservation, nodeID string, ports []string) bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.availableLocked(res, nodeID, ports, time.Now())
+}
+
+func (r *reservations) availableLocked(res *reservation, nodeID string, ports []string, now time.Time) bool {
+	for _, other := range r.byKey {
+		if other == res || other.Node != nodeID || other.expired(now) {
+			continue
+		}
+		for _, held := range other.Ports {
+			for _, port := range ports {
+				if filter.PortsOverlap(held, port) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// pendingLocked returns the CPUs and memory held on the node `nodeID` by the
+// reservations other than `res`.
+func (r *reservations) pendingLocked(res *reservation, nodeID string, now time.Time) (cpus, memory int64) {
+	for _, other := range r.byKey {
+		if other != res && other.Node == nodeID && !other.expired(now) {
+			cpus += other.Cpus
+			memory += other.Memory
+		}
+	}
+	return cpus, memory
+}
+
+// A pendingNode is a node as seen by the scheduler: the CPUs and memory held
+// by the containers being created there count as used.
+type pendingNode struct {
+	cluster.Node
+	cpus, memory int64
+}
+
+func (n *pendingNode) UsedCpus() int64 {
+	return n.Node.UsedCpus() + n.cpus
+}
+
+func (n *pendingNode) UsedMemory() int64 {
+	return n.Node.UsedMemory() + n.memory
+}
+
+// view returns the `nodes` where no other reservation holds one of the host
+// `ports`, as seen by the scheduler.
+func (r *reservations) view(res *reservation, nodes []cluster.Node, ports []string) []cluster.Node {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	view := []cluster.Node{}
+	for _, node := range nodes {
+		if !r.availableLocked(res, node.ID(), ports, now) {
+			continue
+		}
+		if cpus, memory := r.pendingLocked(res, node.ID(), now); cpus > 0 || memory > 0 {
+			node = &pendingNode{Node: node, cpus: cpus, memory: memory}
+		}
+		view = append(view, node)
+	}
+	return view
+}
+
+// A placementConflict is returned when the node selected for a container was
+// taken by the placements made in the meantime. The placement can be retried.
+type placementConflict struct {
+	reason string
+}
+
+func (c *placementConflict) Error() string {
+	return c.reason
+}
+
+// allocate records that the container of `res` is placed on `node`, binding
+// the host ports and taking the CPUs and memory of `config`. It fails with a
+// *placementConflict if another reservation took them in the meantime.
+func (r *reservations) allocate(res *reservation, node cluster.Node, config *dockerclient.ContainerConfig) error {
+	defer r.flush()
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	ports := filter.HostPorts(config)
+	if !r.availableLocked(res, node.ID(), ports, now) {
+		return &placementConflict{fmt.Sprintf("the host ports %v are reserved on the node by another container", ports)}
+	}
+	// Only the containers the node had room for conflict: the strategy may
+	// overcommit on purpose.
+	cpus, memory := r.pendingLocked(res, node.ID(), now)
+	if fits(node, config, 0, 0) && !fits(node, config, cpus, memory) {
+		return &placementConflict{"the resources of the node are reserved by other containers"}
+	}
+	res.Node, res.Ports, res.Cpus, res.Memory = node.ID(), ports, config.CpuShares, config.Memory
+	r.put(res)
+	return nil
+}
+
+// unallocate drops the node, host ports and resources held by `res` once its
+// container is created, or failed to be: the node accounts for them from then
+// on. Its name is held until released.
+func (r *reservations) unallocate(res *reservation) {
+	defer r.flush()
+	r.Lock()
+	defer r.Unlock()
+
+	res.Node, res.Ports, res.Cpus, res.Memory = "", nil, 0, 0
+	if _, ok := r.byKey[res.Key]; ok {
+		r.put(res)
+	}
+	r.released.Broadcast()
+}
+
+// fits returns true if `node` has room for the container of `config` once
+// `cpus` and `memory` are taken.
+func fits(node cluster.Node, config *dockerclient.ContainerConfig, cpus, memory int64) bool {
+	return (config.CpuShares <= 0 || node.UsedCpus()+cpus+config.CpuShares <= node.TotalCpus()) &&
+		(config.Memory <= 0 || node.UsedMemory()+memory+config.Memory <= node.TotalMemory())
+}
+
+// release drops the reservations once their containers are created, or
+// failed to be.
+func (r *reservations) release(held ...*reservation) {
+	defer r.flush()
+	r.Lock()
+	defer r.Unlock()
+	r.releaseLocked(held)
+}
+
+func (r *reservations) releaseLocked(held []*reservation) {
+	for _, res := range held {
+		delete(r.byKey, res.Key)
+		r.delete(res.Key)
+	}
+	r.released.Broadcast()
+}
+
+// waitPlaced waits for the containers placed on the node `nodeID` to be
+// created, or to fail to be.
+func (r *reservations) waitPlaced(nodeID string) {
+	r.Lock()
+	defer r.Unlock()
+
+	for {
+		placed := false
+		now := time.Now()
+		for _, res := range r.byKey {
+			if res.Node == nodeID && !res.reloaded && !res.expired(now) {
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			return
+		}
+		r.released.Wait()
+	}
+}
+
+// releaseReloaded drops the reservations of the previous run on the node
+// `nodeID` as it joins: its containers are known from now on.
+func (r *reservations) releaseReloaded(nodeID string) {
+	defer r.flush()
+	r.Lock()
+	defer r.Unlock()
+
+	for key, res := range r.byKey {
+		if res.reloaded && res.Node == nodeID {
+			delete(r.byKey, key)
+			r.delete(key)
+		}
+	}
+}
+
+func (r *reservations) purge(now time.Time) {
+	for key, res := range r.byKey {
+		if res.expired(now) {
+			delete(r.byKey, key)
+			r.delete(key)
+		}
+	}
+}
+
+// put queues the write of `res` to the discovery service.
+func (r *reservations) put(res *reservation) {
+	if r.kv == nil {
+		return
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		log.WithField("name", "swarm").Errorf("Failed to persist the reservation %s: %v", res.Key, err)
+		return
+	}
+	r.writes = append(r.writes, kvWrite{key: res.Key, data: data})
+}
+
+// delete queues the removal of the reservation `key` from the discovery
+// service.
+func (r *reservations) delete(key string) {
+	if r.kv == nil {
+		return
+	}
+	r.writes = append(r.writes, kvWrite{key: key})
+}
+
+// flush makes the writes queued, once the lock is released so that a slow
+// discovery service doesn't hold up the placements. The reservations are
+// kept in memory if the writes fail: left over, they expire anyway, and
+// missing, they are only lost if the manager restarts.
+func (r *reservations) flush() {
+	r.flushing.Lock()
+	defer r.flushing.Unlock()
+
+	r.Lock()
+	writes := r.writes
+	r.writes = nil
+	r.Unlock()
+
+	for _, w := range writes {
+		var err error
+		if w.data == nil {
+			err = r.kv.Delete(reservationsBucket, w.key)
+		} else {
+			err = r.kv.Put(reservationsBucket, w.key, w.data)
+		}
+		if err != nil {
+			log.WithField("name", "swarm").Warnf("Failed to persist the reservation %s: %v", w.key, err)
+		}
+	}
+}
+
+func newReservationKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// reserveNames holds the `names` until released, failing if one of them is
+// already held or taken by a container.
+func (s *SwarmCluster) reserveNames(names ...string) ([]*reservation, error) {
+	held, err := s.reservations.reserve(names...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Checked once reserved: a container of the same name is either created
+	// by now, or can't be until released.
+	for _, name := range names {
+		if name != "" && s.Container(name) != nil {
+			s.reservations.release(held...)
+			return nil, &cluster.NameConflictError{Name: name}
+		}
+	}
+	return held, nil
+}
@@ -0,0 +1,187 @@
+package swarm
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/docker/swarm/discovery/testutil"
+	"github.com/docker/swarm/scheduler"
+	"github.com/docker/swarm/scheduler/filter"
+	"github.com/docker/swarm/scheduler/strategy"
+	"github.com/samalba/dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// bindConfig returns the config of a container binding the host `port`.
+func bindConfig(port string) *dockerclient.ContainerConfig {
+	return &dockerclient.ContainerConfig{HostConfig: dockerclient.HostConfig{
+		PortBindings: map[string][]dockerclient.PortBinding{"80/tcp": {{HostPort: port}}},
+	}}
+}
+
+func TestReservations(t *testing.T) {
+	kv := testutil.NewFakeDiscoveryService()
+	r := newReservations(kv)
+
+	held, err := r.reserve("web", "", "db")
+	assert.NoError(t, err)
+	assert.Len(t, held, 3)
+	_, err = r.reserve("cache", "db")
+	assert.EqualError(t, err, "Conflict, the name db is already in use")
+
+	// Nothing is reserved on conflict.
+	cache, err := r.reserve("cache")
+	assert.NoError(t, err)
+	values, err := kv.List(reservationsBucket)
+	assert.NoError(t, err)
+	assert.Len(t, values, 4)
+
+	// The host ports are reserved on the node only.
+	node1 := createNode(t, "node-1")
+	assert.NoError(t, r.allocate(held[0], node1, bindConfig("8000-8100")))
+	assert.False(t, r.available(held[1], "node-1", []string{"8080"}))
+	assert.True(t, r.available(held[1], "node-2", []string{"8080"}))
+	assert.True(t, r.available(held[0], "node-1", []string{"8080"}))
+	assert.Error(t, r.allocate(held[1], node1, bindConfig("8080")))
+
+	r.release(held...)
+	r.release(cache...)
+	assert.Empty(t, r.byKey)
+	values, err = kv.List(reservationsBucket)
+	assert.NoError(t, err)
+	assert.Empty(t, values)
+
+	// The reservations are still held in memory when they can't be
+	// persisted.
+	kv.SetError(errors.New("unreachable"))
+	held, err = r.reserve("web", "db")
+	assert.NoError(t, err)
+	assert.Len(t, r.byKey, 2)
+	kv.SetError(nil)
+	_, err = r.reserve("web")
+	assert.Error(t, err)
+	r.release(held...)
+	assert.Empty(t, r.byKey)
+}
+
+func TestReservationsReload(t *testing.T) {
+	kv := testutil.NewFakeDiscoveryService()
+	r := newReservations(kv)
+	held, err := r.reserve("web", "db")
+	assert.NoError(t, err)
+	assert.NoError(t, r.allocate(held[0], createNode(t, "node-1"), bindConfig("80")))
+	expired, _ := json.Marshal(&reservation{Name: "old", Expires: time.Now().Add(-time.Minute)})
+	assert.NoError(t, kv.Put(reservationsBucket, "expired", expired))
+
+	// A restarted manager reloads them.
+	reloaded := newReservations(kv)
+	assert.NoError(t, reloaded.load())
+	assert.Len(t, reloaded.byKey, 2)
+	_, err = reloaded.reserve("web")
+	assert.Error(t, err)
+	assert.False(t, reloaded.available(nil, "node-1", []string{"80"}))
+	values, err := kv.List(reservationsBucket)
+	assert.NoError(t, err)
+	assert.Len(t, values, 2)
+
+	// Until the node of the container joins.
+	reloaded.releaseReloaded("node-1")
+	assert.True(t, reloaded.available(nil, "node-1", []string{"80"}))
+	_, err = reloaded.reserve("web")
+	assert.NoError(t, err)
+	_, err = reloaded.reserve("db")
+	assert.Error(t, err)
+}
+
+func TestReserveNames(t *testing.T) {
+	node := createNode(t, "node-1", dockerclient.Container{Id: "id", Names: []string{"/db"}})
+	s := &SwarmCluster{nodes: map[string]*Node{node.id: node}, reservations: newReservations(nil)}
+
+	_, err := s.reserveNames("web", "db")
+	assert.EqualError(t, err, "Conflict, the name db is already in use")
+	assert.Empty(t, s.reservations.byKey)
+
+	held, err := s.reserveNames("web")
+	assert.NoError(t, err)
+	s.reservations.release(held...)
+}
+
+func TestReservationsResources(t *testing.T) {
+	r := newReservations(nil)
+	node := createNode(t, "node-1")
+	node.Cpus, node.Memory = 4, 1024
+	held, err := r.reserve("", "", "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.allocate(held[0], node, &dockerclient.ContainerConfig{CpuShares: 3, Memory: 512}))
+	view := r.view(held[1], []cluster.Node{node}, nil)
+	assert.Len(t, view, 1)
+	assert.Equal(t, view[0].UsedCpus(), int64(3))
+	assert.Equal(t, view[0].UsedMemory(), int64(512))
+
+	// The node has no room left for the container once the others are
+	// placed.
+	err = r.allocate(held[1], node, &dockerclient.ContainerConfig{CpuShares: 2})
+	assert.IsType(t, err, &placementConflict{})
+	assert.NoError(t, r.allocate(held[1], node, &dockerclient.ContainerConfig{CpuShares: 1, Memory: 512}))
+	// Unless it never had.
+	assert.NoError(t, r.allocate(held[2], node, &dockerclient.ContainerConfig{Memory: 2048}))
+
+	done := make(chan struct{})
+	go func() {
+		r.waitPlaced(node.id)
+		close(done)
+	}()
+	for _, res := range held {
+		r.unallocate(res)
+	}
+	<-done
+	assert.Equal(t, r.view(nil, []cluster.Node{node}, nil)[0], node)
+}
+
+func TestPlaceConcurrently(t *testing.T) {
+	binpacking, err := strategy.New("binpacking", nil)
+	assert.NoError(t, err)
+	s := &SwarmCluster{
+		nodes:        make(map[string]*Node),
+		scheduler:    scheduler.New(binpacking, []filter.Filter{}),
+		reservations: newReservations(nil),
+		placers:      make(chan struct{}, 4),
+	}
+	for _, id := range []string{"node-1", "node-2"} {
+		node := createNode(t, id)
+		node.Cpus, node.Memory = 4, 1024
+		s.nodes[id] = node
+	}
+
+	// The placements never take more than the nodes have.
+	var (
+		mu     sync.Mutex
+		placed = make(map[string]int)
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			held, err := s.reservations.reserve("")
+			assert.NoError(t, err)
+			node, err := s.place(&dockerclient.ContainerConfig{CpuShares: 1}, "", held[0])
+			assert.NoError(t, err)
+			mu.Lock()
+			placed[node.ID()]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, placed, map[string]int{"node-1": 4, "node-2": 4})
+
+	held, err := s.reservations.reserve("")
+	assert.NoError(t, err)
+	_, err = s.place(&dockerclient.ContainerConfig{CpuShares: 1}, "", held[0])
+	assert.Error(t, err)
+}
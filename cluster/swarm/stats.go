@@ -0,0 +1,228 @@
+package swarm
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// A usageSampler measures the resources actually used on a node: the
+// fraction of its CPUs busy and the bytes of memory in use.
+type usageSampler interface {
+	sample(n *Node) (cpu float64, memory int64, err error)
+}
+
+// newUsageSampler returns a sampler querying cAdvisor on `cadvisorPort` if
+// set, or the Docker engine otherwise.
+func newUsageSampler(cadvisorPort int, config *tls.Config) usageSampler {
+	if cadvisorPort > 0 {
+		return &cadvisorSampler{port: strconv.Itoa(cadvisorPort), client: &http.Client{Timeout: requestTimeout}}
+	}
+
+	scheme, client := newEngineClient(config)
+	return &engineSampler{scheme: scheme, client: client}
+}
+
+// newEngineClient returns the scheme and an HTTP client to query the engines
+// directly.
+func newEngineClient(config *tls.Config) (string, *http.Client) {
+	scheme, transport := "http", &http.Transport{}
+	if config != nil {
+		scheme, transport.TLSClientConfig = "https", config
+	}
+	return scheme, &http.Client{Transport: transport, Timeout: requestTimeout}
+}
+
+// Sample the usage of the node every `interval`, until it's disconnected.
+func (n *Node) collectStats(sampler usageSampler, interval time.Duration) {
+	for {
+		cpu, memory, err := sampler.sample(n)
+		if err != nil {
+			log.WithFields(log.Fields{"name": n.name, "id": n.id}).Errorf("Failed to sample node usage: %v", err)
+		} else {
+			n.setUsage(cpu, memory)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-n.done:
+			return
+		}
+	}
+}
+
+func (n *Node) setUsage(cpu float64, memory int64) {
+	n.Lock()
+	defer n.Unlock()
+
+	n.cpuUsage = clamp(cpu)
+	if n.Memory > 0 {
+		n.memoryUsage = clamp(float64(memory) / float64(n.Memory))
+	}
+}
+
+func clamp(usage float64) float64 {
+	if usage < 0 {
+		return 0
+	}
+	if usage > 1 {
+		return 1
+	}
+	return usage
+}
+
+// engineSampler adds up the usage of the running containers, as reported by
+// the stats endpoint of the Docker engine.
+type engineSampler struct {
+	scheme string
+	client *http.Client
+}
+
+type engineStats struct {
+	CpuStats struct {
+		CpuUsage struct {
+			TotalUsage uint64 `json:"total_usage"`
+		} `json:"cpu_usage"`
+		SystemUsage uint64 `json:"system_cpu_usage"`
+	} `json:"cpu_stats"`
+	MemoryStats struct {
+		Usage uint64 `json:"usage"`
+	} `json:"memory_stats"`
+}
+
+// Stats of the containers of a node queried at once.
+const maxContainerSamples = 8
+
+// sample adds up the usage of the containers whose stats could be read. It
+// only fails if none could.
+func (s *engineSampler) sample(n *Node) (float64, int64, error) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		cpu      float64
+		memory   int64
+		sampled  int
+		failed   error
+		samplers = make(chan struct{}, maxContainerSamples)
+	)
+
+	for _, container := range n.Containers() {
+		if !container.Info.State.Running {
+			continue
+		}
+		wg.Add(1)
+		samplers <- struct{}{}
+		go func(id string) {
+			defer wg.Done()
+			c, m, err := s.sampleContainer(n.addr, id)
+			<-samplers
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				// The container may just have stopped.
+				log.WithFields(log.Fields{"name": n.name, "id": n.id, "container": id}).Debugf("Failed to sample container usage: %v", err)
+				failed = err
+				return
+			}
+			cpu += c
+			memory += m
+			sampled++
+		}(container.Id)
+	}
+	wg.Wait()
+
+	if sampled == 0 && failed != nil {
+		return 0, 0, failed
+	}
+	return cpu, memory, nil
+}
+
+// The engine streams the stats of a container every second: the CPU usage is
+// computed from the first two samples.
+func (s *engineSampler) sampleContainer(addr, id string) (float64, int64, error) {
+	resp, err := s.client.Get(fmt.Sprintf("%s://%s/containers/%s/stats", s.scheme, addr, id))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("stats of container %s: %s", id, resp.Status)
+	}
+
+	var first, second engineStats
+	decoder := json.NewDecoder(resp.Body)
+	if err := decoder.Decode(&first); err != nil {
+		return 0, 0, err
+	}
+	if err := decoder.Decode(&second); err != nil {
+		return 0, 0, err
+	}
+
+	// The system usage adds up all the CPUs of the node.
+	var cpu float64
+	if second.CpuStats.SystemUsage > first.CpuStats.SystemUsage {
+		system := second.CpuStats.SystemUsage - first.CpuStats.SystemUsage
+		cpu = float64(second.CpuStats.CpuUsage.TotalUsage-first.CpuStats.CpuUsage.TotalUsage) / float64(system)
+	}
+	return cpu, int64(second.MemoryStats.Usage), nil
+}
+
+// cadvisorSampler reads the usage of the whole machine, including the
+// workloads not running in containers, from cAdvisor.
+type cadvisorSampler struct {
+	port   string
+	client *http.Client
+}
+
+type cadvisorContainerInfo struct {
+	Stats []struct {
+		Timestamp time.Time `json:"timestamp"`
+		Cpu       struct {
+			Usage struct {
+				Total uint64 `json:"total"`
+			} `json:"usage"`
+		} `json:"cpu"`
+		Memory struct {
+			WorkingSet uint64 `json:"working_set"`
+		} `json:"memory"`
+	} `json:"stats"`
+}
+
+func (s *cadvisorSampler) sample(n *Node) (float64, int64, error) {
+	resp, err := s.client.Get("http://" + net.JoinHostPort(n.ip, s.port) + "/api/v1.3/containers/")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("cAdvisor: %s", resp.Status)
+	}
+
+	info := &cadvisorContainerInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return 0, 0, err
+	}
+	if len(info.Stats) < 2 {
+		return 0, 0, fmt.Errorf("cAdvisor: not enough samples")
+	}
+
+	var (
+		first   = info.Stats[len(info.Stats)-2]
+		last    = info.Stats[len(info.Stats)-1]
+		elapsed = last.Timestamp.Sub(first.Timestamp)
+		cpu     float64
+	)
+	// The CPU usage is the time spent on all the CPUs, in nanoseconds.
+	if elapsed > 0 && n.Cpus > 0 && last.Cpu.Usage.Total > first.Cpu.Usage.Total {
+		cpu = float64(last.Cpu.Usage.Total-first.Cpu.Usage.Total) / float64(elapsed.Nanoseconds()) / float64(n.Cpus)
+	}
+	return cpu, int64(last.Memory.WorkingSet), nil
+}
@@ -0,0 +1,88 @@
+package swarm
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samalba/dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngineSampler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/running/stats" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintln(w, `{"cpu_stats":{"cpu_usage":{"total_usage":100},"system_cpu_usage":1000},"memory_stats":{"usage":10}}`)
+		fmt.Fprintln(w, `{"cpu_stats":{"cpu_usage":{"total_usage":350},"system_cpu_usage":2000},"memory_stats":{"usage":50}}`)
+	}))
+	defer server.Close()
+
+	node := createNode(t, "node", dockerclient.Container{Id: "running"}, dockerclient.Container{Id: "stopped"})
+	node.addr = strings.TrimPrefix(server.URL, "http://")
+	node.Memory = 100
+	node.containers["running"].Info.State.Running = true
+
+	cpu, memory, err := newUsageSampler(0, nil).sample(node)
+	assert.NoError(t, err)
+	assert.Equal(t, cpu, 0.25)
+	assert.Equal(t, memory, int64(50))
+
+	node.setUsage(cpu, memory)
+	assert.Equal(t, node.CpuUsage(), 0.25)
+	assert.Equal(t, node.MemoryUsage(), 0.5)
+
+	// The containers whose stats fail are skipped.
+	node.containers["stopped"].Info.State.Running = true
+	cpu, memory, err = newUsageSampler(0, nil).sample(node)
+	assert.NoError(t, err)
+	assert.Equal(t, cpu, 0.25)
+	assert.Equal(t, memory, int64(50))
+
+	// Unless all of them do.
+	node.containers["running"].Info.State.Running = false
+	_, _, err = newUsageSampler(0, nil).sample(node)
+	assert.Error(t, err)
+}
+
+func TestCadvisorSampler(t *testing.T) {
+	now := time.Now()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/api/v1.3/containers/")
+		fmt.Fprintf(w, `{"stats":[
+			{"timestamp":%q,"cpu":{"usage":{"total":0}},"memory":{"working_set":10}},
+			{"timestamp":%q,"cpu":{"usage":{"total":1000000000}},"memory":{"working_set":20}},
+			{"timestamp":%q,"cpu":{"usage":{"total":2000000000}},"memory":{"working_set":30}}
+		]}`, now.Add(-2*time.Second).Format(time.RFC3339Nano), now.Add(-time.Second).Format(time.RFC3339Nano), now.Format(time.RFC3339Nano))
+	}))
+	defer server.Close()
+
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	assert.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	assert.NoError(t, err)
+
+	node := createNode(t, "node")
+	node.ip = host
+	node.Cpus = 4
+
+	cpu, memory, err := newUsageSampler(p, nil).sample(node)
+	assert.NoError(t, err)
+	assert.Equal(t, cpu, 0.25)
+	assert.Equal(t, memory, int64(30))
+}
+
+func TestUsageIsClamped(t *testing.T) {
+	node := createNode(t, "node")
+	node.Memory = 10
+	node.setUsage(1.5, 20)
+	assert.Equal(t, node.CpuUsage(), 1.0)
+	assert.Equal(t, node.MemoryUsage(), 1.0)
+}
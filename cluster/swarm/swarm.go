@@ -2,17 +2,40 @@ package swarm
 
 import (
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/docker/pkg/units"
 	"github.com/docker/swarm/cluster"
 	"github.com/docker/swarm/discovery"
+	"github.com/docker/swarm/metrics"
 	"github.com/docker/swarm/scheduler"
+	"github.com/docker/swarm/scheduler/filter"
 	"github.com/docker/swarm/state"
 	"github.com/samalba/dockerclient"
 )
 
+// Containers started with this in their environment are recreated on another
+// node when theirs disappears from the discovery service.
+const rescheduleOnNodeFailure = "reschedule:on-node-failure"
+
+// Containers started with this in their environment run on every node of the
+// cluster, including the nodes joining later.
+const globalScheduling = "com.docker.swarm.global=true"
+
+const (
+	// Default number of placements evaluated at the same time.
+	defaultSchedulerWorkers = 16
+
+	// Number of times a placement is tried when concurrent ones take the
+	// nodes selected.
+	maxPlacementAttempts = 5
+)
+
+var placementConflicts = metrics.NewCounter("swarm_scheduler_placement_conflicts_total", "Placements retried as concurrent ones took the node selected.")
+
 type SwarmCluster struct {
 	sync.RWMutex
 
@@ -21,6 +44,18 @@ type SwarmCluster struct {
 	scheduler    *scheduler.Scheduler
 	options      *cluster.Options
 	store        *state.Store
+	sampler      usageSampler
+	health       *healthChecker
+	refresher    *refresher
+	puller       *imagePuller
+	engineAPI    *engineAPI
+	reservations *reservations
+	// Bounds the placements evaluated at the same time.
+	placers chan struct{}
+	// IDs of the drained nodes, drained again when they reconnect.
+	drained map[string]bool
+	// Persists the drained nodes, if the discovery service can store values.
+	kv discovery.KVService
 }
 
 func NewCluster(scheduler *scheduler.Scheduler, store *state.Store, eventhandler cluster.EventHandler, options *cluster.Options) cluster.Cluster {
@@ -32,14 +67,36 @@ func NewCluster(scheduler *scheduler.Scheduler, store *state.Store, eventhandler
 		scheduler:    scheduler,
 		options:      options,
 		store:        store,
+		refresher:    newRefresher(options),
+		puller:       newImagePuller(options.TLSConfig),
+		engineAPI:    newEngineAPI(options.TLSConfig),
+		reservations: newReservations(nil),
+	}
+	workers := options.SchedulerWorkers
+	if workers < 1 {
+		workers = defaultSchedulerWorkers
+	}
+	cluster.placers = make(chan struct{}, workers)
+	if kv, ok := discovery.Primary(options.Discovery).(discovery.KVService); ok {
+		cluster.reservations = newReservations(kv)
+		if err := cluster.reservations.load(); err != nil {
+			log.WithField("name", "swarm").Errorf("Failed to reload the reservations: %v", err)
+		}
+		cluster.kv = kv
+		if err := cluster.loadDrained(); err != nil {
+			log.WithField("name", "swarm").Errorf("Failed to reload the drained nodes: %v", err)
+		}
+	}
+	if options.StatsInterval > 0 {
+		cluster.sampler = newUsageSampler(options.StatsCadvisorPort, options.TLSConfig)
+	}
+	if options.HealthInterval > 0 {
+		cluster.health = newHealthChecker(options)
 	}
 
 	// get the list of entries from the discovery service
 	go func() {
-		d, err := discovery.New(options.Discovery, options.Heartbeat)
-		if err != nil {
-			log.Fatal(err)
-		}
+		d := options.Discovery
 
 		entries, err := d.Fetch()
 		if err != nil {
@@ -64,15 +121,39 @@ func (s *SwarmCluster) Handle(e *cluster.Event) error {
 
 // Schedule a brand new container into the cluster.
 func (s *SwarmCluster) CreateContainer(config *dockerclient.ContainerConfig, name string) (*cluster.Container, error) {
+	held, err := s.reserveNames(name)
+	if err != nil {
+		return nil, err
+	}
+	defer s.reservations.release(held...)
 
-	s.RLock()
-	defer s.RUnlock()
+	return s.create(config, name, held[0])
+}
+
+// create schedules a new container, whose name is held by `res` or taken over
+// from a container being replaced if `res` is nil.
+func (s *SwarmCluster) create(config *dockerclient.ContainerConfig, name string, res *reservation) (*cluster.Container, error) {
+	if res == nil {
+		held, err := s.reservations.reserve("")
+		if err != nil {
+			return nil, err
+		}
+		defer s.reservations.release(held...)
+		res = held[0]
+	}
+
+	if hasEnv(config, globalScheduling) {
+		return s.createGlobalContainer(config, name, res)
+	}
 
-	node, err := s.scheduler.SelectNodeForContainer(s.listNodes(), config)
+	node, err := s.place(config, name, res)
 	if err != nil {
 		return nil, err
 	}
 
+	// The container is created on the engine outside of the lock: its
+	// resources are held by `res` until then.
+	defer s.reservations.unallocate(res)
 	if n, ok := node.(*Node); ok {
 		container, err := n.Create(config, name, true)
 		if err != nil {
@@ -90,6 +171,186 @@ func (s *SwarmCluster) CreateContainer(config *dockerclient.ContainerConfig, nam
 	return nil, nil
 }
 
+// place selects the node of the container and holds its host ports and
+// resources there in `res`. The placements run concurrently, each one against
+// the resources held by the others, and are retried if a concurrent one took
+// the node selected in the meantime.
+func (s *SwarmCluster) place(config *dockerclient.ContainerConfig, name string, res *reservation) (cluster.Node, error) {
+	s.placers <- struct{}{}
+	defer func() { <-s.placers }()
+
+	// Held for the drained nodes not to be selected once DrainNode takes
+	// the lock.
+	s.RLock()
+	defer s.RUnlock()
+
+	ports := filter.HostPorts(config)
+	for attempt := 1; ; attempt++ {
+		node, err := s.scheduler.SelectNodeForContainer(s.reservations.view(res, s.schedulableNodesLocked(), ports), config, name)
+		if err != nil {
+			return nil, err
+		}
+		if pending, ok := node.(*pendingNode); ok {
+			node = pending.Node
+		}
+
+		err = s.reservations.allocate(res, node, config)
+		if err == nil {
+			return node, nil
+		}
+		if _, ok := err.(*placementConflict); !ok {
+			return nil, err
+		}
+		if attempt == maxPlacementAttempts {
+			return nil, fmt.Errorf("unable to place the container after %d attempts: %v", attempt, err)
+		}
+		placementConflicts.Inc()
+		log.WithFields(log.Fields{"name": node.Name(), "container": name}).Debugf("Retrying the placement: %v", err)
+	}
+}
+
+// PlaceDryRun returns how the container would be scheduled, without creating
+// anything.
+func (s *SwarmCluster) PlaceDryRun(config *dockerclient.ContainerConfig, name string) *cluster.Decision {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.scheduler.Explain(s.schedulableNodesLocked(), config, name, hasEnv(config, globalScheduling))
+}
+
+// createGlobalContainer creates and starts an instance of the container on
+// every node accepted by the filters, and returns the first one. The nodes are
+// selected with the lock held, each instance holding its host ports and
+// resources in a reservation of its own, and the instances are created in
+// parallel once it is released. They share the key of `res` as global ID.
+func (s *SwarmCluster) createGlobalContainer(config *dockerclient.ContainerConfig, name string, res *reservation) (*cluster.Container, error) {
+	s.RLock()
+	nodes, err := s.scheduler.SelectNodesForGlobalContainer(s.reservations.view(res, s.schedulableNodesLocked(), filter.HostPorts(config)), config, name)
+	if err != nil {
+		s.RUnlock()
+		return nil, err
+	}
+	held, err := s.reservations.reserve(make([]string, len(nodes))...)
+	if err != nil {
+		s.RUnlock()
+		return nil, err
+	}
+	defer s.reservations.release(held...)
+
+	placed := make([]*Node, len(nodes))
+	for i, node := range nodes {
+		if pending, ok := node.(*pendingNode); ok {
+			node = pending.Node
+		}
+		n, ok := node.(*Node)
+		if !ok {
+			continue
+		}
+		if err := s.reservations.allocate(held[i], n, config); err != nil {
+			log.WithFields(log.Fields{"name": n.name, "id": n.id}).Errorf("Failed to create global container: %v", err)
+			continue
+		}
+		placed[i] = n
+	}
+	s.RUnlock()
+
+	var (
+		wg        sync.WaitGroup
+		instances = make([]*cluster.Container, len(nodes))
+	)
+	for i, n := range placed {
+		if n == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, n *Node) {
+			defer wg.Done()
+			defer s.reservations.unallocate(held[i])
+
+			container, err := s.createInstance(n, config, name, res.Key)
+			if err != nil {
+				// Keep going, the other nodes can still run it.
+				log.WithFields(log.Fields{"name": n.name, "id": n.id}).Errorf("Failed to create global container: %v", err)
+			}
+			instances[i] = container
+		}(i, n)
+	}
+	wg.Wait()
+
+	for _, container := range instances {
+		if container != nil {
+			return container, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to create the global container on any node")
+}
+
+// createInstance creates and starts an instance of the global container
+// `globalID` on `n`. The instance is returned if it was created, even if it
+// failed to start.
+func (s *SwarmCluster) createInstance(n *Node, config *dockerclient.ContainerConfig, name, globalID string) (*cluster.Container, error) {
+	container, err := n.Create(config, name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &state.RequestedState{
+		ID:       container.Id,
+		Name:     name,
+		Config:   config,
+		GlobalID: globalID,
+	}
+	if err := s.store.Add(container.Id, st); err != nil {
+		return container, err
+	}
+	// Nobody starts the instances but the first one otherwise: the client
+	// only knows of it, and the nodes joining later are on their own.
+	if err := startContainer(container); err != nil {
+		return container, fmt.Errorf("unable to start the instance %s: %v", container.Id, err)
+	}
+	if refreshed := n.Container(container.Id); refreshed != nil {
+		container = refreshed
+	}
+	return container, nil
+}
+
+// startGlobalContainers creates on `n` an instance of each global container it
+// doesn't run yet.
+func (s *SwarmCluster) startGlobalContainers(n *Node) {
+	// Every replica sees the node joining, only the primary starts the
+	// instances.
+	if n.IsDrained() || !s.isLeader() {
+		return
+	}
+
+	globals := make(map[string]*state.RequestedState)
+	for _, st := range s.store.All() {
+		if st.GlobalID != "" {
+			globals[st.GlobalID] = st
+		}
+	}
+	for _, container := range n.Containers() {
+		if st, err := s.store.Get(container.Id); err == nil {
+			delete(globals, st.GlobalID)
+		}
+	}
+
+	for globalID, st := range globals {
+		// The node must be acceptable for the container.
+		if nodes, err := s.scheduler.SelectNodesForGlobalContainer([]cluster.Node{n}, st.Config, st.Name); err != nil || len(nodes) == 0 {
+			continue
+		}
+
+		fields := log.Fields{"name": n.name, "id": n.id, "global": globalID}
+		container, err := s.createInstance(n, st.Config, st.Name, globalID)
+		if err != nil {
+			log.WithFields(fields).Errorf("Failed to start global container: %v", err)
+			continue
+		}
+		log.WithFields(fields).Infof("Global container started as %s", container.Id)
+	}
+}
+
 // Remove a container from the cluster. Containers should always be destroyed
 // through the scheduler to guarantee atomicity.
 func (s *SwarmCluster) RemoveContainer(container *cluster.Container, force bool) error {
@@ -112,12 +373,65 @@ func (s *SwarmCluster) RemoveContainer(container *cluster.Container, force bool)
 	return nil
 }
 
+// RemoveGlobalContainer removes all the instances of the global container
+// `container` is one of. The instances of the nodes gone are forgotten, so
+// that they are not started again when the nodes come back.
+func (s *SwarmCluster) RemoveGlobalContainer(container *cluster.Container, force bool) error {
+	st, err := s.store.Get(container.Id)
+	if err != nil || st.GlobalID == "" {
+		return fmt.Errorf("%s is not a global container", container.Id)
+	}
+
+	errs := []string{}
+	for _, other := range s.store.All() {
+		if other.GlobalID != st.GlobalID {
+			continue
+		}
+		if instance := s.Container(other.ID); instance != nil {
+			err = s.RemoveContainer(instance, force)
+		} else {
+			err = s.store.Remove(other.ID)
+		}
+		if err != nil && err != state.ErrNotFound {
+			errs = append(errs, fmt.Sprintf("%s: %v", other.ID, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to remove the global container %s: %s", st.GlobalID, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 // Entries are Docker Nodes
 func (s *SwarmCluster) newEntries(entries []*discovery.Entry) {
+	// Nodes which are no longer part of the discovery are gone.
+	present := make(map[string]bool)
+	for _, entry := range entries {
+		present[entry.String()] = true
+	}
+	s.Lock()
+	for id, node := range s.nodes {
+		if !present[node.addr] {
+			delete(s.nodes, id)
+			go s.removeNode(node)
+		}
+	}
+	s.Unlock()
+
 	for _, entry := range entries {
 		go func(m *discovery.Entry) {
-			if s.getNode(m.String()) == nil {
+			s.RLock()
+			node := s.getNode(m.String())
+			s.RUnlock()
+
+			if node != nil {
+				node.SetMetadata(m.Metadata)
+			} else {
 				n := NewNode(m.String(), s.options.OvercommitRatio)
+				n.SetMetadata(m.Metadata)
+				n.probed = s.health != nil
+				n.refresher = s.refresher
+				n.engineAPI = s.engineAPI
 				if err := n.Connect(s.options.TLSConfig); err != nil {
 					log.Error(err)
 					return
@@ -133,6 +447,10 @@ func (s *SwarmCluster) newEntries(entries []*discovery.Entry) {
 					}
 					return
 				}
+				// Before any container can be placed on it.
+				if s.drained[n.id] {
+					n.setDrained(true)
+				}
 				s.nodes[n.id] = n
 				if err := n.Events(s); err != nil {
 					log.Error(err)
@@ -140,12 +458,121 @@ func (s *SwarmCluster) newEntries(entries []*discovery.Entry) {
 					return
 				}
 				s.Unlock()
+				s.reservations.releaseReloaded(n.id)
+				n.reportHealth()
+
+				if s.sampler != nil {
+					go n.collectStats(s.sampler, s.options.StatsInterval)
+				}
+				if s.health != nil {
+					go n.checkHealth(s.health)
+				}
+
+				s.startGlobalContainers(n)
 
 			}
 		}(entry)
 	}
 }
 
+// removeNode disconnects a node which was removed from the cluster and, if it
+// is dead, reschedules the containers asking for it.
+func (s *SwarmCluster) removeNode(n *Node) {
+	fields := log.Fields{"name": n.name, "id": n.id}
+	log.WithFields(fields).Info("Node left the cluster")
+	// A node can leave the discovery service while its engine keeps running
+	// its containers: they are only rescheduled if it fails its health
+	// check, and by the primary only.
+	dead := !n.IsHealthy() || n.ping() != nil
+	n.Disconnect()
+	n.emitEvent("node_remove")
+	nodeHealthy.Delete(n.name, n.addr)
+
+	if !dead {
+		log.WithFields(fields).Info("The engine of the node still answers, its containers are not rescheduled")
+		return
+	}
+	if !s.isLeader() {
+		return
+	}
+	for _, container := range n.Containers() {
+		if shouldReschedule(container) {
+			s.rescheduleContainer(container)
+		}
+	}
+}
+
+// isLeader returns true if this manager is the primary one, or the only one.
+func (s *SwarmCluster) isLeader() bool {
+	return s.options == nil || s.options.IsLeader == nil || s.options.IsLeader()
+}
+
+func shouldReschedule(container *cluster.Container) bool {
+	// Global containers already run on the other nodes.
+	return hasEnv(container.Info.Config, rescheduleOnNodeFailure) && !hasEnv(container.Info.Config, globalScheduling)
+}
+
+func hasEnv(config *dockerclient.ContainerConfig, value string) bool {
+	if config == nil {
+		return false
+	}
+	for _, env := range config.Env {
+		if env == value {
+			return true
+		}
+	}
+	return false
+}
+
+// rescheduleContainer recreates `container` on one of the remaining nodes,
+// and starts the copy if the original was running.
+func (s *SwarmCluster) rescheduleContainer(container *cluster.Container) (*cluster.Container, error) {
+	config, name := container.Info.Config, ""
+	if len(container.Names) > 0 {
+		name = strings.TrimPrefix(container.Names[0], "/")
+	}
+	// Prefer the configuration originally requested.
+	if st, err := s.store.Get(container.Id); err == nil {
+		config, name = st.Config, st.Name
+	}
+
+	fields := log.Fields{"id": container.Id, "name": name, "node": container.Node.Name()}
+	newContainer, err := s.create(config, name, nil)
+	if err != nil {
+		log.WithFields(fields).Errorf("Failed to reschedule container: %v", err)
+		s.emitContainerEvent("reschedule_failed", container)
+		return nil, err
+	}
+	if err := s.store.Remove(container.Id); err != nil && err != state.ErrNotFound {
+		log.WithFields(fields).Error(err)
+	}
+
+	log.WithFields(fields).Infof("Container rescheduled as %s on %s", newContainer.Id, newContainer.Node.Name())
+	s.emitContainerEvent("reschedule", newContainer)
+	if container.Info.State.Running {
+		if err := startContainer(newContainer); err != nil {
+			log.WithFields(fields).Errorf("Failed to start the rescheduled container %s: %v", newContainer.Id, err)
+			return newContainer, err
+		}
+		if refreshed := newContainer.Node.Container(newContainer.Id); refreshed != nil {
+			newContainer = refreshed
+		}
+	}
+	return newContainer, nil
+}
+
+func (s *SwarmCluster) emitContainerEvent(event string, container *cluster.Container) {
+	s.Handle(&cluster.Event{
+		Event: dockerclient.Event{
+			Status: event,
+			Id:     container.Id,
+			From:   "swarm",
+			Time:   time.Now().Unix(),
+		},
+		Node: container.Node,
+	})
+}
+
 func (s *SwarmCluster) getNode(addr string) *Node {
 	for _, node := range s.nodes {
 		if node.addr == addr {
@@ -217,11 +644,33 @@ func (s *SwarmCluster) Container(IdOrName string) *cluster.Container {
 	return nil
 }
 
+// Nodes returns all the nodes in the cluster.
+func (s *SwarmCluster) Nodes() []cluster.Node {
+	return s.listNodes()
+}
+
+// schedulableNodesLocked returns the nodes new containers can be placed on.
+// The lock must be held.
+func (s *SwarmCluster) schedulableNodesLocked() []cluster.Node {
+	out := []cluster.Node{}
+	for _, n := range s.listNodesLocked() {
+		if !n.IsDrained() {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
 // nodes returns all the nodess in the cluster.
 func (s *SwarmCluster) listNodes() []cluster.Node {
 	s.RLock()
 	defer s.RUnlock()
+	return s.listNodesLocked()
+}
 
+// listNodesLocked is listNodes, the lock being held: taking the read lock
+// twice would deadlock if a writer were waiting in between.
+func (s *SwarmCluster) listNodesLocked() []cluster.Node {
 	out := []cluster.Node{}
 	for _, n := range s.nodes {
 		out = append(out, n)
@@ -231,6 +680,9 @@ func (s *SwarmCluster) listNodes() []cluster.Node {
 }
 
 func (s *SwarmCluster) Info() [][2]string {
+	s.RLock()
+	defer s.RUnlock()
+
 	info := [][2]string{{"\bNodes", fmt.Sprintf("%d", len(s.nodes))}}
 
 	for _, node := range s.nodes {
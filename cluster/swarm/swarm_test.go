@@ -1,11 +1,21 @@
 package swarm
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/docker/swarm/cluster"
+	"github.com/docker/swarm/discovery"
+	"github.com/docker/swarm/scheduler"
+	"github.com/docker/swarm/scheduler/filter"
+	"github.com/docker/swarm/scheduler/strategy"
+	"github.com/docker/swarm/state"
 	"github.com/samalba/dockerclient"
+	"github.com/samalba/dockerclient/mockclient"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func createNode(t *testing.T, ID string, containers ...dockerclient.Container) *Node {
@@ -46,3 +56,272 @@ func TestContainerLookup(t *testing.T) {
 	assert.NotNil(t, s.Container("test-node/container-name1"))
 	assert.NotNil(t, s.Container("test-node/container-name2"))
 }
+
+type eventRecorder struct {
+	events []*cluster.Event
+}
+
+func (r *eventRecorder) Handle(e *cluster.Event) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestRemovedNodes(t *testing.T) {
+	s := &SwarmCluster{
+		nodes: make(map[string]*Node),
+	}
+	s.nodes["node-1"] = createNode(t, "node-1")
+	s.nodes["node-2"] = createNode(t, "node-2")
+
+	entry, err := discovery.NewEntry("node-2:2375")
+	assert.NoError(t, err)
+	s.nodes["node-2"].addr = entry.String()
+
+	s.newEntries([]*discovery.Entry{entry})
+	s.RLock()
+	assert.Len(t, s.nodes, 1)
+	assert.NotNil(t, s.nodes["node-2"])
+	s.RUnlock()
+}
+
+func TestRescheduleOnNodeFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := state.NewStore(dir)
+	assert.NoError(t, store.Initialize())
+
+	random, err := strategy.New("random", nil)
+	assert.NoError(t, err)
+	events := &eventRecorder{}
+	s := &SwarmCluster{
+		eventHandler: events,
+		nodes:        make(map[string]*Node),
+		scheduler:    scheduler.New(random, []filter.Filter{}),
+		store:        store,
+		reservations: newReservations(nil),
+		placers:      make(chan struct{}, defaultSchedulerWorkers),
+	}
+
+	config := &dockerclient.ContainerConfig{Image: "busybox", Env: []string{rescheduleOnNodeFailure}}
+	failed := createNode(t, "failed",
+		dockerclient.Container{Id: "rescheduled", Names: []string{"/app"}},
+		dockerclient.Container{Id: "lost", Names: []string{"/other"}},
+	)
+	failed.containers["rescheduled"].Info.Config = config
+	failed.containers["rescheduled"].Info.State.Running = true
+	failed.containers["lost"].Info.Config = &dockerclient.ContainerConfig{Image: "busybox"}
+	assert.NoError(t, store.Add("rescheduled", &state.RequestedState{ID: "rescheduled", Name: "app", Config: config}))
+
+	healthy := NewNode("healthy", 0)
+	client := mockclient.NewMockClient()
+	client.On("Info").Return(mockInfo, nil)
+	client.On("Version").Return(mockVersion, nil)
+	client.On("StartMonitorEvents", mock.Anything, mock.Anything, mock.Anything).Return()
+	client.On("ListContainers", true, false, "").Return([]dockerclient.Container{}, nil).Once()
+	client.On("ListImages").Return([]*dockerclient.Image{}, nil).Once()
+	assert.NoError(t, healthy.connectClient(client))
+	s.nodes[healthy.id] = healthy
+
+	client.On("CreateContainer", mock.Anything, "app").Return("new", nil).Once()
+	client.On("ListContainers", true, false, fmt.Sprintf(`{"id":[%q]}`, "new")).Return([]dockerclient.Container{{Id: "new"}}, nil).Once()
+	client.On("InspectContainer", "new").Return(&dockerclient.ContainerInfo{Config: config}, nil).Once()
+	// It was running, so is its copy.
+	expectStart(client, config, "new")
+
+	s.removeNode(failed)
+	client.AssertExpectations(t)
+
+	assert.Len(t, healthy.Containers(), 1)
+
+	// The placement is audited.
+	decisions := s.scheduler.AuditLog().Decisions("app", 0)
+	assert.Len(t, decisions, 1)
+	assert.Equal(t, decisions[0].Considered, []string{healthy.Name()})
+	assert.Equal(t, decisions[0].Selected, []string{healthy.Name()})
+	assert.Equal(t, decisions[0].Strategy, "random")
+	assert.NotNil(t, healthy.Container("new"))
+	assert.True(t, healthy.Container("new").Info.State.Running)
+
+	_, err = store.Get("rescheduled")
+	assert.Equal(t, err, state.ErrNotFound)
+	_, err = store.Get("new")
+	assert.NoError(t, err)
+
+	assert.Len(t, events.events, 1)
+	assert.Equal(t, events.events[0].Status, "reschedule")
+	assert.Equal(t, events.events[0].Id, "new")
+	assert.Equal(t, events.events[0].Node, healthy)
+}
+
+func TestRescheduleOnlyDeadNodesOnPrimary(t *testing.T) {
+	config := &dockerclient.ContainerConfig{Image: "busybox", Env: []string{rescheduleOnNodeFailure}}
+	s := &SwarmCluster{
+		nodes:        make(map[string]*Node),
+		reservations: newReservations(nil),
+		placers:      make(chan struct{}, defaultSchedulerWorkers),
+	}
+	// No container can be created on it.
+	other, _ := connectMockNode(t, "other")
+	s.nodes[other.id] = other
+
+	// The engine of the node still answers.
+	left, client := connectMockNode(t, "left")
+	client.On("StopAllMonitorEvents").Return()
+	left.AddContainer(&cluster.Container{Container: dockerclient.Container{Id: "app"}, Info: dockerclient.ContainerInfo{Config: config}, Node: left})
+	s.removeNode(left)
+
+	// Replicas leave the dead nodes to the primary.
+	s.options = &cluster.Options{IsLeader: func() bool { return false }}
+	dead := createNode(t, "dead")
+	dead.AddContainer(&cluster.Container{Container: dockerclient.Container{Id: "app"}, Info: dockerclient.ContainerInfo{Config: config}, Node: dead})
+	s.removeNode(dead)
+	assert.Empty(t, other.Containers())
+}
+
+func connectMockNode(t *testing.T, id string) (*Node, *mockclient.MockClient) {
+	node := NewNode(id, 0)
+	client := mockclient.NewMockClient()
+	client.On("Info").Return(mockInfo, nil)
+	client.On("Version").Return(mockVersion, nil)
+	client.On("StartMonitorEvents", mock.Anything, mock.Anything, mock.Anything).Return()
+	client.On("ListContainers", true, false, "").Return([]dockerclient.Container{}, nil).Once()
+	client.On("ListImages").Return([]*dockerclient.Image{}, nil).Once()
+	assert.NoError(t, node.connectClient(client))
+	node.id, node.name = id, id
+	return node, client
+}
+
+func expectCreate(client *mockclient.MockClient, config *dockerclient.ContainerConfig, id string) {
+	client.On("CreateContainer", mock.Anything, "agent").Return(id, nil).Once()
+	client.On("ListContainers", true, false, fmt.Sprintf(`{"id":[%q]}`, id)).Return([]dockerclient.Container{{Id: id}}, nil).Once()
+	// A copy, as the engine returns: the nodes update the configs inspected.
+	inspected := *config
+	client.On("InspectContainer", id).Return(&dockerclient.ContainerInfo{Config: &inspected}, nil).Once()
+}
+
+// expectStart mocks the start of the container `id`, and its refresh.
+func expectStart(client *mockclient.MockClient, config *dockerclient.ContainerConfig, id string) {
+	client.On("StartContainer", id, mock.Anything).Return(nil).Once()
+	client.On("ListContainers", true, false, fmt.Sprintf(`{"id":[%q]}`, id)).Return([]dockerclient.Container{{Id: id, Status: "Up 1 second"}}, nil).Once()
+	inspected := *config
+	info := &dockerclient.ContainerInfo{Config: &inspected}
+	info.State.Running = true
+	client.On("InspectContainer", id).Return(info, nil).Once()
+}
+
+func TestGlobalContainer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := state.NewStore(dir)
+	assert.NoError(t, store.Initialize())
+
+	random, err := strategy.New("random", nil)
+	assert.NoError(t, err)
+	s := &SwarmCluster{
+		nodes:        make(map[string]*Node),
+		reservations: newReservations(nil),
+		placers:      make(chan struct{}, defaultSchedulerWorkers),
+		scheduler:    scheduler.New(random, []filter.Filter{}),
+		store:        store,
+	}
+
+	config := &dockerclient.ContainerConfig{Image: "busybox", Env: []string{globalScheduling}}
+	node1, client1 := connectMockNode(t, "node-1")
+	node2, client2 := connectMockNode(t, "node-2")
+	s.nodes[node1.id] = node1
+	s.nodes[node2.id] = node2
+
+	// An instance is created and started on every node.
+	expectCreate(client1, config, "instance-1")
+	expectStart(client1, config, "instance-1")
+	expectCreate(client2, config, "instance-2")
+	expectStart(client2, config, "instance-2")
+	container, err := s.CreateContainer(config, "agent")
+	assert.NoError(t, err)
+	client1.AssertExpectations(t)
+	client2.AssertExpectations(t)
+	assert.True(t, node1.Container("instance-1").Info.State.Running)
+	assert.True(t, node2.Container("instance-2").Info.State.Running)
+
+	st1, err := store.Get("instance-1")
+	assert.NoError(t, err)
+	st2, err := store.Get("instance-2")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, st1.GlobalID)
+	assert.Equal(t, st1.GlobalID, st2.GlobalID)
+	assert.Contains(t, []string{"instance-1", "instance-2"}, container.Id)
+
+	// A node joining later gets its own instance.
+	node3, client3 := connectMockNode(t, "node-3")
+	expectCreate(client3, config, "instance-3")
+	expectStart(client3, config, "instance-3")
+	s.startGlobalContainers(node3)
+	client3.AssertExpectations(t)
+	assert.True(t, node3.Container("instance-3").Info.State.Running)
+
+	// But the nodes already running one don't.
+	s.startGlobalContainers(node1)
+	assert.Len(t, node1.Containers(), 1)
+
+	// Replicas leave the nodes joining to the primary.
+	s.options = &cluster.Options{IsLeader: func() bool { return false }}
+	node4, _ := connectMockNode(t, "node-4")
+	s.startGlobalContainers(node4)
+	assert.Empty(t, node4.Containers())
+
+	// Removing the global container removes all its instances, forgetting the
+	// one of the node gone.
+	client1.On("RemoveContainer", "instance-1", true, true).Return(nil).Once()
+	client2.On("RemoveContainer", "instance-2", true, true).Return(nil).Once()
+	assert.NoError(t, s.RemoveGlobalContainer(node2.Container("instance-2"), true))
+	client1.AssertExpectations(t)
+	client2.AssertExpectations(t)
+	assert.Empty(t, store.All())
+	assert.Error(t, s.RemoveGlobalContainer(&cluster.Container{Container: dockerclient.Container{Id: "other"}}, true))
+
+	// Global containers aren't rescheduled.
+	assert.False(t, shouldReschedule(&cluster.Container{Info: dockerclient.ContainerInfo{Config: &dockerclient.ContainerConfig{Env: []string{globalScheduling, rescheduleOnNodeFailure}}}}))
+}
+
+func TestGlobalContainerReservations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := state.NewStore(dir)
+	assert.NoError(t, store.Initialize())
+
+	random, err := strategy.New("random", nil)
+	assert.NoError(t, err)
+	s := &SwarmCluster{
+		nodes:        make(map[string]*Node),
+		reservations: newReservations(nil),
+		placers:      make(chan struct{}, defaultSchedulerWorkers),
+		scheduler:    scheduler.New(random, []filter.Filter{}),
+		store:        store,
+	}
+	node1, client1 := connectMockNode(t, "node-1")
+	node2, _ := connectMockNode(t, "node-2")
+	s.nodes[node1.id] = node1
+	s.nodes[node2.id] = node2
+
+	// A container being placed on node-2 holds its host port.
+	config := &dockerclient.ContainerConfig{Image: "busybox", Env: []string{globalScheduling}}
+	config.HostConfig.PortBindings = map[string][]dockerclient.PortBinding{"80/tcp": {{HostPort: "80"}}}
+	other, err := s.reservations.reserve("")
+	assert.NoError(t, err)
+	assert.NoError(t, s.reservations.allocate(other[0], node2, config))
+
+	expectCreate(client1, config, "instance-1")
+	expectStart(client1, config, "instance-1")
+	container, err := s.CreateContainer(config, "agent")
+	assert.NoError(t, err)
+	client1.AssertExpectations(t)
+	assert.Equal(t, container.Id, "instance-1")
+	assert.Empty(t, node2.Containers())
+
+	// The reservations of the instances are released once they are created.
+	s.reservations.release(other...)
+	assert.Empty(t, s.reservations.byKey)
+}
@@ -0,0 +1,222 @@
+package swarm
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/swarm/cluster"
+	"github.com/samalba/dockerclient"
+)
+
+// Engines older than 1.9 don't know about volumes.
+var errVolumesNotSupported = errors.New("volumes are not supported by this engine")
+
+func (e *engineAPI) listVolumes(n *Node) ([]*cluster.Volume, error) {
+	list := struct {
+		Volumes []*cluster.Volume
+	}{}
+	if err := e.do("GET", n.addr, "/volumes", nil, &list); err != nil {
+		if err == errEndpointNotFound {
+			err = errVolumesNotSupported
+		}
+		return nil, err
+	}
+	return list.Volumes, nil
+}
+
+func (e *engineAPI) createVolume(n *Node, request *cluster.VolumeCreateRequest) (*cluster.Volume, error) {
+	volume := &cluster.Volume{}
+	if err := e.do("POST", n.addr, "/volumes/create", request, volume); err != nil {
+		if err == errEndpointNotFound {
+			err = errVolumesNotSupported
+		}
+		return nil, err
+	}
+	return volume, nil
+}
+
+func (e *engineAPI) removeVolume(n *Node, name string) error {
+	return e.do("DELETE", n.addr, "/volumes/"+url.QueryEscape(name), nil, nil)
+}
+
+// createContainer creates the container of `config` with the volume
+// `driver`, which the Docker client doesn't support.
+func (e *engineAPI) createContainer(n *Node, config *dockerclient.ContainerConfig, name, driver string) (string, error) {
+	request := struct {
+		*dockerclient.ContainerConfig
+		// Takes the place of the HostConfig of the config.
+		HostConfig struct {
+			dockerclient.HostConfig
+			VolumeDriver string
+		}
+	}{ContainerConfig: config}
+	request.HostConfig.HostConfig = config.HostConfig
+	request.HostConfig.VolumeDriver = driver
+
+	created := struct {
+		Id string
+	}{}
+	path := "/containers/create"
+	if name != "" {
+		path += "?name=" + url.QueryEscape(name)
+	}
+	if err := e.do("POST", n.addr, path, &request, &created); err != nil {
+		if err == errEndpointNotFound {
+			// The image is missing.
+			err = dockerclient.ErrNotFound
+		}
+		return "", err
+	}
+	return created.Id, nil
+}
+
+// listVolumeDrivers returns the volume drivers of the engine, nil if it
+// doesn't report its plugins.
+func (e *engineAPI) listVolumeDrivers(n *Node) ([]string, error) {
+	info := struct {
+		Plugins *struct {
+			Volume []string
+		}
+	}{}
+	if err := e.do("GET", n.addr, "/info", nil, &info); err != nil {
+		return nil, err
+	}
+	if info.Plugins == nil {
+		return nil, nil
+	}
+	return append([]string{}, info.Plugins.Volume...), nil
+}
+
+// Refresh the list of volumes on the node, if its engine API is reachable.
+func (n *Node) refreshVolumes() error {
+	if n.engineAPI == nil {
+		return nil
+	}
+
+	volumes, err := n.engineAPI.listVolumes(n)
+	if err == errVolumesNotSupported {
+		volumes, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	drivers, err := n.engineAPI.listVolumeDrivers(n)
+	if err == errEndpointNotFound {
+		drivers, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	n.volumes = volumes
+	n.volumeDrivers = drivers
+	for _, volume := range n.volumes {
+		volume.Node = n
+	}
+	return nil
+}
+
+// Volumes returns the volumes of the node.
+func (n *Node) Volumes() []*cluster.Volume {
+	n.RLock()
+	defer n.RUnlock()
+	return append([]*cluster.Volume{}, n.volumes...)
+}
+
+// VolumeDrivers returns the volume drivers of the node, nil if its engine
+// doesn't report them.
+func (n *Node) VolumeDrivers() []string {
+	n.RLock()
+	defer n.RUnlock()
+	return n.volumeDrivers
+}
+
+// Volumes returns the volumes of all the nodes.
+func (s *SwarmCluster) Volumes() []*cluster.Volume {
+	s.RLock()
+	defer s.RUnlock()
+
+	volumes := []*cluster.Volume{}
+	for _, n := range s.nodes {
+		volumes = append(volumes, n.Volumes()...)
+	}
+	return volumes
+}
+
+// Volume returns the volume `name`, or `<node>/<name>` to tell apart the
+// volumes of the same name on several nodes.
+func (s *SwarmCluster) Volume(name string) *cluster.Volume {
+	for _, volume := range s.Volumes() {
+		if volume.Name == name || volume.Node.Name()+"/"+volume.Name == name {
+			return volume
+		}
+	}
+	return nil
+}
+
+// CreateVolume creates the volume on the node prefixing its name, as in
+// `<node>/<name>`, or else on all the healthy nodes.
+func (s *SwarmCluster) CreateVolume(request *cluster.VolumeCreateRequest) ([]*cluster.Volume, error) {
+	s.RLock()
+	nodes := []*Node{}
+	for _, n := range s.nodes {
+		if parts := strings.SplitN(request.Name, "/", 2); len(parts) == 2 {
+			if n.name == parts[0] || n.id == parts[0] {
+				nodes = append(nodes, n)
+			}
+		} else if n.IsHealthy() {
+			nodes = append(nodes, n)
+		}
+	}
+	s.RUnlock()
+
+	if len(nodes) == 0 {
+		return nil, cluster.ErrNodeNotFound
+	}
+
+	local := *request
+	if parts := strings.SplitN(request.Name, "/", 2); len(parts) == 2 {
+		local.Name = parts[1]
+	}
+
+	for _, n := range nodes {
+		if n.engineAPI == nil {
+			return nil, errVolumesNotSupported
+		}
+	}
+	volumes := []*cluster.Volume{}
+	for _, n := range nodes {
+		volume, err := n.engineAPI.createVolume(n, &local)
+		if err != nil {
+			// All or nothing: the volumes already created are removed.
+			removeVolumes(volumes)
+			return nil, fmt.Errorf("failed to create the volume on %s: %v", n.name, err)
+		}
+		volume.Node = n
+		volumes = append(volumes, volume)
+
+		if err := n.refreshVolumes(); err != nil {
+			log.WithFields(log.Fields{"name": n.name, "id": n.id}).Errorf("Failed to refresh the volumes: %v", err)
+		}
+	}
+	return volumes, nil
+}
+
+// removeVolumes removes the `volumes` just created, logging the failures.
+func removeVolumes(volumes []*cluster.Volume) {
+	for _, volume := range volumes {
+		n := volume.Node.(*Node)
+		fields := log.Fields{"name": n.name, "id": n.id, "volume": volume.Name}
+		if err := n.engineAPI.removeVolume(n, volume.Name); err != nil {
+			log.WithFields(fields).Errorf("Failed to roll back the volume: %v", err)
+		}
+		if err := n.refreshVolumes(); err != nil {
+			log.WithFields(fields).Errorf("Failed to refresh the volumes: %v", err)
+		}
+	}
+}
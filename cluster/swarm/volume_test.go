@@ -0,0 +1,99 @@
+package swarm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/samalba/dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumes(t *testing.T) {
+	volumes := []*cluster.Volume{{Name: "data", Driver: "local", Mountpoint: "/var/lib/docker/volumes/data/_data"}}
+	engine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/info":
+			w.Write([]byte(`{"Plugins":{"Volume":["local","flocker"]}}`))
+		case "/volumes":
+			json.NewEncoder(w).Encode(map[string]interface{}{"Volumes": volumes})
+		case "/volumes/create":
+			request := &cluster.VolumeCreateRequest{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(request))
+			volume := &cluster.Volume{Name: request.Name, Driver: request.Driver}
+			volumes = append(volumes, volume)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(volume)
+		case "/containers/create":
+			request := map[string]interface{}{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			assert.Equal(t, r.URL.Query().Get("name"), "db")
+			assert.Equal(t, request["Image"], "mysql")
+			assert.Equal(t, request["Env"], []interface{}{"A=1"})
+			assert.Equal(t, request["HostConfig"].(map[string]interface{})["VolumeDriver"], "flocker")
+			assert.Equal(t, request["HostConfig"].(map[string]interface{})["Binds"], []interface{}{"db:/var/lib/mysql"})
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"Id":"db_id"}`))
+		default:
+			if name := strings.TrimPrefix(r.URL.Path, "/volumes/"); r.Method == "DELETE" && name != r.URL.Path {
+				for i, volume := range volumes {
+					if volume.Name == name {
+						volumes = append(volumes[:i], volumes[i+1:]...)
+						w.WriteHeader(http.StatusNoContent)
+						return
+					}
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer engine.Close()
+
+	n1, client1 := connectMockNode(t, "node-1")
+	n1.addr = strings.TrimPrefix(engine.URL, "http://")
+	n1.engineAPI = newEngineAPI(nil)
+	assert.NoError(t, n1.refreshVolumes())
+	assert.Equal(t, n1.VolumeDrivers(), []string{"local", "flocker"})
+
+	// Engines without volumes don't have any.
+	old := httptest.NewServer(http.NotFoundHandler())
+	defer old.Close()
+	n2, _ := connectMockNode(t, "node-2")
+	n2.addr = strings.TrimPrefix(old.URL, "http://")
+	n2.engineAPI = newEngineAPI(nil)
+	assert.NoError(t, n2.refreshVolumes())
+	assert.Nil(t, n2.VolumeDrivers())
+
+	s := &SwarmCluster{nodes: map[string]*Node{n1.id: n1, n2.id: n2}}
+	assert.Len(t, s.Volumes(), 1)
+	assert.Equal(t, s.Volume("data").Node, n1)
+	assert.Equal(t, s.Volume("node-1/data").Mountpoint, "/var/lib/docker/volumes/data/_data")
+	assert.Nil(t, s.Volume("node-2/data"))
+
+	created, err := s.CreateVolume(&cluster.VolumeCreateRequest{Name: "node-1/db", Driver: "local"})
+	assert.NoError(t, err)
+	assert.Len(t, created, 1)
+	assert.Equal(t, created[0].Name, "db")
+	assert.Len(t, n1.Volumes(), 2)
+
+	_, err = s.CreateVolume(&cluster.VolumeCreateRequest{Name: "node-3/db"})
+	assert.Equal(t, err, cluster.ErrNodeNotFound)
+	// The volumes are created on all the nodes, or none.
+	_, err = s.CreateVolume(&cluster.VolumeCreateRequest{Name: "logs"})
+	assert.EqualError(t, err, "failed to create the volume on node-2: volumes are not supported by this engine")
+	assert.Len(t, n1.Volumes(), 2)
+
+	// The volume driver is sent to the engine, out of the environment.
+	config := &dockerclient.ContainerConfig{Image: "mysql", Env: []string{"A=1"}}
+	config.HostConfig.Binds = []string{"db:/var/lib/mysql"}
+	cluster.SetVolumeDriver(config, "flocker")
+	client1.On("ListContainers", true, false, `{"id":["db_id"]}`).Return([]dockerclient.Container{{Id: "db_id"}}, nil).Once()
+	client1.On("InspectContainer", "db_id").Return(&dockerclient.ContainerInfo{Config: &dockerclient.ContainerConfig{}}, nil).Once()
+	container, err := n1.Create(config, "db", false)
+	assert.NoError(t, err)
+	assert.Equal(t, container.Id, "db_id")
+	client1.AssertExpectations(t)
+}
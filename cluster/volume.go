@@ -0,0 +1,59 @@
+package cluster
+
+import (
+	"strings"
+
+	"github.com/samalba/dockerclient"
+)
+
+// Volume is a volume of a node, as reported by the Docker engine.
+type Volume struct {
+	Name       string
+	Driver     string
+	Mountpoint string
+
+	Node Node `json:"-"`
+}
+
+// VolumeCreateRequest is the configuration of a new volume.
+type VolumeCreateRequest struct {
+	Name       string
+	Driver     string
+	DriverOpts map[string]string
+}
+
+// The Docker client doesn't know of the volume driver of the containers,
+// given as `HostConfig.VolumeDriver` on create: it is kept in their
+// environment with this prefix while they are scheduled, and removed before
+// reaching the engine.
+const volumeDriverEnv = "com.docker.swarm.volume-driver="
+
+// VolumeDriver returns the volume driver of the container of `config`, empty
+// if it sets none.
+func VolumeDriver(config *dockerclient.ContainerConfig) string {
+	for _, env := range config.Env {
+		if strings.HasPrefix(env, volumeDriverEnv) {
+			return strings.TrimPrefix(env, volumeDriverEnv)
+		}
+	}
+	return ""
+}
+
+// SetVolumeDriver sets the volume driver of the container of `config`.
+func SetVolumeDriver(config *dockerclient.ContainerConfig, driver string) {
+	config.Env = WithoutVolumeDriver(config.Env)
+	if driver != "" {
+		config.Env = append(config.Env, volumeDriverEnv+driver)
+	}
+}
+
+// WithoutVolumeDriver returns `env` without the volume driver.
+func WithoutVolumeDriver(env []string) []string {
+	out := []string{}
+	for _, e := range env {
+		if !strings.HasPrefix(e, volumeDriverEnv) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
@@ -1,6 +1,7 @@
 package consul
 
 import (
+	"encoding/json"
 	"fmt"
 	"path"
 	"strings"
@@ -12,10 +13,12 @@ import (
 )
 
 type ConsulDiscoveryService struct {
-	heartbeat time.Duration
-	client    *consul.Client
-	prefix    string
-	lastIndex uint64
+	heartbeat  time.Duration
+	client     *consul.Client
+	prefix     string
+	tombstones string
+	lastIndex  uint64
+	session    string
 }
 
 func init() {
@@ -40,6 +43,7 @@ func (s *ConsulDiscoveryService) Initialize(uris string, heartbeat int) error {
 	s.client = client
 	s.heartbeat = time.Duration(heartbeat) * time.Second
 	s.prefix = path + "/"
+	s.tombstones = path + "_tombstones/"
 	kv := s.client.KV()
 	p := &consul.KVPair{Key: s.prefix, Value: nil}
 	if _, err = kv.Put(p, nil); err != nil {
@@ -74,9 +78,11 @@ func (s *ConsulDiscoveryService) Watch(callback discovery.WatchCallback) {
 	for _ = range s.waitForChange() {
 		log.WithField("name", "consul").Debug("Discovery watch triggered")
 		entries, err := s.Fetch()
-		if err == nil {
-			callback(entries)
+		if err != nil {
+			discovery.FetchFailed("consul")
+			continue
 		}
+		callback(entries)
 	}
 }
 
@@ -87,6 +93,118 @@ func (s *ConsulDiscoveryService) Register(addr string) error {
 	return err
 }
 
+func (s *ConsulDiscoveryService) Deregister(addr string) error {
+	kv := s.client.KV()
+	_, err := kv.Delete(path.Join(s.prefix, addr), nil)
+	return err
+}
+
+func (s *ConsulDiscoveryService) Tombstone(addr, reason string) error {
+	data, err := json.Marshal(discovery.NewTombstone(addr, reason))
+	if err != nil {
+		return err
+	}
+	kv := s.client.KV()
+	p := &consul.KVPair{Key: path.Join(s.tombstones, addr), Value: data}
+	if _, err := kv.Put(p, nil); err != nil {
+		return err
+	}
+	return s.Deregister(addr)
+}
+
+func (s *ConsulDiscoveryService) Tombstones() ([]*discovery.Tombstone, error) {
+	kv := s.client.KV()
+	pairs, _, err := kv.List(s.tombstones, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tombstones := []*discovery.Tombstone{}
+	for _, pair := range pairs {
+		tombstone := &discovery.Tombstone{}
+		if err := json.Unmarshal(pair.Value, tombstone); err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+	return tombstones, nil
+}
+
+// Lease holds the lease through a consul session expiring after `ttl`, which
+// is renewed on every call.
+func (s *ConsulDiscoveryService) Lease(key, holder string, ttl time.Duration) (string, error) {
+	if s.session != "" {
+		entry, _, err := s.client.Session().Renew(s.session, nil)
+		if err != nil {
+			return "", err
+		}
+		if entry == nil {
+			// The session expired, create a new one.
+			s.session = ""
+		}
+	}
+	if s.session == "" {
+		session, _, err := s.client.Session().Create(&consul.SessionEntry{
+			Behavior: consul.SessionBehaviorDelete,
+			TTL:      ttl.String(),
+		}, nil)
+		if err != nil {
+			return "", err
+		}
+		s.session = session
+	}
+
+	kv := s.client.KV()
+	k := strings.TrimSuffix(s.prefix, "/") + "_" + key
+	acquired, _, err := kv.Acquire(&consul.KVPair{Key: k, Value: []byte(holder), Session: s.session}, nil)
+	if err != nil {
+		return "", err
+	}
+	if acquired {
+		return holder, nil
+	}
+
+	pair, _, err := kv.Get(k, nil)
+	if err != nil {
+		return "", err
+	}
+	if pair == nil || pair.Session == "" {
+		return "", nil
+	}
+	return string(pair.Value), nil
+}
+
+// Buckets are kept in siblings of the discovery path.
+func (s *ConsulDiscoveryService) bucket(name string) string {
+	return strings.TrimSuffix(s.prefix, "/") + "_" + name + "/"
+}
+
+func (s *ConsulDiscoveryService) Put(bucket, key string, value []byte) error {
+	kv := s.client.KV()
+	_, err := kv.Put(&consul.KVPair{Key: path.Join(s.bucket(bucket), key), Value: value}, nil)
+	return err
+}
+
+func (s *ConsulDiscoveryService) Delete(bucket, key string) error {
+	kv := s.client.KV()
+	_, err := kv.Delete(path.Join(s.bucket(bucket), key), nil)
+	return err
+}
+
+func (s *ConsulDiscoveryService) List(bucket string) (map[string][]byte, error) {
+	kv := s.client.KV()
+	pairs, _, err := kv.List(s.bucket(bucket), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte)
+	for _, pair := range pairs {
+		values[path.Base(pair.Key)] = pair.Value
+	}
+	return values, nil
+}
+
 func (s *ConsulDiscoveryService) waitForChange() <-chan uint64 {
 	c := make(chan uint64)
 	go func() {
@@ -13,6 +13,7 @@ func TestInitialize(t *testing.T) {
 
 	assert.Error(t, discovery.Initialize("127.0.0.1/path", 0))
 	assert.Equal(t, discovery.prefix, "path/")
+	assert.Equal(t, discovery.tombstones, "path_tombstones/")
 
 	assert.Error(t, discovery.Initialize("127.0.0.1,127.0.0.2,127.0.0.3/path", 0))
 	assert.Equal(t, discovery.prefix, "path/")
@@ -5,13 +5,29 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/docker/swarm/metrics"
 )
 
+var fetchErrors = metrics.NewCounter("swarm_discovery_fetch_errors_total", "Failed fetches of the nodes from the discovery service.", "backend")
+
+// FetchFailed records a failed fetch of the nodes by the backend `scheme`.
+func FetchFailed(scheme string) {
+	fetchErrors.Inc(scheme)
+}
+
 type Entry struct {
 	Host string
 	Port string
+
+	// Metadata holds optional key/value pairs attached to the node by the
+	// backend (datacenter, status, weight, ...). The manager exposes them as
+	// node labels usable by the scheduler filters.
+	Metadata map[string]string
 }
 
 func NewEntry(url string) (*Entry, error) {
@@ -19,7 +35,7 @@ func NewEntry(url string) (*Entry, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Entry{host, port}, nil
+	return &Entry{Host: host, Port: port}, nil
 }
 
 func (m Entry) String() string {
@@ -33,6 +49,125 @@ type DiscoveryService interface {
 	Fetch() ([]*Entry, error)
 	Watch(WatchCallback)
 	Register(string) error
+	Deregister(string) error
+}
+
+// A Tombstone records a node which left the cluster, when and why.
+type Tombstone struct {
+	Addr   string
+	Time   time.Time
+	Reason string
+}
+
+func NewTombstone(addr, reason string) *Tombstone {
+	return &Tombstone{Addr: addr, Time: time.Now().UTC(), Reason: reason}
+}
+
+func (t Tombstone) String() string {
+	return fmt.Sprintf("%s\tremoved %s (%s)", t.Addr, t.Time.Format(time.RFC3339), t.Reason)
+}
+
+// TombstoneService is implemented by the discovery services able to keep a
+// record of deregistered nodes.
+type TombstoneService interface {
+	// Deregister `addr`, keeping a tombstone of it.
+	Tombstone(addr, reason string) error
+	// Return the tombstones of all the deregistered nodes.
+	Tombstones() ([]*Tombstone, error)
+}
+
+// LeaseService is implemented by the discovery services able to hold leases,
+// used to elect a primary among several managers.
+type LeaseService interface {
+	// Acquire or renew, for `ttl`, the lease `key` on behalf of `holder`.
+	// Return the current holder of the lease, empty if there is none.
+	Lease(key, holder string, ttl time.Duration) (string, error)
+}
+
+// KVService is implemented by the discovery services able to store values,
+// used by the managers to persist their state across restarts.
+type KVService interface {
+	// Set the key `key` of the bucket `bucket` to `value`.
+	Put(bucket, key string, value []byte) error
+	// Remove the key `key` of the bucket `bucket`, if it exists.
+	Delete(bucket, key string) error
+	// Return the values of all the keys of the bucket `bucket`.
+	List(bucket string) (map[string][]byte, error)
+}
+
+// HeartbeatService is implemented by the discovery services polling their
+// backend, whose period can be changed while watching.
+type HeartbeatService interface {
+	SetHeartbeat(heartbeat int)
+}
+
+// StopService is implemented by the discovery services whose Watch can be
+// stopped: it returns once Stop is called.
+type StopService interface {
+	Stop()
+}
+
+// A Heartbeat is the polling period, in seconds, of a discovery service.
+// Embedded in a service, it implements HeartbeatService and StopService.
+type Heartbeat struct {
+	seconds int64
+	init    sync.Once
+	stop    sync.Once
+	done    chan struct{}
+}
+
+func (h *Heartbeat) SetHeartbeat(heartbeat int) {
+	atomic.StoreInt64(&h.seconds, int64(heartbeat))
+}
+
+// Heartbeat returns the current period.
+func (h *Heartbeat) Heartbeat() time.Duration {
+	return time.Duration(atomic.LoadInt64(&h.seconds)) * time.Second
+}
+
+// Stop closes the channels returned by Tick.
+func (h *Heartbeat) Stop() {
+	done := h.stopped()
+	h.stop.Do(func() { close(done) })
+}
+
+func (h *Heartbeat) stopped() chan struct{} {
+	h.init.Do(func() { h.done = make(chan struct{}) })
+	return h.done
+}
+
+// Tick returns a channel receiving the time every heartbeat, picking up the
+// changes of the period along the way, until Stop is called. Nothing is
+// received while the period is 0.
+func (h *Heartbeat) Tick() <-chan time.Time {
+	c := make(chan time.Time)
+	done := h.stopped()
+	go func() {
+		defer close(c)
+		for {
+			period := h.Heartbeat()
+			wait := period
+			if period == 0 {
+				wait = time.Second
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case t := <-timer.C:
+				if period == 0 {
+					continue
+				}
+				select {
+				case c <- t:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return c
 }
 
 var (
@@ -65,7 +200,13 @@ func parse(rawurl string) (string, string) {
 	return parts[0], parts[1]
 }
 
+// New returns the discovery service of `rawurl`, or a Failover if it is a
+// comma separated list of URIs of several services.
 func New(rawurl string, heartbeat int) (DiscoveryService, error) {
+	if len(splitChain(rawurl)) > 1 {
+		f := &Failover{}
+		return f, f.Initialize(rawurl, heartbeat)
+	}
 	scheme, uri := parse(rawurl)
 
 	if discovery, exists := discoveries[scheme]; exists {
@@ -77,6 +218,19 @@ func New(rawurl string, heartbeat int) (DiscoveryService, error) {
 	return nil, ErrNotSupported
 }
 
+// Deregister removes `addr` from the discovery service `d`. If `tombstone` is
+// true, the node is marked as removed for `reason` instead, provided the
+// service supports it.
+func Deregister(d DiscoveryService, addr, reason string, tombstone bool) error {
+	if tombstone {
+		if ts, ok := Primary(d).(TombstoneService); ok {
+			return ts.Tombstone(addr, reason)
+		}
+		log.Warnf("Tombstones are not supported by this discovery service, deregistering %s", addr)
+	}
+	return d.Deregister(addr)
+}
+
 func CreateEntries(addrs []string) ([]*Entry, error) {
 	entries := []*Entry{}
 	if addrs == nil {
@@ -2,6 +2,7 @@ package discovery
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -52,3 +53,25 @@ func TestCreateEntries(t *testing.T) {
 	_, err = CreateEntries([]string{"127.0.0.1", "127.0.0.2"})
 	assert.Error(t, err)
 }
+
+func TestHeartbeatStop(t *testing.T) {
+	for _, seconds := range []int{0, 1} {
+		h := &Heartbeat{}
+		h.SetHeartbeat(seconds)
+		ticks := h.Tick()
+		h.Stop()
+		select {
+		case _, ok := <-ticks:
+			assert.False(t, ok)
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("the ticks of a %ds heartbeat go on after Stop", seconds)
+		}
+	}
+
+	// The ticks started after Stop end right away.
+	h := &Heartbeat{}
+	h.Stop()
+	h.Stop()
+	_, ok := <-h.Tick()
+	assert.False(t, ok)
+}
@@ -0,0 +1,75 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/swarm/discovery"
+)
+
+type DNSDiscoveryService struct {
+	discovery.Heartbeat
+	record string
+
+	// Overridden in tests.
+	lookupSRV func(service, proto, name string) (string, []*net.SRV, error)
+}
+
+func init() {
+	discovery.Register("dns", &DNSDiscoveryService{})
+}
+
+// Initialize takes the fully qualified name of the SRV record, such as
+// `_docker._tcp.swarm.internal`.
+func (s *DNSDiscoveryService) Initialize(record string, heartbeat int) error {
+	record = strings.Trim(record, "/")
+	if record == "" {
+		return errors.New("SRV record is empty")
+	}
+	s.record = record
+	s.SetHeartbeat(heartbeat)
+	if s.lookupSRV == nil {
+		s.lookupSRV = net.LookupSRV
+	}
+	return nil
+}
+
+// Fetch resolves the SRV record. Every answer is turned into a target:port
+// entry, sorted by priority and randomized by weight.
+func (s *DNSDiscoveryService) Fetch() ([]*discovery.Entry, error) {
+	_, srvs, err := s.lookupSRV("", "", s.record)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*discovery.Entry{}
+	for _, srv := range srvs {
+		entries = append(entries, &discovery.Entry{
+			Host: strings.TrimSuffix(srv.Target, "."),
+			Port: strconv.Itoa(int(srv.Port)),
+		})
+	}
+	return entries, nil
+}
+
+func (s *DNSDiscoveryService) Watch(callback discovery.WatchCallback) {
+	for _ = range s.Tick() {
+		entries, err := s.Fetch()
+		if err != nil {
+			discovery.FetchFailed("dns")
+			continue
+		}
+		callback(entries)
+	}
+}
+
+// Register is not supported: membership is managed through DNS.
+func (s *DNSDiscoveryService) Register(addr string) error {
+	return discovery.ErrNotImplemented
+}
+
+func (s *DNSDiscoveryService) Deregister(addr string) error {
+	return discovery.ErrNotImplemented
+}
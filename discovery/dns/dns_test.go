@@ -0,0 +1,47 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitialize(t *testing.T) {
+	discovery := &DNSDiscoveryService{}
+	assert.Error(t, discovery.Initialize("", 0))
+
+	assert.NoError(t, discovery.Initialize("_docker._tcp.swarm.internal", 0))
+	assert.Equal(t, discovery.record, "_docker._tcp.swarm.internal")
+}
+
+func TestFetch(t *testing.T) {
+	discovery := &DNSDiscoveryService{
+		lookupSRV: func(service, proto, name string) (string, []*net.SRV, error) {
+			assert.Equal(t, name, "_docker._tcp.swarm.internal")
+			return "", []*net.SRV{
+				{Target: "node-1.swarm.internal.", Port: 2375},
+				{Target: "node-2.swarm.internal.", Port: 2376},
+			}, nil
+		},
+	}
+	assert.NoError(t, discovery.Initialize("_docker._tcp.swarm.internal", 0))
+
+	entries, err := discovery.Fetch()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, entries[0].String(), "node-1.swarm.internal:2375")
+	assert.Equal(t, entries[1].String(), "node-2.swarm.internal:2376")
+
+	discovery.lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, errors.New("no such host")
+	}
+	_, err = discovery.Fetch()
+	assert.Error(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	discovery := &DNSDiscoveryService{}
+	assert.Error(t, discovery.Register("0.0.0.0"))
+}
@@ -1,9 +1,11 @@
 package etcd
 
 import (
+	"encoding/json"
 	"fmt"
 	"path"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/coreos/go-etcd/etcd"
@@ -11,9 +13,10 @@ import (
 )
 
 type EtcdDiscoveryService struct {
-	ttl    uint64
-	client *etcd.Client
-	path   string
+	ttl        uint64
+	client     *etcd.Client
+	path       string
+	tombstones string
 }
 
 func init() {
@@ -40,6 +43,7 @@ func (s *EtcdDiscoveryService) Initialize(uris string, heartbeat int) error {
 	s.client = etcd.NewClient(entries)
 	s.ttl = uint64(heartbeat * 3 / 2)
 	s.path = "/" + parts[1] + "/"
+	s.tombstones = "/" + parts[1] + "_tombstones/"
 	if _, err := s.client.CreateDir(s.path, s.ttl); err != nil {
 		if etcdError, ok := err.(*etcd.EtcdError); ok {
 			if etcdError.ErrorCode != 105 { // skip key already exists
@@ -70,9 +74,11 @@ func (s *EtcdDiscoveryService) Watch(callback discovery.WatchCallback) {
 	for _ = range watchChan {
 		log.WithField("name", "etcd").Debug("Discovery watch triggered")
 		entries, err := s.Fetch()
-		if err == nil {
-			callback(entries)
+		if err != nil {
+			discovery.FetchFailed("etcd")
+			continue
 		}
+		callback(entries)
 	}
 }
 
@@ -80,3 +86,111 @@ func (s *EtcdDiscoveryService) Register(addr string) error {
 	_, err := s.client.Set(path.Join(s.path, addr), addr, s.ttl)
 	return err
 }
+
+func (s *EtcdDiscoveryService) Deregister(addr string) error {
+	if _, err := s.client.Delete(path.Join(s.path, addr), false); err != nil && !isKeyNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *EtcdDiscoveryService) Tombstone(addr, reason string) error {
+	data, err := json.Marshal(discovery.NewTombstone(addr, reason))
+	if err != nil {
+		return err
+	}
+	if _, err := s.client.Set(path.Join(s.tombstones, addr), string(data), 0); err != nil {
+		return err
+	}
+	return s.Deregister(addr)
+}
+
+func (s *EtcdDiscoveryService) Tombstones() ([]*discovery.Tombstone, error) {
+	tombstones := []*discovery.Tombstone{}
+
+	resp, err := s.client.Get(s.tombstones, true, true)
+	if err != nil {
+		if isKeyNotFound(err) {
+			return tombstones, nil
+		}
+		return nil, err
+	}
+
+	for _, n := range resp.Node.Nodes {
+		tombstone := &discovery.Tombstone{}
+		if err := json.Unmarshal([]byte(n.Value), tombstone); err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+	return tombstones, nil
+}
+
+func (s *EtcdDiscoveryService) Lease(key, holder string, ttl time.Duration) (string, error) {
+	k := strings.TrimSuffix(s.path, "/") + "_" + key
+	seconds := uint64(ttl / time.Second)
+
+	// Take the lease if it's free, or renew it if we already hold it.
+	if _, err := s.client.Create(k, holder, seconds); err == nil {
+		return holder, nil
+	} else if !isErrorCode(err, 105) { // key already exists
+		return "", err
+	}
+	if _, err := s.client.CompareAndSwap(k, holder, seconds, holder, 0); err == nil {
+		return holder, nil
+	} else if !isErrorCode(err, 101) { // compare failed
+		return "", err
+	}
+
+	resp, err := s.client.Get(k, false, false)
+	if err != nil {
+		if isKeyNotFound(err) {
+			// The lease expired in the meantime.
+			return "", nil
+		}
+		return "", err
+	}
+	return resp.Node.Value, nil
+}
+
+// Buckets are kept in siblings of the discovery path.
+func (s *EtcdDiscoveryService) bucket(name string) string {
+	return strings.TrimSuffix(s.path, "/") + "_" + name + "/"
+}
+
+func (s *EtcdDiscoveryService) Put(bucket, key string, value []byte) error {
+	_, err := s.client.Set(path.Join(s.bucket(bucket), key), string(value), 0)
+	return err
+}
+
+func (s *EtcdDiscoveryService) Delete(bucket, key string) error {
+	if _, err := s.client.Delete(path.Join(s.bucket(bucket), key), false); err != nil && !isKeyNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *EtcdDiscoveryService) List(bucket string) (map[string][]byte, error) {
+	values := make(map[string][]byte)
+
+	resp, err := s.client.Get(s.bucket(bucket), false, true)
+	if err != nil {
+		if isKeyNotFound(err) {
+			return values, nil
+		}
+		return nil, err
+	}
+	for _, n := range resp.Node.Nodes {
+		values[path.Base(n.Key)] = []byte(n.Value)
+	}
+	return values, nil
+}
+
+func isKeyNotFound(err error) bool {
+	return isErrorCode(err, 100)
+}
+
+func isErrorCode(err error, code int) bool {
+	etcdError, ok := err.(*etcd.EtcdError)
+	return ok && etcdError.ErrorCode == code
+}
@@ -0,0 +1,251 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Failover chains several discovery services: the nodes are fetched from the
+// first one, the primary, and from the next ones in turn while it fails. The
+// last list fetched is kept, and written to a cache file if set, so that the
+// manager still knows its nodes when all of them fail.
+//
+// The tombstones, leases and values are only held by the primary, see Primary.
+type Failover struct {
+	Heartbeat
+	sync.Mutex
+
+	services []DiscoveryService
+	schemes  []string
+	// Index of the service the nodes were last fetched from.
+	active int
+
+	cache   string
+	entries []*Entry
+}
+
+// splitChain splits a comma separated list of discovery URIs. The lists of
+// hosts some backends take, e.g. etcd://<ip1>,<ip2>/<path>, are kept whole: a
+// new URI only starts with a scheme.
+func splitChain(rawurl string) []string {
+	uris := []string{}
+	for _, part := range strings.Split(rawurl, ",") {
+		if len(uris) == 0 || strings.Contains(part, "://") {
+			uris = append(uris, part)
+		} else {
+			uris[len(uris)-1] += "," + part
+		}
+	}
+	return uris
+}
+
+// Initialize initializes the services of the comma separated list of URIs
+// `rawurl`, the primary first.
+func (f *Failover) Initialize(rawurl string, heartbeat int) error {
+	f.SetHeartbeat(heartbeat)
+	f.services, f.schemes = nil, nil
+	for _, uri := range splitChain(rawurl) {
+		scheme, _ := parse(uri)
+		for _, s := range f.schemes {
+			// The services are registered once per scheme.
+			if s == scheme {
+				return fmt.Errorf("the discovery service %s is chained twice", scheme)
+			}
+		}
+		service, err := New(uri, heartbeat)
+		if err != nil {
+			return fmt.Errorf("%s: %v", uri, err)
+		}
+		f.services = append(f.services, service)
+		f.schemes = append(f.schemes, scheme)
+	}
+	return nil
+}
+
+// CacheTo keeps the nodes in the file at `path`, reading back the ones it
+// holds, if any, until they are fetched.
+func (f *Failover) CacheTo(path string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	f.cache = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	entries := []*Entry{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("invalid discovery cache %s: %v", path, err)
+	}
+	f.entries = entries
+	return nil
+}
+
+// Fetch returns the nodes of the first service answering. If none does, it
+// returns the nodes last fetched.
+func (f *Failover) Fetch() ([]*Entry, error) {
+	entries, _, err := f.fetch()
+	return entries, err
+}
+
+// fetch is Fetch, also telling whether the nodes come from the primary.
+func (f *Failover) fetch() ([]*Entry, bool, error) {
+	errs := []string{}
+	for i, service := range f.services {
+		entries, err := service.Fetch()
+		if err != nil {
+			FetchFailed(f.schemes[i])
+			errs = append(errs, fmt.Sprintf("%s: %v", f.schemes[i], err))
+			continue
+		}
+		f.fetched(i, entries)
+		return entries, i == 0, nil
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	if f.entries == nil {
+		return nil, false, fmt.Errorf("all the discovery services failed: %s", strings.Join(errs, "; "))
+	}
+	log.WithField("name", "failover").Warnf("All the discovery services failed, using the %d nodes last fetched: %s", len(f.entries), strings.Join(errs, "; "))
+	return f.entries, false, nil
+}
+
+// fetched records the nodes fetched from the service `i`.
+func (f *Failover) fetched(i int, entries []*Entry) {
+	f.Lock()
+	defer f.Unlock()
+
+	if i != f.active {
+		if i > f.active {
+			log.WithField("name", "failover").Warnf("Failing over from the discovery service %s to %s", f.schemes[f.active], f.schemes[i])
+		} else {
+			log.WithField("name", "failover").Infof("Back to the discovery service %s", f.schemes[i])
+		}
+		f.active = i
+	}
+	if reflect.DeepEqual(entries, f.entries) {
+		return
+	}
+	f.entries = entries
+	if f.cache != "" {
+		if err := writeCache(f.cache, entries); err != nil {
+			log.WithField("name", "failover").Errorf("Failed to cache the nodes in %s: %v", f.cache, err)
+		}
+	}
+}
+
+// writeCache replaces the file at `path` with `entries`, atomically so that
+// a crash doesn't leave it truncated.
+func writeCache(path string, entries []*Entry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Watch polls the services every heartbeat: the primary may not be the one
+// to notify the changes. The nodes not fetched from the primary are only
+// added: a fallback or the cache may be out of date, so the nodes reported
+// before are kept until the primary answers again.
+func (f *Failover) Watch(callback WatchCallback) {
+	reported := []*Entry{}
+	for _ = range f.Tick() {
+		entries, primary, err := f.fetch()
+		if err != nil {
+			log.WithField("name", "failover").Error(err)
+			continue
+		}
+		if !primary {
+			entries = merge(reported, entries)
+		}
+		reported = entries
+		callback(entries)
+	}
+}
+
+// merge returns the entries of `a` followed by the ones of `b` not in `a`.
+func merge(a, b []*Entry) []*Entry {
+	merged := append([]*Entry{}, a...)
+	seen := make(map[string]bool)
+	for _, entry := range a {
+		seen[entry.String()] = true
+	}
+	for _, entry := range b {
+		if !seen[entry.String()] {
+			seen[entry.String()] = true
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
+
+// Register registers `addr` on all the services supporting it.
+func (f *Failover) Register(addr string) error {
+	return f.each(func(service DiscoveryService) error { return service.Register(addr) })
+}
+
+// Deregister deregisters `addr` from all the services supporting it.
+func (f *Failover) Deregister(addr string) error {
+	return f.each(func(service DiscoveryService) error { return service.Deregister(addr) })
+}
+
+// each calls `fn` on all the services, failing if none succeeds.
+func (f *Failover) each(fn func(DiscoveryService) error) error {
+	var (
+		errs      = []string{}
+		succeeded bool
+	)
+	for i, service := range f.services {
+		switch err := fn(service); err {
+		case nil:
+			succeeded = true
+		case ErrNotImplemented:
+		default:
+			errs = append(errs, fmt.Sprintf("%s: %v", f.schemes[i], err))
+		}
+	}
+	switch {
+	case succeeded:
+		if len(errs) > 0 {
+			log.WithField("name", "failover").Warn(strings.Join(errs, "; "))
+		}
+		return nil
+	case len(errs) > 0:
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	default:
+		return ErrNotImplemented
+	}
+}
+
+// Primary returns the service holding the tombstones, leases and values of
+// `d`: its primary if `d` chains several services, `d` itself otherwise.
+func Primary(d DiscoveryService) DiscoveryService {
+	if f, ok := d.(*Failover); ok && len(f.services) > 0 {
+		return f.services[0]
+	}
+	return d
+}
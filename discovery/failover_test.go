@@ -0,0 +1,115 @@
+package discovery
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeService struct {
+	entries    []*Entry
+	err        error
+	registered []string
+}
+
+func (s *fakeService) Initialize(string, int) error { return nil }
+func (s *fakeService) Fetch() ([]*Entry, error)     { return s.entries, s.err }
+func (s *fakeService) Watch(WatchCallback)          {}
+func (s *fakeService) Register(addr string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.registered = append(s.registered, addr)
+	return nil
+}
+func (s *fakeService) Deregister(string) error { return ErrNotImplemented }
+
+// registerFakes registers new fake services under `schemes`, returning them
+// and a function unregistering them, so that each test run gets its own.
+func registerFakes(schemes ...string) ([]*fakeService, func()) {
+	services := []*fakeService{}
+	for _, scheme := range schemes {
+		service := &fakeService{}
+		discoveries[scheme] = service
+		services = append(services, service)
+	}
+	return services, func() {
+		for _, scheme := range schemes {
+			delete(discoveries, scheme)
+		}
+	}
+}
+
+func TestSplitChain(t *testing.T) {
+	assert.Equal(t, splitChain("127.0.0.1:2375,127.0.0.2:2375"), []string{"127.0.0.1:2375,127.0.0.2:2375"})
+	assert.Equal(t, splitChain("etcd://10.0.0.1,10.0.0.2/swarm,file:///etc/swarm/nodes"), []string{"etcd://10.0.0.1,10.0.0.2/swarm", "file:///etc/swarm/nodes"})
+	assert.Equal(t, splitChain(""), []string{""})
+}
+
+func TestFailover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-failover")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache := filepath.Join(dir, "nodes.json")
+	fakes, unregister := registerFakes("primary", "fallback")
+	defer unregister()
+	primary, fallback := fakes[0], fakes[1]
+
+	_, err = New("primary://a,primary://b", 0)
+	assert.Error(t, err)
+
+	d, err := New("primary://a,fallback://b", 0)
+	assert.NoError(t, err)
+	f := d.(*Failover)
+	assert.Equal(t, Primary(d), primary)
+	assert.Equal(t, Primary(primary), primary)
+	assert.NoError(t, f.CacheTo(cache))
+
+	node1, _ := CreateEntries([]string{"127.0.0.1:2375"})
+	node2, _ := CreateEntries([]string{"127.0.0.2:2375"})
+	primary.entries, fallback.entries = node1, node2
+	entries, fromPrimary, err := f.fetch()
+	assert.NoError(t, err)
+	assert.True(t, fromPrimary)
+	assert.Equal(t, entries, node1)
+
+	primary.err = errors.New("unreachable")
+	entries, fromPrimary, err = f.fetch()
+	assert.NoError(t, err)
+	assert.False(t, fromPrimary)
+	assert.Equal(t, entries, node2)
+
+	// The nodes last fetched are used when all the services fail, and
+	// survive a restart.
+	fallback.err = errors.New("unreachable")
+	entries, err = f.Fetch()
+	assert.NoError(t, err)
+	assert.Equal(t, entries, node2)
+
+	restarted := &Failover{}
+	assert.NoError(t, restarted.Initialize("primary://a,fallback://b", 0))
+	_, err = restarted.Fetch()
+	assert.Error(t, err)
+	assert.NoError(t, restarted.CacheTo(cache))
+	entries, err = restarted.Fetch()
+	assert.NoError(t, err)
+	assert.Equal(t, entries, node2)
+
+	// Registered on the services answering.
+	assert.Error(t, f.Register("127.0.0.3:2375"))
+	fallback.err = nil
+	assert.NoError(t, f.Register("127.0.0.3:2375"))
+	assert.Equal(t, fallback.registered, []string{"127.0.0.3:2375"})
+	assert.Equal(t, f.Deregister("127.0.0.3:2375"), ErrNotImplemented)
+}
+
+func TestMerge(t *testing.T) {
+	node1, _ := CreateEntries([]string{"127.0.0.1:2375"})
+	nodes, _ := CreateEntries([]string{"127.0.0.2:2375", "127.0.0.1:2375"})
+	assert.Equal(t, merge(node1, nodes), append(node1, nodes[0]))
+	assert.Equal(t, merge(nil, node1), node1)
+}
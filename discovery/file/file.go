@@ -1,16 +1,16 @@
 package file
 
 import (
+	"fmt"
 	"io/ioutil"
 	"strings"
-	"time"
 
 	"github.com/docker/swarm/discovery"
 )
 
 type FileDiscoveryService struct {
-	heartbeat int
-	path      string
+	discovery.Heartbeat
+	path string
 }
 
 func init() {
@@ -19,7 +19,7 @@ func init() {
 
 func (s *FileDiscoveryService) Initialize(path string, heartbeat int) error {
 	s.path = path
-	s.heartbeat = heartbeat
+	s.SetHeartbeat(heartbeat)
 	return nil
 }
 
@@ -29,18 +29,52 @@ func (s *FileDiscoveryService) Fetch() ([]*discovery.Entry, error) {
 		return nil, err
 	}
 
-	return discovery.CreateEntries(strings.Split(string(data), "\n"))
+	return parseFileContent(data)
+}
+
+// Each line of the file holds a node address, optionally followed by
+// key=value metadata pairs: `<ip:port> [key=value ...]`.
+func parseFileContent(content []byte) ([]*discovery.Entry, error) {
+	entries := []*discovery.Entry{}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		entry, err := discovery.NewEntry(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("invalid metadata %q for %s, expected key=value", field, fields[0])
+			}
+			if entry.Metadata == nil {
+				entry.Metadata = make(map[string]string)
+			}
+			entry.Metadata[kv[0]] = kv[1]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
 }
 
 func (s *FileDiscoveryService) Watch(callback discovery.WatchCallback) {
-	for _ = range time.Tick(time.Duration(s.heartbeat) * time.Second) {
+	for _ = range s.Tick() {
 		entries, err := s.Fetch()
-		if err == nil {
-			callback(entries)
+		if err != nil {
+			discovery.FetchFailed("file")
+			continue
 		}
+		callback(entries)
 	}
 }
 
 func (s *FileDiscoveryService) Register(addr string) error {
 	return discovery.ErrNotImplemented
 }
+
+func (s *FileDiscoveryService) Deregister(addr string) error {
+	return discovery.ErrNotImplemented
+}
@@ -16,3 +16,19 @@ func TestRegister(t *testing.T) {
 	discovery := &FileDiscoveryService{path: "/path/to/file"}
 	assert.Error(t, discovery.Register("0.0.0.0"))
 }
+
+func TestParseFileContent(t *testing.T) {
+	entries, err := parseFileContent([]byte("1.1.1.1:1111\n\n2.2.2.2:2222 region=us-east status=ok\n"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, entries[0].String(), "1.1.1.1:1111")
+	assert.Nil(t, entries[0].Metadata)
+	assert.Equal(t, entries[1].String(), "2.2.2.2:2222")
+	assert.Equal(t, entries[1].Metadata, map[string]string{"region": "us-east", "status": "ok"})
+
+	_, err = parseFileContent([]byte("1.1.1.1"))
+	assert.Error(t, err)
+
+	_, err = parseFileContent([]byte("1.1.1.1:1111 region"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,151 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/swarm/discovery"
+)
+
+// Timeout for requests sent out to the endpoint.
+const requestTimeout = 10 * time.Second
+
+// HTTPDiscoveryService fetches the list of nodes from an arbitrary HTTP(S)
+// endpoint.
+//
+// The endpoint is expected to:
+//   - answer GET with a JSON array whose items are either "ip:port" strings or
+//     {"addr": "ip:port", "metadata": {"key": "value"}} objects,
+//   - accept POST with a JSON encoded "ip:port" string to register a node,
+//   - accept DELETE on <endpoint>/<ip:port> to deregister a node.
+type HTTPDiscoveryService struct {
+	discovery.Heartbeat
+	scheme   string
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func init() {
+	discovery.Register("http", &HTTPDiscoveryService{scheme: "http"})
+	discovery.Register("https", &HTTPDiscoveryService{scheme: "https"})
+}
+
+func (s *HTTPDiscoveryService) Initialize(uri string, heartbeat int) error {
+	if uri == "" {
+		return errors.New("endpoint is empty")
+	}
+	u, err := url.Parse(s.scheme + "://" + uri)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid format %q, missing <host>", uri)
+	}
+
+	s.endpoint = u
+	s.SetHeartbeat(heartbeat)
+	s.client = &http.Client{Timeout: requestTimeout}
+	return nil
+}
+
+func (s *HTTPDiscoveryService) Fetch() ([]*discovery.Entry, error) {
+	resp, err := s.client.Get(s.endpoint.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to fetch entries, Discovery service returned %d HTTP status code", resp.StatusCode)
+	}
+
+	var items []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return nil, err
+	}
+
+	entries := []*discovery.Entry{}
+	for _, item := range items {
+		var node struct {
+			Addr     string
+			Metadata map[string]string
+		}
+		if err := json.Unmarshal(item, &node.Addr); err != nil {
+			if err := json.Unmarshal(item, &node); err != nil {
+				return nil, err
+			}
+		}
+		entry, err := discovery.NewEntry(node.Addr)
+		if err != nil {
+			return nil, err
+		}
+		entry.Metadata = node.Metadata
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *HTTPDiscoveryService) Watch(callback discovery.WatchCallback) {
+	for _ = range s.Tick() {
+		entries, err := s.Fetch()
+		if err != nil {
+			discovery.FetchFailed(s.scheme)
+			continue
+		}
+		callback(entries)
+	}
+}
+
+func (s *HTTPDiscoveryService) Register(addr string) error {
+	body, err := json.Marshal(addr)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.endpoint.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return checkStatus(resp, "register")
+}
+
+// Deregister removes `addr` from the endpoint.
+func (s *HTTPDiscoveryService) Deregister(addr string) error {
+	req, err := http.NewRequest("DELETE", s.entryURL(addr), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// The node is gone either way.
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return checkStatus(resp, "deregister")
+}
+
+func (s *HTTPDiscoveryService) entryURL(addr string) string {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + addr
+	return u.String()
+}
+
+func checkStatus(resp *http.Response, action string) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Failed to %s entry, Discovery service returned %d HTTP status code", action, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService(t *testing.T, handler http.HandlerFunc) (*HTTPDiscoveryService, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	discovery := &HTTPDiscoveryService{scheme: "http"}
+	assert.NoError(t, discovery.Initialize(strings.TrimPrefix(server.URL, "http://")+"/nodes", 0))
+	return discovery, server
+}
+
+func TestInitialize(t *testing.T) {
+	discovery := &HTTPDiscoveryService{scheme: "https"}
+	assert.Error(t, discovery.Initialize("", 0))
+	assert.Error(t, discovery.Initialize("/nodes", 0))
+
+	assert.NoError(t, discovery.Initialize("inventory.example.com/nodes?dc=1", 0))
+	assert.Equal(t, discovery.endpoint.String(), "https://inventory.example.com/nodes?dc=1")
+	assert.Equal(t, discovery.entryURL("1.1.1.1:1111"), "https://inventory.example.com/nodes/1.1.1.1:1111?dc=1")
+}
+
+func TestFetch(t *testing.T) {
+	discovery, server := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.Method, "GET")
+		assert.Equal(t, r.URL.Path, "/nodes")
+		w.Write([]byte(`["1.1.1.1:1111",{"addr":"2.2.2.2:2222","metadata":{"region":"us-east"}}]`))
+	})
+	defer server.Close()
+
+	entries, err := discovery.Fetch()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, entries[0].String(), "1.1.1.1:1111")
+	assert.Nil(t, entries[0].Metadata)
+	assert.Equal(t, entries[1].String(), "2.2.2.2:2222")
+	assert.Equal(t, entries[1].Metadata, map[string]string{"region": "us-east"})
+}
+
+func TestFetchError(t *testing.T) {
+	discovery, server := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "fail", http.StatusInternalServerError)
+	})
+	defer server.Close()
+
+	_, err := discovery.Fetch()
+	assert.Error(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	registered := []string{}
+	discovery, server := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			var addr string
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&addr))
+			registered = append(registered, addr)
+			w.WriteHeader(http.StatusCreated)
+		case "DELETE":
+			if r.URL.Path != "/nodes/1.1.1.1:1111" {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	defer server.Close()
+
+	assert.NoError(t, discovery.Register("1.1.1.1:1111"))
+	assert.Equal(t, registered, []string{"1.1.1.1:1111"})
+
+	assert.NoError(t, discovery.Deregister("1.1.1.1:1111"))
+	// Deregistering an unknown node is not an error.
+	assert.NoError(t, discovery.Deregister("2.2.2.2:2222"))
+}
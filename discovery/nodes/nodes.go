@@ -35,3 +35,7 @@ func (s *NodesDiscoveryService) Watch(callback discovery.WatchCallback) {
 func (s *NodesDiscoveryService) Register(addr string) error {
 	return discovery.ErrNotImplemented
 }
+
+func (s *NodesDiscoveryService) Deregister(addr string) error {
+	return discovery.ErrNotImplemented
+}
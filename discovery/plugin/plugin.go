@@ -0,0 +1,126 @@
+// Package plugin loads discovery backends shipped out of tree as executables.
+//
+// Every executable found in the plugin directory provides the discovery
+// scheme named after it (without extension): `/plugins/foo` handles
+// `foo://<uri>`. Swarm runs the plugin once per operation:
+//
+//	<plugin> initialize <uri> <heartbeat>
+//	<plugin> fetch <uri>
+//	<plugin> register <uri> <addr>
+//	<plugin> deregister <uri> <addr>
+//
+// `fetch` prints one <ip:port> per line on its standard output. A plugin
+// exits with 0 on success, with 3 if it doesn't implement the operation, and
+// with any other status on error, describing the error on its standard error.
+package plugin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/swarm/discovery"
+)
+
+// Exit status of a plugin not implementing an operation.
+const exitNotImplemented = 3
+
+type PluginDiscoveryService struct {
+	scheme string
+	path   string
+	uri    string
+	discovery.Heartbeat
+}
+
+// Load registers a discovery service for every executable in `dir`.
+func Load(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || file.Mode()&0111 == 0 {
+			continue
+		}
+		name := file.Name()
+		scheme := strings.TrimSuffix(name, filepath.Ext(name))
+		if err := discovery.Register(scheme, &PluginDiscoveryService{scheme: scheme, path: filepath.Join(dir, name)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PluginDiscoveryService) Initialize(uri string, heartbeat int) error {
+	s.uri = uri
+	s.SetHeartbeat(heartbeat)
+
+	_, err := s.run("initialize", uri, strconv.Itoa(heartbeat))
+	if err == discovery.ErrNotImplemented {
+		// Nothing to initialize.
+		return nil
+	}
+	return err
+}
+
+func (s *PluginDiscoveryService) Fetch() ([]*discovery.Entry, error) {
+	out, err := s.run("fetch", s.uri)
+	if err != nil {
+		return nil, err
+	}
+	return discovery.CreateEntries(strings.Split(string(out), "\n"))
+}
+
+func (s *PluginDiscoveryService) Watch(callback discovery.WatchCallback) {
+	for _ = range s.Tick() {
+		entries, err := s.Fetch()
+		if err != nil {
+			log.WithField("name", s.path).Errorf("Discovery error: %v", err)
+			discovery.FetchFailed(s.scheme)
+			continue
+		}
+		callback(entries)
+	}
+}
+
+func (s *PluginDiscoveryService) Register(addr string) error {
+	_, err := s.run("register", s.uri, addr)
+	return err
+}
+
+func (s *PluginDiscoveryService) Deregister(addr string) error {
+	_, err := s.run("deregister", s.uri, addr)
+	return err
+}
+
+// run executes the plugin and returns its standard output.
+func (s *PluginDiscoveryService) run(args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(s.path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, err
+		}
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == exitNotImplemented {
+			return nil, discovery.ErrNotImplemented
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, fmt.Errorf("%s %s: %v", filepath.Base(s.path), args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
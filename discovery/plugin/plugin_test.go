@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/swarm/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+const script = `#!/bin/sh
+case "$1" in
+initialize)
+	[ "$2" = "path/to/cluster" ] || { echo "unknown cluster $2" >&2; exit 1; }
+	;;
+fetch)
+	echo 1.1.1.1:1111
+	echo
+	echo 2.2.2.2:2222
+	;;
+register)
+	echo "$3" >> "$(dirname "$0")/registered"
+	;;
+*)
+	exit 3
+	;;
+esac
+`
+
+// Incremented by each test plugin: discovery services can't be unregistered,
+// so every run of the tests needs new schemes.
+var plugins int
+
+// newTestPlugin returns the directory of a new plugin, and its scheme.
+func newTestPlugin(t *testing.T) (string, string) {
+	dir, err := ioutil.TempDir("", "swarm-discovery-plugin")
+	assert.NoError(t, err)
+	plugins++
+	scheme := fmt.Sprintf("testplugin%d", plugins)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, scheme+".sh"), []byte(script), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0644))
+	return dir, scheme
+}
+
+func TestLoad(t *testing.T) {
+	dir, scheme := newTestPlugin(t)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, Load(dir))
+	assert.Error(t, Load(dir))
+
+	_, err := discovery.New(scheme+"://unknown", 0)
+	assert.EqualError(t, err, "unknown cluster unknown")
+
+	d, err := discovery.New(scheme+"://path/to/cluster", 0)
+	assert.NoError(t, err)
+
+	entries, err := d.Fetch()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, entries[0].String(), "1.1.1.1:1111")
+	assert.Equal(t, entries[1].String(), "2.2.2.2:2222")
+
+	assert.NoError(t, d.Register("3.3.3.3:3333"))
+	registered, err := ioutil.ReadFile(filepath.Join(dir, "registered"))
+	assert.NoError(t, err)
+	assert.Equal(t, string(registered), "3.3.3.3:3333\n")
+
+	assert.Equal(t, d.Deregister("3.3.3.3:3333"), discovery.ErrNotImplemented)
+
+	_, err = discovery.New("README://path/to/cluster", 0)
+	assert.Equal(t, err, discovery.ErrNotSupported)
+}
+
+func TestWatchStop(t *testing.T) {
+	dir, scheme := newTestPlugin(t)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, Load(dir))
+	d, err := discovery.New(scheme+"://path/to/cluster", 1)
+	assert.NoError(t, err)
+
+	fetched := make(chan []*discovery.Entry, 1)
+	watched := make(chan struct{})
+	go func() {
+		d.Watch(func(entries []*discovery.Entry) {
+			select {
+			case fetched <- entries:
+			default:
+			}
+		})
+		close(watched)
+	}()
+	select {
+	case entries := <-fetched:
+		assert.Len(t, entries, 2)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the nodes were not fetched")
+	}
+
+	d.(discovery.StopService).Stop()
+	select {
+	case <-watched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch goes on after Stop")
+	}
+}
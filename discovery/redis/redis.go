@@ -0,0 +1,368 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/swarm/discovery"
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	defaultPort = "6379"
+
+	// Timeout for establishing a connection to the redis server.
+	dialTimeout = 5 * time.Second
+)
+
+// Take the lease KEYS[1] for ARGV[1] if it's free, renew it for ARGV[2]
+// milliseconds if ARGV[1] already holds it, and return its holder.
+var lockScript = redis.NewScript(1, `
+local holder = redis.call("GET", KEYS[1])
+if not holder then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return ARGV[1]
+end
+if holder == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return holder
+`)
+
+type RedisDiscoveryService struct {
+	heartbeat  time.Duration
+	ttl        int
+	pool       *redis.Pool
+	prefix     string
+	tombstones string
+	done       chan struct{}
+	stop       sync.Once
+}
+
+func init() {
+	discovery.Register("redis", &RedisDiscoveryService{})
+}
+
+func (s *RedisDiscoveryService) Initialize(uris string, heartbeat int) error {
+	parts := strings.SplitN(uris, "/", 2)
+	if len(parts) < 2 || parts[1] == "" {
+		return fmt.Errorf("invalid format %q, missing <keyprefix>", uris)
+	}
+	addr := parts[0]
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, defaultPort)
+	}
+
+	return s.initialize(parts[1], heartbeat, func() (redis.Conn, error) {
+		return redis.Dial("tcp", addr, redis.DialConnectTimeout(dialTimeout))
+	})
+}
+
+// initialize sets the service up to keep the nodes under `prefix`, on the
+// server `dial` connects to.
+func (s *RedisDiscoveryService) initialize(prefix string, heartbeat int, dial func() (redis.Conn, error)) error {
+	s.heartbeat = time.Duration(heartbeat) * time.Second
+	s.ttl = heartbeat * 3 / 2
+	s.prefix = strings.TrimSuffix(prefix, "/") + "/"
+	s.tombstones = strings.TrimSuffix(prefix, "/") + "_tombstones/"
+	s.done = make(chan struct{})
+	s.pool = &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+		Dial:        dial,
+	}
+
+	conn := s.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("PING")
+	return err
+}
+
+func (s *RedisDiscoveryService) Fetch() ([]*discovery.Entry, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	keys, err := scanKeys(conn, s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := []string{}
+	for _, key := range keys {
+		addrs = append(addrs, strings.TrimPrefix(key, s.prefix))
+	}
+	return discovery.CreateEntries(addrs)
+}
+
+// Return all the keys starting with `prefix`.
+func scanKeys(conn redis.Conn, prefix string) ([]string, error) {
+	var (
+		cursor = 0
+		seen   = make(map[string]bool)
+		keys   = []string{}
+	)
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", prefix+"*", "COUNT", 100))
+		if err != nil {
+			return nil, err
+		}
+		var batch []string
+		if _, err := redis.Scan(values, &cursor, &batch); err != nil {
+			return nil, err
+		}
+		// SCAN may return the same key more than once.
+		for _, key := range batch {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
+func (s *RedisDiscoveryService) Watch(callback discovery.WatchCallback) {
+	changes := s.waitForChange()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-changes:
+		}
+		log.WithField("name", "redis").Debug("Discovery watch triggered")
+		entries, err := s.Fetch()
+		if err != nil {
+			discovery.FetchFailed("redis")
+			continue
+		}
+		callback(entries)
+	}
+}
+
+// Stop ends Watch, and the subscription to the keyspace events.
+func (s *RedisDiscoveryService) Stop() {
+	s.stop.Do(func() { close(s.done) })
+}
+
+// Register sets a key expiring after 1.5 heartbeats, so nodes which stop
+// registering disappear on their own.
+func (s *RedisDiscoveryService) Register(addr string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	var err error
+	if s.ttl > 0 {
+		_, err = conn.Do("SETEX", s.key(addr), s.ttl, addr)
+	} else {
+		_, err = conn.Do("SET", s.key(addr), addr)
+	}
+	return err
+}
+
+func (s *RedisDiscoveryService) Deregister(addr string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", s.key(addr))
+	return err
+}
+
+func (s *RedisDiscoveryService) Tombstone(addr, reason string) error {
+	data, err := json.Marshal(discovery.NewTombstone(addr, reason))
+	if err != nil {
+		return err
+	}
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("SET", s.tombstones+addr, data); err != nil {
+		return err
+	}
+	_, err = conn.Do("DEL", s.key(addr))
+	return err
+}
+
+func (s *RedisDiscoveryService) Tombstones() ([]*discovery.Tombstone, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	keys, err := scanKeys(conn, s.tombstones)
+	if err != nil {
+		return nil, err
+	}
+
+	tombstones := []*discovery.Tombstone{}
+	for _, key := range keys {
+		data, err := redis.Bytes(conn.Do("GET", key))
+		if err == redis.ErrNil {
+			// Removed since the scan.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tombstone := &discovery.Tombstone{}
+		if err := json.Unmarshal(data, tombstone); err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+	return tombstones, nil
+}
+
+func (s *RedisDiscoveryService) Lease(key, holder string, ttl time.Duration) (string, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	k := strings.TrimSuffix(s.prefix, "/") + "_" + key
+	return redis.String(lockScript.Do(conn, k, holder, int64(ttl/time.Millisecond)))
+}
+
+// Buckets are kept under siblings of the key prefix.
+func (s *RedisDiscoveryService) bucket(name string) string {
+	return strings.TrimSuffix(s.prefix, "/") + "_" + name + "/"
+}
+
+func (s *RedisDiscoveryService) Put(bucket, key string, value []byte) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", s.bucket(bucket)+key, value)
+	return err
+}
+
+func (s *RedisDiscoveryService) Delete(bucket, key string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", s.bucket(bucket)+key)
+	return err
+}
+
+func (s *RedisDiscoveryService) List(bucket string) (map[string][]byte, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	prefix := s.bucket(bucket)
+	keys, err := scanKeys(conn, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte)
+	for _, key := range keys {
+		data, err := redis.Bytes(conn.Do("GET", key))
+		if err == redis.ErrNil {
+			// Removed since the scan.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[strings.TrimPrefix(key, prefix)] = data
+	}
+	return values, nil
+}
+
+func (s *RedisDiscoveryService) key(addr string) string {
+	return s.prefix + addr
+}
+
+// waitForChange notifies on the keyspace events under the prefix. Keyspace
+// notifications have to be enabled on the server (notify-keyspace-events
+// "Kg$x" at least); as expired keys are not guaranteed to be notified right
+// away, a notification is also sent every heartbeat. The events received
+// while a notification is pending are coalesced into it, so that a burst of
+// changes triggers a single fetch, plus one if it comes during the fetch.
+func (s *RedisDiscoveryService) waitForChange() <-chan struct{} {
+	c := make(chan struct{}, 1)
+
+	go func() {
+		retry := s.heartbeat
+		if retry == 0 {
+			retry = time.Second
+		}
+		for {
+			if err := s.subscribe(c); err != nil {
+				log.WithField("name", "redis").Errorf("Discovery error: %v", err)
+			}
+			select {
+			case <-s.done:
+				return
+			case <-time.After(retry):
+			}
+		}
+	}()
+
+	if s.heartbeat > 0 {
+		go func() {
+			ticker := time.NewTicker(s.heartbeat)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-s.done:
+					return
+				case <-ticker.C:
+					notify(c)
+				}
+			}
+		}()
+	}
+
+	return c
+}
+
+// subscribe notifies `c` of the keyspace events until the subscription fails
+// or the service is stopped.
+func (s *RedisDiscoveryService) subscribe(c chan<- struct{}) error {
+	psc := redis.PubSubConn{Conn: s.pool.Get()}
+	defer psc.Close()
+
+	if err := psc.PSubscribe("__keyspace@*__:" + s.prefix + "*"); err != nil {
+		return err
+	}
+	// Unsubscribing, which may be done while receiving, ends the loop. The
+	// connection is only closed once it's done.
+	received := make(chan struct{})
+	unsubscribed := make(chan struct{})
+	defer func() {
+		close(received)
+		<-unsubscribed
+	}()
+	go func() {
+		defer close(unsubscribed)
+		select {
+		case <-s.done:
+			psc.PUnsubscribe()
+		case <-received:
+		}
+	}()
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.PMessage:
+			notify(c)
+		case redis.Subscription:
+			if v.Count == 0 {
+				return nil
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+// notify sends on `c` unless a notification is already pending.
+func notify(c chan<- struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
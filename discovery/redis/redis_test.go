@@ -0,0 +1,404 @@
+package redis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/swarm/discovery"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// deadServer returns the address of a server closing the connections right
+// away, for the redis client to fail on.
+func deadServer(t *testing.T) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func TestInitialize(t *testing.T) {
+	discovery := &RedisDiscoveryService{}
+	addr, closeServer := deadServer(t)
+	defer closeServer()
+
+	assert.Equal(t, discovery.Initialize("127.0.0.1", 0).Error(), "invalid format \"127.0.0.1\", missing <keyprefix>")
+	assert.Equal(t, discovery.Initialize("127.0.0.1/", 0).Error(), "invalid format \"127.0.0.1/\", missing <keyprefix>")
+
+	assert.Error(t, discovery.Initialize(addr+"/prefix", 0))
+	assert.Equal(t, discovery.prefix, "prefix/")
+	assert.Equal(t, discovery.ttl, 0)
+
+	assert.Error(t, discovery.Initialize(addr+"/path/to/prefix/", 10))
+	assert.Equal(t, discovery.prefix, "path/to/prefix/")
+	assert.Equal(t, discovery.tombstones, "path/to/prefix_tombstones/")
+	assert.Equal(t, discovery.ttl, 15)
+	assert.Equal(t, discovery.key("1.1.1.1:1111"), "path/to/prefix/1.1.1.1:1111")
+}
+
+func TestNotifyCoalesces(t *testing.T) {
+	c := make(chan struct{}, 1)
+	notify(c)
+	notify(c)
+	assert.Len(t, c, 1)
+
+	<-c
+	notify(c)
+	assert.Len(t, c, 1)
+}
+
+// fakeServer keeps in memory the keys the fake connections act on, and
+// notifies the keyspace events of their changes to the subscribed ones.
+type fakeServer struct {
+	sync.Mutex
+	values      map[string]string
+	ttls        map[string]int64
+	scripts     map[string]bool
+	subscribers map[*fakeConn]string
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{
+		values:      make(map[string]string),
+		ttls:        make(map[string]int64),
+		scripts:     make(map[string]bool),
+		subscribers: make(map[*fakeConn]string),
+	}
+}
+
+func (s *fakeServer) dial() (redis.Conn, error) {
+	return &fakeConn{server: s, replies: make(chan interface{}, 100), closed: make(chan struct{})}, nil
+}
+
+// set stores `key`, expiring after `ttl` in the unit of the command if not 0,
+// and notifies the subscribers.
+func (s *fakeServer) set(key, value string, ttl int64) {
+	s.values[key] = value
+	delete(s.ttls, key)
+	if ttl > 0 {
+		s.ttls[key] = ttl
+	}
+	s.notify(key, "set")
+}
+
+func (s *fakeServer) del(key string) int64 {
+	if _, ok := s.values[key]; !ok {
+		return 0
+	}
+	delete(s.values, key)
+	delete(s.ttls, key)
+	s.notify(key, "del")
+	return 1
+}
+
+func (s *fakeServer) notify(key, event string) {
+	for c, pattern := range s.subscribers {
+		if strings.HasPrefix(key, strings.TrimSuffix(strings.TrimPrefix(pattern, "__keyspace@*__:"), "*")) {
+			c.replies <- []interface{}{[]byte("pmessage"), []byte(pattern), []byte("__keyspace@0__:" + key), []byte(event)}
+		}
+	}
+}
+
+// scan pages the keys by 2, each page starting again with the last key of
+// the previous one, as SCAN may return a key more than once.
+func (s *fakeServer) scan(cursor int, pattern string) []interface{} {
+	keys := []string{}
+	for key := range s.values {
+		if strings.HasPrefix(key, strings.TrimSuffix(pattern, "*")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	batch := []interface{}{}
+	end := cursor + 2
+	if end >= len(keys) {
+		end = len(keys)
+	}
+	for _, key := range keys[cursor:end] {
+		batch = append(batch, []byte(key))
+	}
+	next := 0
+	if end < len(keys) {
+		next = end - 1
+	}
+	return []interface{}{[]byte(fmt.Sprint(next)), batch}
+}
+
+// lease runs the lock script.
+func (s *fakeServer) lease(key, holder string, ttl int64) []byte {
+	current, ok := s.values[key]
+	if !ok {
+		s.set(key, holder, ttl)
+		return []byte(holder)
+	}
+	if current == holder {
+		s.ttls[key] = ttl
+	}
+	return []byte(current)
+}
+
+func (s *fakeServer) Subscribers() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.subscribers)
+}
+
+func (s *fakeServer) TTL(key string) int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.ttls[key]
+}
+
+func (s *fakeServer) Expire(key string) {
+	s.Lock()
+	defer s.Unlock()
+	s.del(key)
+}
+
+// fakeConn is a connection to a fakeServer. The replies to the commands sent
+// are received in order.
+type fakeConn struct {
+	server  *fakeServer
+	replies chan interface{}
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func (c *fakeConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	c.server.Lock()
+	delete(c.server.subscribers, c)
+	c.server.Unlock()
+	return nil
+}
+
+func (c *fakeConn) Err() error {
+	return nil
+}
+
+func (c *fakeConn) Flush() error {
+	return nil
+}
+
+func (c *fakeConn) Send(command string, args ...interface{}) error {
+	s := c.server
+	s.Lock()
+	defer s.Unlock()
+
+	switch command {
+	case "PSUBSCRIBE":
+		s.subscribers[c] = args[0].(string)
+		c.replies <- []interface{}{[]byte("psubscribe"), []byte(s.subscribers[c]), int64(1)}
+	case "PUNSUBSCRIBE":
+		delete(s.subscribers, c)
+		c.replies <- []interface{}{[]byte("punsubscribe"), nil, int64(0)}
+	case "UNSUBSCRIBE":
+		c.replies <- []interface{}{[]byte("unsubscribe"), nil, int64(0)}
+	case "ECHO":
+		c.replies <- args[0]
+	default:
+		reply, err := c.do(command, args...)
+		if err != nil {
+			reply = err
+		}
+		c.replies <- reply
+	}
+	return nil
+}
+
+func (c *fakeConn) Receive() (interface{}, error) {
+	select {
+	case reply := <-c.replies:
+		if err, ok := reply.(error); ok {
+			return nil, err
+		}
+		return reply, nil
+	case <-c.closed:
+		return nil, errors.New("closed")
+	}
+}
+
+func (c *fakeConn) Do(command string, args ...interface{}) (interface{}, error) {
+	if command == "" {
+		return nil, nil
+	}
+	c.server.Lock()
+	defer c.server.Unlock()
+	return c.do(command, args...)
+}
+
+func (c *fakeConn) do(command string, args ...interface{}) (interface{}, error) {
+	s := c.server
+	str := func(i int) string {
+		switch v := args[i].(type) {
+		case []byte:
+			return string(v)
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+	num := func(i int) int64 {
+		n, err := strconv.ParseInt(str(i), 10, 64)
+		if err != nil {
+			panic(err)
+		}
+		return n
+	}
+	switch command {
+	case "PING":
+		return "PONG", nil
+	case "SET":
+		s.set(str(0), str(1), 0)
+		return "OK", nil
+	case "SETEX":
+		s.set(str(0), str(2), num(1))
+		return "OK", nil
+	case "GET":
+		if value, ok := s.values[str(0)]; ok {
+			return []byte(value), nil
+		}
+		return nil, nil
+	case "DEL":
+		return s.del(str(0)), nil
+	case "SCAN":
+		return s.scan(int(num(0)), str(2)), nil
+	case "EVAL":
+		sum := sha1.Sum([]byte(str(0)))
+		s.scripts[hex.EncodeToString(sum[:])] = true
+		return s.lease(str(2), str(3), num(4)), nil
+	case "EVALSHA":
+		if !s.scripts[str(0)] {
+			return nil, redis.Error("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		return s.lease(str(2), str(3), num(4)), nil
+	}
+	return nil, fmt.Errorf("unexpected command %s", command)
+}
+
+func newFakeService(t *testing.T, heartbeat int) (*RedisDiscoveryService, *fakeServer) {
+	server := newFakeServer()
+	s := &RedisDiscoveryService{}
+	assert.NoError(t, s.initialize("swarm/", heartbeat, server.dial))
+	return s, server
+}
+
+func TestRegister(t *testing.T) {
+	s, server := newFakeService(t, 10)
+
+	for _, addr := range []string{"1.1.1.1:1111", "2.2.2.2:2222", "3.3.3.3:3333", "4.4.4.4:4444"} {
+		assert.NoError(t, s.Register(addr))
+	}
+	// The keys expire unless registered again within 1.5 heartbeats.
+	assert.Equal(t, server.TTL("swarm/1.1.1.1:1111"), int64(15))
+
+	entries, err := s.Fetch()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+	assert.Equal(t, entries[0].String(), "1.1.1.1:1111")
+	assert.Equal(t, entries[3].String(), "4.4.4.4:4444")
+
+	assert.NoError(t, s.Deregister("2.2.2.2:2222"))
+	entries, err = s.Fetch()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, entries[1].String(), "3.3.3.3:3333")
+
+	// Nor expire without a heartbeat.
+	s, server = newFakeService(t, 0)
+	assert.NoError(t, s.Register("1.1.1.1:1111"))
+	assert.Equal(t, server.TTL("swarm/1.1.1.1:1111"), int64(0))
+	entries, err = s.Fetch()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestLease(t *testing.T) {
+	s, server := newFakeService(t, 10)
+
+	holder, err := s.Lease("leader", "1.1.1.1:4000", 2*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, holder, "1.1.1.1:4000")
+	assert.Equal(t, server.TTL("swarm_leader"), int64(2000))
+	// The script was loaded on the first lease.
+	assert.True(t, server.scripts[lockScript.Hash()])
+
+	holder, err = s.Lease("leader", "2.2.2.2:4000", 2*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, holder, "1.1.1.1:4000")
+
+	holder, err = s.Lease("leader", "1.1.1.1:4000", 3*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, holder, "1.1.1.1:4000")
+	assert.Equal(t, server.TTL("swarm_leader"), int64(3000))
+
+	server.Expire("swarm_leader")
+	holder, err = s.Lease("leader", "2.2.2.2:4000", 2*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, holder, "2.2.2.2:4000")
+}
+
+func TestWatch(t *testing.T) {
+	s, server := newFakeService(t, 0)
+
+	watched := make(chan []*discovery.Entry, 10)
+	stopped := make(chan struct{})
+	go func() {
+		s.Watch(func(entries []*discovery.Entry) { watched <- entries })
+		close(stopped)
+	}()
+	waitFor(t, func() bool { return server.Subscribers() == 1 })
+
+	// The nodes are fetched again on the changes of their keys.
+	assert.NoError(t, s.Register("1.1.1.1:1111"))
+	select {
+	case entries := <-watched:
+		assert.Len(t, entries, 1)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the registration was not notified")
+	}
+	assert.NoError(t, s.Put("containers", "id", []byte("{}")))
+	assert.NoError(t, s.Deregister("1.1.1.1:1111"))
+	select {
+	case entries := <-watched:
+		assert.Empty(t, entries)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the deregistration was not notified")
+	}
+
+	s.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch goes on after Stop")
+	}
+	waitFor(t, func() bool { return server.Subscribers() == 0 })
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	for i := 0; i < 500; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out")
+}
@@ -0,0 +1,298 @@
+// Package testutil provides an in-memory discovery service for testing code
+// that consumes a discovery.DiscoveryService, without talking to a real
+// backend.
+package testutil
+
+import (
+	"sync"
+	"time"
+
+	"github.com/docker/swarm/discovery"
+)
+
+// FakeDiscoveryService is an in-memory discovery.DiscoveryService. Tests push
+// arbitrary sets of entries into it and drive the Watch callbacks on demand.
+//
+// It can be handed directly to the code under test, or made available through
+// discovery.New with discovery.Register("fake", d).
+type FakeDiscoveryService struct {
+	sync.Mutex
+
+	uri        string
+	heartbeat  int
+	entries    []*discovery.Entry
+	registered []string
+	tombstones []*discovery.Tombstone
+	leases     map[string]*lease
+	buckets    map[string]map[string][]byte
+	err        error
+	watchers   []*watcher
+	cond       *sync.Cond
+}
+
+type lease struct {
+	holder  string
+	expires time.Time
+}
+
+type watcher struct {
+	updates chan []*discovery.Entry
+	done    chan struct{}
+}
+
+// NewFakeDiscoveryService returns a fake discovery service serving `entries`.
+func NewFakeDiscoveryService(entries ...*discovery.Entry) *FakeDiscoveryService {
+	s := &FakeDiscoveryService{entries: entries, leases: make(map[string]*lease), buckets: make(map[string]map[string][]byte)}
+	s.cond = sync.NewCond(&s.Mutex)
+	return s
+}
+
+// Initialize records its arguments so tests can inspect them and never fails.
+func (s *FakeDiscoveryService) Initialize(uri string, heartbeat int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.uri = uri
+	s.heartbeat = heartbeat
+	return nil
+}
+
+// URI returns the uri the service was initialized with.
+func (s *FakeDiscoveryService) URI() string {
+	s.Lock()
+	defer s.Unlock()
+	return s.uri
+}
+
+// Heartbeat returns the heartbeat the service was initialized with.
+func (s *FakeDiscoveryService) Heartbeat() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.heartbeat
+}
+
+// Fetch returns the current set of entries, or the error set with SetError.
+func (s *FakeDiscoveryService) Fetch() ([]*discovery.Entry, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.copyEntries(), nil
+}
+
+// Watch blocks and invokes `callback` every time entries are pushed, until
+// Close is called.
+func (s *FakeDiscoveryService) Watch(callback discovery.WatchCallback) {
+	w := &watcher{
+		updates: make(chan []*discovery.Entry),
+		done:    make(chan struct{}),
+	}
+
+	s.Lock()
+	s.watchers = append(s.watchers, w)
+	s.cond.Broadcast()
+	s.Unlock()
+
+	for entries := range w.updates {
+		callback(entries)
+		w.done <- struct{}{}
+	}
+}
+
+// Register adds `addr` to the set of entries. It doesn't notify watchers.
+func (s *FakeDiscoveryService) Register(addr string) error {
+	entry, err := discovery.NewEntry(addr)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.registered = append(s.registered, addr)
+	for _, e := range s.entries {
+		if e.String() == entry.String() {
+			return nil
+		}
+	}
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Registered returns every address passed to Register, in order.
+func (s *FakeDiscoveryService) Registered() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	registered := make([]string, len(s.registered))
+	copy(registered, s.registered)
+	return registered
+}
+
+// Deregister removes `addr` from the set of entries. It doesn't notify
+// watchers.
+func (s *FakeDiscoveryService) Deregister(addr string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	entries := []*discovery.Entry{}
+	for _, e := range s.entries {
+		if e.String() != addr {
+			entries = append(entries, e)
+		}
+	}
+	s.entries = entries
+	return nil
+}
+
+// Tombstone records a tombstone for `addr` and deregisters it.
+func (s *FakeDiscoveryService) Tombstone(addr, reason string) error {
+	s.Lock()
+	s.tombstones = append(s.tombstones, discovery.NewTombstone(addr, reason))
+	s.Unlock()
+
+	return s.Deregister(addr)
+}
+
+// Tombstones returns every tombstone recorded so far, in order.
+func (s *FakeDiscoveryService) Tombstones() ([]*discovery.Tombstone, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	tombstones := make([]*discovery.Tombstone, len(s.tombstones))
+	copy(tombstones, s.tombstones)
+	return tombstones, nil
+}
+
+// Lease takes the lease `key` if it's free or expired, or renews it if `holder`
+// already holds it. It fails with the error set with SetError.
+func (s *FakeDiscoveryService) Lease(key, holder string, ttl time.Duration) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.err != nil {
+		return "", s.err
+	}
+
+	now := time.Now()
+	if l, ok := s.leases[key]; ok && l.holder != holder && now.Before(l.expires) {
+		return l.holder, nil
+	}
+	s.leases[key] = &lease{holder: holder, expires: now.Add(ttl)}
+	return holder, nil
+}
+
+// Expire makes the lease `key` expire right away.
+func (s *FakeDiscoveryService) Expire(key string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.leases, key)
+}
+
+// Put stores `value` in memory. It fails with the error set with SetError.
+func (s *FakeDiscoveryService) Put(bucket, key string, value []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = make(map[string][]byte)
+	}
+	s.buckets[bucket][key] = append([]byte{}, value...)
+	return nil
+}
+
+// Delete removes the key from memory.
+func (s *FakeDiscoveryService) Delete(bucket, key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.buckets[bucket], key)
+	return nil
+}
+
+// List returns a copy of the values of `bucket`. It fails with the error set
+// with SetError.
+func (s *FakeDiscoveryService) List(bucket string) (map[string][]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	values := make(map[string][]byte)
+	for key, value := range s.buckets[bucket] {
+		values[key] = append([]byte{}, value...)
+	}
+	return values, nil
+}
+
+// SetError makes subsequent calls to Fetch, Lease, Put and List fail with
+// `err`. Passing nil restores normal behavior.
+func (s *FakeDiscoveryService) SetError(err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.err = err
+}
+
+// Push replaces the set of entries and triggers every active watcher. It
+// returns once all the callbacks have returned.
+func (s *FakeDiscoveryService) Push(entries []*discovery.Entry) {
+	s.Lock()
+	s.entries = entries
+	s.Unlock()
+
+	s.Trigger()
+}
+
+// Trigger invokes every active watcher with the current set of entries and
+// returns once all the callbacks have returned.
+func (s *FakeDiscoveryService) Trigger() {
+	s.Lock()
+	watchers := make([]*watcher, len(s.watchers))
+	copy(watchers, s.watchers)
+	s.Unlock()
+
+	// Callbacks run without the lock held so they may call back into the
+	// service.
+	for _, w := range watchers {
+		s.Lock()
+		entries := s.copyEntries()
+		s.Unlock()
+
+		w.updates <- entries
+		<-w.done
+	}
+}
+
+// WaitForWatchers blocks until at least `n` calls to Watch are active.
+func (s *FakeDiscoveryService) WaitForWatchers(n int) {
+	s.Lock()
+	defer s.Unlock()
+
+	for len(s.watchers) < n {
+		s.cond.Wait()
+	}
+}
+
+// Close terminates every active Watch. It must not be called concurrently
+// with Push or Trigger.
+func (s *FakeDiscoveryService) Close() {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, w := range s.watchers {
+		close(w.updates)
+	}
+	s.watchers = nil
+}
+
+func (s *FakeDiscoveryService) copyEntries() []*discovery.Entry {
+	entries := make([]*discovery.Entry, len(s.entries))
+	copy(entries, s.entries)
+	return entries
+}
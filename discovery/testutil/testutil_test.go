@@ -0,0 +1,122 @@
+package testutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/docker/swarm/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitialize(t *testing.T) {
+	d := NewFakeDiscoveryService()
+	assert.NoError(t, d.Initialize("path/to/cluster", 10))
+	assert.Equal(t, d.URI(), "path/to/cluster")
+	assert.Equal(t, d.Heartbeat(), 10)
+}
+
+func TestFetch(t *testing.T) {
+	entries, err := discovery.CreateEntries([]string{"1.1.1.1:1111", "2.2.2.2:2222"})
+	assert.NoError(t, err)
+
+	d := NewFakeDiscoveryService(entries...)
+	fetched, err := d.Fetch()
+	assert.NoError(t, err)
+	assert.Equal(t, fetched, entries)
+
+	d.SetError(errors.New("fail"))
+	_, err = d.Fetch()
+	assert.Error(t, err)
+
+	d.SetError(nil)
+	_, err = d.Fetch()
+	assert.NoError(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	d := NewFakeDiscoveryService()
+	assert.NoError(t, d.Register("1.1.1.1:1111"))
+	assert.NoError(t, d.Register("1.1.1.1:1111"))
+	assert.Error(t, d.Register("1.1.1.1"))
+
+	entries, err := d.Fetch()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, entries[0].String(), "1.1.1.1:1111")
+	assert.Equal(t, d.Registered(), []string{"1.1.1.1:1111", "1.1.1.1:1111"})
+}
+
+func TestKV(t *testing.T) {
+	d := NewFakeDiscoveryService()
+	var _ discovery.KVService = d
+
+	values, err := d.List("bucket")
+	assert.NoError(t, err)
+	assert.Empty(t, values)
+
+	assert.NoError(t, d.Put("bucket", "a", []byte("1")))
+	assert.NoError(t, d.Put("bucket", "b", []byte("2")))
+	assert.NoError(t, d.Put("other", "a", []byte("3")))
+	assert.NoError(t, d.Delete("bucket", "b"))
+	assert.NoError(t, d.Delete("bucket", "unknown"))
+
+	values, err = d.List("bucket")
+	assert.NoError(t, err)
+	assert.Equal(t, values, map[string][]byte{"a": []byte("1")})
+
+	d.SetError(errors.New("fail"))
+	assert.Error(t, d.Put("bucket", "c", []byte("4")))
+	_, err = d.List("bucket")
+	assert.Error(t, err)
+}
+
+func TestDeregister(t *testing.T) {
+	d := NewFakeDiscoveryService()
+	assert.NoError(t, d.Register("1.1.1.1:1111"))
+	assert.NoError(t, d.Register("2.2.2.2:2222"))
+	assert.NoError(t, d.Deregister("1.1.1.1:1111"))
+
+	entries, err := d.Fetch()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, entries[0].String(), "2.2.2.2:2222")
+
+	assert.NoError(t, discovery.Deregister(d, "2.2.2.2:2222", "test", true))
+	entries, err = d.Fetch()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	tombstones, err := d.Tombstones()
+	assert.NoError(t, err)
+	assert.Len(t, tombstones, 1)
+	assert.Equal(t, tombstones[0].Addr, "2.2.2.2:2222")
+	assert.Equal(t, tombstones[0].Reason, "test")
+}
+
+func TestWatch(t *testing.T) {
+	d := NewFakeDiscoveryService()
+
+	received := [][]*discovery.Entry{}
+	stopped := make(chan struct{})
+	go func() {
+		d.Watch(func(entries []*discovery.Entry) {
+			received = append(received, entries)
+		})
+		close(stopped)
+	}()
+	d.WaitForWatchers(1)
+
+	entries, err := discovery.CreateEntries([]string{"1.1.1.1:1111"})
+	assert.NoError(t, err)
+	d.Push(entries)
+	assert.Len(t, received, 1)
+	assert.Equal(t, received[0], entries)
+
+	// Trigger re-sends the current set even though nothing changed.
+	d.Trigger()
+	assert.Len(t, received, 2)
+	assert.Equal(t, received[1], entries)
+
+	d.Close()
+	<-stopped
+}
@@ -7,7 +7,6 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/docker/swarm/discovery"
 )
@@ -15,9 +14,9 @@ import (
 const DISCOVERY_URL = "https://discovery-stage.hub.docker.com/v1"
 
 type TokenDiscoveryService struct {
-	heartbeat int
-	url       string
-	token     string
+	discovery.Heartbeat
+	url   string
+	token string
 }
 
 func init() {
@@ -36,7 +35,7 @@ func (s *TokenDiscoveryService) Initialize(urltoken string, heartbeat int) error
 	if s.token == "" {
 		return errors.New("token is empty")
 	}
-	s.heartbeat = heartbeat
+	s.SetHeartbeat(heartbeat)
 
 	return nil
 }
@@ -64,11 +63,13 @@ func (s *TokenDiscoveryService) Fetch() ([]*discovery.Entry, error) {
 }
 
 func (s *TokenDiscoveryService) Watch(callback discovery.WatchCallback) {
-	for _ = range time.Tick(time.Duration(s.heartbeat) * time.Second) {
+	for _ = range s.Tick() {
 		entries, err := s.Fetch()
-		if err == nil {
-			callback(entries)
+		if err != nil {
+			discovery.FetchFailed("token")
+			continue
 		}
+		callback(entries)
 	}
 }
 
@@ -87,6 +88,11 @@ func (s *TokenDiscoveryService) Register(addr string) error {
 	return nil
 }
 
+// Deregister is not supported by the hosted discovery service.
+func (s *TokenDiscoveryService) Deregister(addr string) error {
+	return discovery.ErrNotImplemented
+}
+
 // CreateCluster returns a unique cluster token
 func (s *TokenDiscoveryService) CreateCluster() (string, error) {
 	resp, err := http.Post(fmt.Sprintf("%s/%s", s.url, "clusters"), "", nil)
@@ -1,6 +1,7 @@
 package zookeeper
 
 import (
+	"encoding/json"
 	"fmt"
 	"path"
 	"strings"
@@ -25,9 +26,25 @@ func (s *ZkDiscoveryService) fullpath() string {
 	return "/" + strings.Join(s.path, "/")
 }
 
+// Tombstones are kept in a sibling of the discovery path.
+func (s *ZkDiscoveryService) tombstonesPath() []string {
+	return s.siblingPath("_tombstones")
+}
+
+func (s *ZkDiscoveryService) siblingPath(suffix string) []string {
+	p := make([]string, len(s.path))
+	copy(p, s.path)
+	p[len(p)-1] += suffix
+	return p
+}
+
 func (s *ZkDiscoveryService) createFullpath() error {
-	for i := 1; i <= len(s.path); i++ {
-		newpath := "/" + strings.Join(s.path[:i], "/")
+	return s.createPath(s.path)
+}
+
+func (s *ZkDiscoveryService) createPath(p []string) error {
+	for i := 1; i <= len(p); i++ {
+		newpath := "/" + strings.Join(p[:i], "/")
 		_, err := s.conn.Create(newpath, []byte{1}, 0, zk.WorldACL(zk.PermAll))
 		if err != nil {
 			// It's OK if key already existed. Just skip.
@@ -98,9 +115,11 @@ func (s *ZkDiscoveryService) Watch(callback discovery.WatchCallback) {
 		if e.Type == zk.EventNodeChildrenChanged {
 			log.WithField("name", "zk").Debug("Discovery watch triggered")
 			entries, err := s.Fetch()
-			if err == nil {
-				callback(entries)
+			if err != nil {
+				discovery.FetchFailed("zk")
+				continue
 			}
+			callback(entries)
 		}
 
 	}
@@ -142,3 +161,142 @@ func (s *ZkDiscoveryService) Register(addr string) error {
 	_, err = s.conn.Create(nodePath, []byte(addr), 0, zk.WorldACL(zk.PermAll))
 	return err
 }
+
+func (s *ZkDiscoveryService) Deregister(addr string) error {
+	err := s.conn.Delete(path.Join(s.fullpath(), addr), -1)
+	if err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	return nil
+}
+
+func (s *ZkDiscoveryService) Tombstone(addr, reason string) error {
+	data, err := json.Marshal(discovery.NewTombstone(addr, reason))
+	if err != nil {
+		return err
+	}
+
+	tombstones := s.tombstonesPath()
+	if err := s.createPath(tombstones); err != nil {
+		return err
+	}
+
+	nodePath := path.Join("/"+strings.Join(tombstones, "/"), addr)
+	if _, err := s.conn.Create(nodePath, data, 0, zk.WorldACL(zk.PermAll)); err != nil {
+		if err != zk.ErrNodeExists {
+			return err
+		}
+		// The node was already tombstoned, overwrite it.
+		if _, err := s.conn.Set(nodePath, data, -1); err != nil {
+			return err
+		}
+	}
+	return s.Deregister(addr)
+}
+
+func (s *ZkDiscoveryService) Tombstones() ([]*discovery.Tombstone, error) {
+	tombstones := []*discovery.Tombstone{}
+
+	parent := "/" + strings.Join(s.tombstonesPath(), "/")
+	addrs, _, err := s.conn.Children(parent)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return tombstones, nil
+		}
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		data, _, err := s.conn.Get(path.Join(parent, addr))
+		if err != nil {
+			return nil, err
+		}
+		tombstone := &discovery.Tombstone{}
+		if err := json.Unmarshal(data, tombstone); err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+	return tombstones, nil
+}
+
+// Lease holds the lease through an ephemeral node, which lives as long as the
+// zookeeper session: `ttl` is ignored.
+func (s *ZkDiscoveryService) Lease(key, holder string, ttl time.Duration) (string, error) {
+	nodePath := "/" + strings.Join(s.siblingPath("_"+key), "/")
+
+	_, err := s.conn.Create(nodePath, []byte(holder), zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	if err == nil {
+		return holder, nil
+	}
+	if err != zk.ErrNodeExists {
+		return "", err
+	}
+
+	data, _, err := s.conn.Get(nodePath)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			// The lease expired in the meantime.
+			return "", nil
+		}
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Buckets are kept in siblings of the discovery path.
+func (s *ZkDiscoveryService) bucketPath(name string) []string {
+	return s.siblingPath("_" + name)
+}
+
+func (s *ZkDiscoveryService) Put(bucket, key string, value []byte) error {
+	p := s.bucketPath(bucket)
+	if err := s.createPath(p); err != nil {
+		return err
+	}
+
+	nodePath := path.Join("/"+strings.Join(p, "/"), key)
+	if _, err := s.conn.Create(nodePath, value, 0, zk.WorldACL(zk.PermAll)); err != nil {
+		if err != zk.ErrNodeExists {
+			return err
+		}
+		if _, err := s.conn.Set(nodePath, value, -1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ZkDiscoveryService) Delete(bucket, key string) error {
+	err := s.conn.Delete(path.Join("/"+strings.Join(s.bucketPath(bucket), "/"), key), -1)
+	if err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	return nil
+}
+
+func (s *ZkDiscoveryService) List(bucket string) (map[string][]byte, error) {
+	values := make(map[string][]byte)
+
+	parent := "/" + strings.Join(s.bucketPath(bucket), "/")
+	keys, _, err := s.conn.Children(parent)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return values, nil
+		}
+		return nil, err
+	}
+
+	for _, key := range keys {
+		data, _, err := s.conn.Get(path.Join(parent, key))
+		if err != nil {
+			if err == zk.ErrNoNode {
+				// Removed since the listing.
+				continue
+			}
+			return nil, err
+		}
+		values[key] = data
+	}
+	return values, nil
+}
@@ -19,4 +19,6 @@ func TestInitialize(t *testing.T) {
 
 	assert.Error(t, service.Initialize("127.0.0.1,127.0.0.2,127.0.0.3/path/sub1/sub2", 0))
 	assert.Equal(t, service.fullpath(), "/path/sub1/sub2")
+	assert.Equal(t, service.tombstonesPath(), []string{"path", "sub1", "sub2_tombstones"})
+	assert.Equal(t, service.fullpath(), "/path/sub1/sub2")
 }
@@ -5,7 +5,9 @@ import (
 	"path/filepath"
 	"runtime"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/docker/swarm/discovery/plugin"
 )
 
 func homepath(p string) string {
@@ -23,6 +25,16 @@ func getDiscovery(c *cli.Context) string {
 	return os.Getenv("SWARM_DISCOVERY")
 }
 
+// Register the discovery services provided by the plugins in
+// --discovery-plugin-dir, if any.
+func loadDiscoveryPlugins(c *cli.Context) {
+	if dir := c.String("discovery-plugin-dir"); dir != "" {
+		if err := plugin.Load(dir); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
 var (
 	flStore = cli.StringFlag{
 		Name:  "rootdir",
@@ -45,15 +57,61 @@ var (
 		Usage:  "ip/socket to listen on",
 		EnvVar: "SWARM_HOST",
 	}
+	flManagerHost = cli.StringFlag{
+		Name:   "host, H",
+		Value:  "tcp://127.0.0.1:2375",
+		Usage:  "address of the swarm manager",
+		EnvVar: "DOCKER_HOST",
+	}
+	flDrainContainers = cli.StringFlag{
+		Name:  "containers",
+		Usage: "what to do with the containers of the node: keep them (default), \"stop\" or \"reschedule\" them",
+	}
 	flHeartBeat = cli.IntFlag{
 		Name:  "heartbeat, hb",
 		Value: 25,
 		Usage: "time in second between each heartbeat",
 	}
+	flDiscoveryPluginDir = cli.StringFlag{
+		Name:   "discovery-plugin-dir",
+		Usage:  "directory of the discovery plugins to load",
+		EnvVar: "SWARM_DISCOVERY_PLUGIN_DIR",
+	}
+	flDiscoveryCache = cli.StringFlag{
+		Name:  "discovery-cache",
+		Usage: "file to cache the nodes in, used when all the chained discovery services fail",
+	}
+	flReplication = cli.BoolFlag{
+		Name:  "replication",
+		Usage: "elect a primary among the managers of the cluster; replicas forward the requests to the primary",
+	}
+	flAdvertise = cli.StringFlag{
+		Name:   "advertise",
+		Usage:  "address (ip:port) under which this manager is reachable by the other managers",
+		EnvVar: "SWARM_ADVERTISE",
+	}
+	flReplicationTTL = cli.IntFlag{
+		Name:  "replication-ttl",
+		Value: 15,
+		Usage: "time in second after which the primary is replaced if it stops renewing its lease",
+	}
+	flTombstone = cli.BoolFlag{
+		Name:  "tombstone",
+		Usage: "on exit, leave a tombstone of the node in the discovery service instead of just deregistering it",
+	}
+	flListAll = cli.BoolFlag{
+		Name:  "all, a",
+		Usage: "also list the nodes which left the cluster",
+	}
 	flEnableCors = cli.BoolFlag{
 		Name:  "api-enable-cors, cors",
 		Usage: "enable CORS headers in the remote API",
 	}
+	flAuthToken = cli.StringFlag{
+		Name:   "auth-token",
+		Usage:  "token identifying the client to a manager running with --access-control",
+		EnvVar: "SWARM_AUTH_TOKEN",
+	}
 	flTls = cli.BoolFlag{
 		Name:  "tls",
 		Usage: "use TLS; implied by --tlsverify=true",
@@ -74,6 +132,33 @@ var (
 		Name:  "tlsverify",
 		Usage: "use TLS and verify the remote",
 	}
+	flTlsAutoCa = cli.BoolFlag{
+		Name:  "tls-auto-ca",
+		Usage: "use mutual TLS with certificates issued by a CA built in the manager and stored in <rootdir>/ca",
+	}
+	flTlsAutoCaToken = cli.StringFlag{
+		Name:   "tls-auto-ca-token",
+		Usage:  "token the nodes must present to get a certificate from the built-in CA",
+		EnvVar: "SWARM_CA_TOKEN",
+	}
+	flTlsAutoCaFingerprint = cli.StringFlag{
+		Name:  "tls-auto-ca-fingerprint",
+		Usage: "fingerprint of the built-in CA the manager must present, unless given with --tlscacert",
+	}
+	flTlsAutoCaManager = cli.StringFlag{
+		Name:  "tls-auto-ca-manager",
+		Usage: "address of a manager running with --tls-auto-ca to get and renew the certificate of the engine from",
+	}
+	flTlsCertTTL = cli.IntFlag{
+		Name:  "tls-cert-ttl",
+		Value: 720,
+		Usage: "lifetime in hours of the certificates issued by the built-in CA",
+	}
+	flTlsCertDir = cli.StringFlag{
+		Name:  "tls-cert-dir",
+		Value: homepath(".swarm/certs"),
+		Usage: "directory where to write the certificate fetched from the built-in CA, as ca.pem, cert.pem and key.pem",
+	}
 	flOverCommit = cli.Float64Flag{
 		Name:  "overcommit, oc",
 		Usage: "overcommit to apply on resources",
@@ -81,17 +166,90 @@ var (
 	}
 	flStrategy = cli.StringFlag{
 		Name:  "strategy",
-		Usage: "placement strategy to use [binpacking, random]",
+		Usage: "placement strategy to use [binpacking, random, weighted]",
 		Value: "binpacking",
 	}
+	flStatsInterval = cli.IntFlag{
+		Name:  "stats-interval",
+		Usage: "time in second between each sample of the actual usage of the nodes, 0 to disable",
+	}
+	flStatsCadvisorPort = cli.IntFlag{
+		Name:  "stats-cadvisor-port",
+		Usage: "sample the usage of the nodes from cAdvisor listening on this port instead of the engines",
+	}
+	flHealthInterval = cli.IntFlag{
+		Name:  "health-interval",
+		Usage: "time in second between each health check of the nodes, 0 to only rely on the state refresh",
+	}
+	flHealthFailures = cli.IntFlag{
+		Name:  "health-failures",
+		Usage: "number of consecutive failed health checks before a node is considered dead",
+		Value: 3,
+	}
+	flHealthSuccesses = cli.IntFlag{
+		Name:  "health-successes",
+		Usage: "number of consecutive successful health checks before a dead node is used again",
+		Value: 2,
+	}
+	flHealthMaxBackoff = cli.IntFlag{
+		Name:  "health-max-backoff",
+		Usage: "maximum time in second between each health check of a dead node",
+		Value: 60,
+	}
+	flAuditLog = cli.StringFlag{
+		Name:  "audit-log",
+		Usage: "file to append the scheduling decisions to, as JSON lines",
+	}
+	flConfig = cli.StringFlag{
+		Name:  "config",
+		Usage: "JSON file of the strategy, filters and heartbeat, overriding the flags, reloaded on SIGHUP",
+	}
+	flAccessControl = cli.StringFlag{
+		Name:  "access-control",
+		Usage: "JSON file of the identities allowed to use the API, and their roles",
+	}
+	flCreateWebhook = cli.StringSliceFlag{
+		Name:  "create-webhook",
+		Usage: "URL of a webhook reviewing the containers before they are created",
+		Value: &cli.StringSlice{},
+	}
+	flDenyPrivileged = cli.BoolFlag{
+		Name:  "deny-privileged",
+		Usage: "reject the privileged containers",
+	}
+	flRefreshWorkers = cli.IntFlag{
+		Name:  "refresh-workers",
+		Usage: "maximum number of nodes refreshing their state at the same time",
+		Value: 50,
+	}
+	flSchedulerWorkers = cli.IntFlag{
+		Name:  "scheduler-workers",
+		Usage: "maximum number of containers being placed at the same time",
+		Value: 16,
+	}
+	flRefreshInterval = cli.IntFlag{
+		Name:  "refresh-interval",
+		Usage: "time in second between each refresh of the state of a node, spread by up to 10%",
+		Value: 30,
+	}
+	flRefreshMaxBackoff = cli.IntFlag{
+		Name:  "refresh-max-backoff",
+		Usage: "maximum time in second between each refresh of a failing node",
+		Value: 300,
+	}
+	flStrategyOpt = cli.StringSliceFlag{
+		Name:  "strategy-opt",
+		Usage: "options of the placement strategy, as key=value",
+		Value: &cli.StringSlice{},
+	}
 
 	// hack for go vet
-	flFilterValue         = cli.StringSlice([]string{"constraint", "affinity", "health", "port", "dependency"})
+	flFilterValue         = cli.StringSlice([]string{"constraint", "affinity", "health", "port", "dependency", "volume", "network"})
 	DEFAULT_FILTER_NUMBER = len(flFilterValue)
 
 	flFilter = cli.StringSliceFlag{
 		Name:  "filter, f",
-		Usage: "filter to use [constraint, affinity, health, port, dependency]",
+		Usage: "filter to use [constraint, affinity, health, port, dependency, volume, network]",
 		Value: &flFilterValue,
 	}
 	flCluster = cli.StringFlag{
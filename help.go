@@ -19,8 +19,11 @@ ARGUMENTS:
    discovery{{printf "\t"}}discovery service to use [$SWARM_DISCOVERY]
             {{printf "\t"}} * token://<token>
             {{printf "\t"}} * consul://<ip1>,<ip2>/<path>
+            {{printf "\t"}} * dns://<srv_record>
             {{printf "\t"}} * etcd://<ip1>,<ip2>/<path>
             {{printf "\t"}} * file://path/to/file
+            {{printf "\t"}} * http(s)://<host>/<path>
+            {{printf "\t"}} * redis://<ip>/<keyprefix>
             {{printf "\t"}} * zk://<ip1>,<ip2>/<path>
             {{printf "\t"}} * <ip1>,<ip2>{{end}}{{if .Flags}}
 OPTIONS:
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"os/signal"
 	"regexp"
+	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -20,6 +24,7 @@ func join(c *cli.Context) {
 		log.Fatalf("discovery required to join a cluster. See '%s join --help'.", c.App.Name)
 	}
 
+	loadDiscoveryPlugins(c)
 	d, err := discovery.New(dflag, c.Int("heartbeat"))
 	if err != nil {
 		log.Fatal(err)
@@ -31,16 +36,57 @@ func join(c *cli.Context) {
 		log.Fatal("--addr should be of the form ip:port or hostname:port")
 	}
 
+	if c.String("tls-auto-ca-manager") != "" {
+		renewEngineCertificate(c)
+	}
+
 	if err := d.Register(addr); err != nil {
 		log.Fatal(err)
 	}
 
-	hb := time.Duration(c.Int("heartbeat"))
+	hb := time.Duration(c.Int("heartbeat")) * time.Second
+	log.WithFields(log.Fields{"addr": addr, "discovery": dflag}).Infof("Registering on the discovery service every %s...", hb)
+	if !c.Bool("tombstone") {
+		registerEvery(d, addr, hb, nil)
+		return
+	}
+
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		registerEvery(d, addr, hb, stop)
+		close(stopped)
+	}()
+	deregisterOnExit(d, addr, stop, stopped)
+}
+
+// registerEvery registers `addr` every heartbeat `hb` until `stop` is closed.
+func registerEvery(d discovery.DiscoveryService, addr string, hb time.Duration, stop <-chan struct{}) {
 	for {
-		log.WithFields(log.Fields{"addr": addr, "discovery": dflag}).Infof("Registering on the discovery service every %d seconds...", hb)
-		time.Sleep(hb * time.Second)
+		select {
+		case <-stop:
+			return
+		case <-time.After(hb):
+		}
 		if err := d.Register(addr); err != nil {
 			log.Error(err)
 		}
 	}
 }
+
+// deregisterOnExit leaves a tombstone of `addr` in the discovery service when
+// swarm is asked to stop. The registrations are stopped first, by closing
+// `stop`, and waited for until `stopped` is closed, so that none comes after
+// the tombstone.
+func deregisterOnExit(d discovery.DiscoveryService, addr string, stop chan<- struct{}, stopped <-chan struct{}) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	sig := <-sigs
+
+	log.WithField("addr", addr).Infof("%s received, deregistering from the discovery service", sig)
+	close(stop)
+	<-stopped
+	if err := discovery.Deregister(d, addr, fmt.Sprintf("%s received", sig), true); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(0)
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"testing"
+	"time"
 
+	"github.com/docker/swarm/discovery/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,3 +27,26 @@ func TestCheckAddrFormat(t *testing.T) {
 	assert.True(t, checkAddrFormat("hostname:1111"))
 	assert.True(t, checkAddrFormat("host-name_42:1111"))
 }
+
+func TestRegisterEveryStops(t *testing.T) {
+	d := testutil.NewFakeDiscoveryService()
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		registerEvery(d, "1.1.1.1:1111", time.Millisecond, stop)
+		close(stopped)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	<-stopped
+
+	entries, err := d.Fetch()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Once stopped, nothing registers the node again.
+	assert.NoError(t, d.Deregister("1.1.1.1:1111"))
+	time.Sleep(10 * time.Millisecond)
+	entries, err = d.Fetch()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
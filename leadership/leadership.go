@@ -0,0 +1,98 @@
+// Package leadership elects a primary among several swarm managers running
+// against the same discovery service.
+package leadership
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/swarm/discovery"
+)
+
+// Name of the lease held by the primary manager.
+const leaderKey = "leader"
+
+// A Candidate competes with the other managers for the primary lease.
+type Candidate struct {
+	sync.RWMutex
+
+	leases discovery.LeaseService
+	addr   string
+	ttl    time.Duration
+	leader string
+	// When the lease was last taken or renewed.
+	renewed time.Time
+}
+
+// NewCandidate returns a candidate advertising `addr`, whose lease expires
+// after `ttl` unless renewed.
+func NewCandidate(leases discovery.LeaseService, addr string, ttl time.Duration) *Candidate {
+	return &Candidate{
+		leases: leases,
+		addr:   addr,
+		ttl:    ttl,
+	}
+}
+
+// Run takes part in the election forever, renewing the lease three times per
+// ttl while it is held.
+func (c *Candidate) Run() {
+	for {
+		c.update()
+		time.Sleep(c.ttl / 3)
+	}
+}
+
+func (c *Candidate) update() {
+	// Taken before the request: the lease runs from when the backend got it.
+	asked := time.Now()
+	leader, err := c.leases.Lease(leaderKey, c.addr, c.ttl)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if err != nil {
+		// The backend may only be unreachable from here: the other managers
+		// can take the lease over once it expires. Until then, keep the
+		// current primary rather than leave the cluster without one.
+		if c.leader != c.addr || time.Since(c.renewed) < c.ttl {
+			log.WithField("name", "leadership").Errorf("Election error, keeping the current primary: %v", err)
+			return
+		}
+		log.WithField("name", "leadership").Errorf("Election error, stepping down as the lease expired: %v", err)
+		c.leader = ""
+		return
+	}
+	if leader == c.addr {
+		c.renewed = asked
+	}
+
+	if leader == c.leader {
+		return
+	}
+	c.leader = leader
+	switch leader {
+	case c.addr:
+		log.WithField("addr", c.addr).Info("Elected as primary manager")
+	case "":
+		log.Info("No primary manager elected")
+	default:
+		log.WithField("primary", leader).Info("Running as replica")
+	}
+}
+
+// IsLeader returns true if this candidate is the primary manager.
+func (c *Candidate) IsLeader() bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.leader == c.addr
+}
+
+// Leader returns the address of the primary manager, empty if none is
+// elected yet.
+func (c *Candidate) Leader() string {
+	c.RLock()
+	defer c.RUnlock()
+	return c.leader
+}
@@ -0,0 +1,65 @@
+package leadership
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/swarm/discovery/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElection(t *testing.T) {
+	d := testutil.NewFakeDiscoveryService()
+	primary := NewCandidate(d, "1.1.1.1:2375", time.Minute)
+	replica := NewCandidate(d, "2.2.2.2:2375", time.Minute)
+
+	assert.False(t, primary.IsLeader())
+	assert.Equal(t, primary.Leader(), "")
+
+	primary.update()
+	replica.update()
+	assert.True(t, primary.IsLeader())
+	assert.False(t, replica.IsLeader())
+	assert.Equal(t, replica.Leader(), "1.1.1.1:2375")
+
+	// Renewing doesn't change anything.
+	primary.update()
+	replica.update()
+	assert.True(t, primary.IsLeader())
+	assert.Equal(t, replica.Leader(), "1.1.1.1:2375")
+
+	// Failover once the lease of the primary expires.
+	d.Expire(leaderKey)
+	replica.update()
+	primary.update()
+	assert.True(t, replica.IsLeader())
+	assert.False(t, primary.IsLeader())
+	assert.Equal(t, primary.Leader(), "2.2.2.2:2375")
+}
+
+func TestElectionError(t *testing.T) {
+	d := testutil.NewFakeDiscoveryService()
+	c := NewCandidate(d, "1.1.1.1:2375", 50*time.Millisecond)
+
+	c.update()
+	assert.True(t, c.IsLeader())
+
+	// The primary is kept while the backend is down, until its lease
+	// expires: another manager may have taken it over.
+	d.SetError(errors.New("unreachable"))
+	c.update()
+	assert.True(t, c.IsLeader())
+	assert.Equal(t, c.Leader(), "1.1.1.1:2375")
+
+	time.Sleep(60 * time.Millisecond)
+	c.update()
+	assert.False(t, c.IsLeader())
+	assert.Equal(t, c.Leader(), "")
+
+	// It is elected again once the backend is back.
+	d.SetError(nil)
+	d.Expire(leaderKey)
+	c.update()
+	assert.True(t, c.IsLeader())
+}
@@ -9,9 +9,12 @@ import (
 	"github.com/codegangsta/cli"
 	"github.com/docker/swarm/discovery"
 	_ "github.com/docker/swarm/discovery/consul"
+	_ "github.com/docker/swarm/discovery/dns"
 	_ "github.com/docker/swarm/discovery/etcd"
 	_ "github.com/docker/swarm/discovery/file"
+	_ "github.com/docker/swarm/discovery/http"
 	_ "github.com/docker/swarm/discovery/nodes"
+	_ "github.com/docker/swarm/discovery/redis"
 	"github.com/docker/swarm/discovery/token"
 	_ "github.com/docker/swarm/discovery/zookeeper"
 	"github.com/docker/swarm/version"
@@ -77,12 +80,14 @@ func main() {
 			Name:      "list",
 			ShortName: "l",
 			Usage:     "list nodes in a cluster",
+			Flags:     []cli.Flag{flListAll, flDiscoveryPluginDir},
 			Action: func(c *cli.Context) {
 				dflag := getDiscovery(c)
 				if dflag == "" {
 					log.Fatalf("discovery required to list a cluster. See '%s list --help'.", c.App.Name)
 				}
 
+				loadDiscoveryPlugins(c)
 				d, err := discovery.New(dflag, 0)
 				if err != nil {
 					log.Fatal(err)
@@ -95,6 +100,20 @@ func main() {
 				for _, node := range nodes {
 					fmt.Println(node)
 				}
+
+				if c.Bool("all") {
+					ts, ok := discovery.Primary(d).(discovery.TombstoneService)
+					if !ok {
+						log.Fatal("tombstones are not supported by this discovery service")
+					}
+					tombstones, err := ts.Tombstones()
+					if err != nil {
+						log.Fatal(err)
+					}
+					for _, tombstone := range tombstones {
+						fmt.Println(tombstone)
+					}
+				}
 			},
 		},
 		{
@@ -103,18 +122,44 @@ func main() {
 			Usage:     "manage a docker cluster",
 			Flags: []cli.Flag{
 				flStore, flCluster,
-				flStrategy, flFilter,
+				flConfig, flStrategy, flStrategyOpt, flFilter, flAuditLog, flSchedulerWorkers,
+				flStatsInterval, flStatsCadvisorPort,
+				flHealthInterval, flHealthFailures, flHealthSuccesses, flHealthMaxBackoff,
+				flRefreshWorkers, flRefreshInterval, flRefreshMaxBackoff,
 				flHosts, flHeartBeat, flOverCommit,
 				flTls, flTlsCaCert, flTlsCert, flTlsKey, flTlsVerify,
-				flEnableCors},
+				flTlsAutoCa, flTlsAutoCaToken, flTlsCertTTL,
+				flEnableCors, flAccessControl, flCreateWebhook, flDenyPrivileged, flDiscoveryPluginDir, flDiscoveryCache,
+				flReplication, flAdvertise, flReplicationTTL},
 			Action: manage,
 		},
 		{
 			Name:      "join",
 			ShortName: "j",
 			Usage:     "join a docker cluster",
-			Flags:     []cli.Flag{flAddr, flHeartBeat},
-			Action:    join,
+			Flags: []cli.Flag{flAddr, flHeartBeat, flTombstone, flDiscoveryPluginDir,
+				flTlsAutoCaManager, flTlsAutoCaToken, flTlsAutoCaFingerprint, flTlsCaCert, flTlsCertDir},
+			Action: join,
+		},
+		{
+			Name:   "cert",
+			Usage:  "get a client certificate from a manager running with --tls-auto-ca",
+			Flags:  []cli.Flag{flManagerHost, flTlsAutoCaToken, flTlsAutoCaFingerprint, flTlsCaCert, flTlsCertDir},
+			Action: cert,
+		},
+		{
+			Name:  "drain",
+			Usage: "stop scheduling containers on a node, <node> being its ID, name or address",
+			Flags: []cli.Flag{flManagerHost, flDrainContainers, flAuthToken,
+				flTls, flTlsCaCert, flTlsCert, flTlsKey, flTlsVerify},
+			Action: drain,
+		},
+		{
+			Name:  "activate",
+			Usage: "schedule containers on a drained node again",
+			Flags: []cli.Flag{flManagerHost, flAuthToken,
+				flTls, flTlsCaCert, flTlsCert, flTlsKey, flTlsVerify},
+			Action: activate,
 		},
 	}
 
@@ -6,15 +6,17 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 	"github.com/docker/swarm/api"
+	"github.com/docker/swarm/ca"
 	"github.com/docker/swarm/cluster"
 	"github.com/docker/swarm/cluster/swarm"
+	"github.com/docker/swarm/discovery"
+	"github.com/docker/swarm/leadership"
 	"github.com/docker/swarm/scheduler"
-	"github.com/docker/swarm/scheduler/filter"
-	"github.com/docker/swarm/scheduler/strategy"
 	"github.com/docker/swarm/state"
 )
 
@@ -68,8 +70,22 @@ func manage(c *cli.Context) {
 		err       error
 	)
 
-	// If either --tls or --tlsverify are specified, load the certificates.
-	if c.Bool("tls") || c.Bool("tlsverify") {
+	// see https://github.com/codegangsta/cli/issues/160
+	hosts := c.StringSlice("host")
+	if c.IsSet("host") || c.IsSet("H") {
+		hosts = hosts[1:]
+	}
+
+	var authority *ca.Authority
+	if c.Bool("tls-auto-ca") {
+		if c.Bool("tls") || c.Bool("tlsverify") || c.IsSet("tlscert") || c.IsSet("tlskey") || c.IsSet("tlscacert") {
+			log.Fatal("--tls-auto-ca can't be used with certificates given with --tlscert, --tlskey and --tlscacert")
+		}
+		var renewer *ca.Renewer
+		authority, renewer = autoCaTlsConfig(c, hosts)
+		tlsConfig = renewer.TLSConfig(authority.Pool())
+	} else if c.Bool("tls") || c.Bool("tlsverify") {
+		// If either --tls or --tlsverify are specified, load the certificates.
 		if !c.IsSet("tlscert") || !c.IsSet("tlskey") {
 			log.Fatal("--tlscert and --tlskey must be provided when using --tls")
 		}
@@ -97,42 +113,112 @@ func manage(c *cli.Context) {
 		log.Fatal(err)
 	}
 
+	// see https://github.com/codegangsta/cli/issues/160
+	names := c.StringSlice("filter")
+	if c.IsSet("filter") || c.IsSet("f") {
+		names = names[DEFAULT_FILTER_NUMBER:]
+	}
+	reloader := &reloader{
+		path: c.String("config"),
+		defaults: managerConfig{
+			Strategy:     c.String("strategy"),
+			StrategyOpts: c.StringSlice("strategy-opt"),
+			Filters:      names,
+			Heartbeat:    c.Int("heartbeat"),
+		},
+	}
+	config, err := reloader.load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	dflag := getDiscovery(c)
 	if dflag == "" {
 		log.Fatalf("discovery required to manage a cluster. See '%s manage --help'.", c.App.Name)
 	}
-
-	s, err := strategy.New(c.String("strategy"))
+	loadDiscoveryPlugins(c)
+	d, err := discovery.New(dflag, config.Heartbeat)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	// see https://github.com/codegangsta/cli/issues/160
-	names := c.StringSlice("filter")
-	if c.IsSet("filter") || c.IsSet("f") {
-		names = names[DEFAULT_FILTER_NUMBER:]
+	if path := c.String("discovery-cache"); path != "" {
+		failover, ok := d.(*discovery.Failover)
+		if !ok {
+			log.Fatal("--discovery-cache requires several chained discovery services")
+		}
+		if err := failover.CacheTo(path); err != nil {
+			log.Fatal(err)
+		}
 	}
-	fs, err := filter.New(names)
+
+	s, fs, err := config.placement()
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	sched := scheduler.New(s, fs)
+	reloader.scheduler, reloader.discovery, reloader.heartbeat = sched, d, config.Heartbeat
+	go reloader.reloadOnSignal()
+	if file := c.String("audit-log"); file != "" {
+		if err := sched.AuditLog().OpenFile(file); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	eventsHandler := api.NewEventsHandler()
 	options := &cluster.Options{
 		TLSConfig:       tlsConfig,
 		OvercommitRatio: c.Float64("overcommit"),
-		Discovery:       dflag,
-		Heartbeat:       c.Int("heartbeat"),
+		Discovery:       d,
+		Heartbeat:       config.Heartbeat,
+
+		StatsInterval:     time.Duration(c.Int("stats-interval")) * time.Second,
+		StatsCadvisorPort: c.Int("stats-cadvisor-port"),
+
+		HealthInterval:   time.Duration(c.Int("health-interval")) * time.Second,
+		HealthFailures:   c.Int("health-failures"),
+		HealthSuccesses:  c.Int("health-successes"),
+		HealthMaxBackoff: time.Duration(c.Int("health-max-backoff")) * time.Second,
+
+		RefreshWorkers:    c.Int("refresh-workers"),
+		RefreshInterval:   time.Duration(c.Int("refresh-interval")) * time.Second,
+		RefreshMaxBackoff: time.Duration(c.Int("refresh-max-backoff")) * time.Second,
+
+		SchedulerWorkers: c.Int("scheduler-workers"),
+	}
+
+	var elector api.Elector
+	if c.Bool("replication") {
+		addr := c.String("advertise")
+		if !checkAddrFormat(addr) {
+			log.Fatal("--advertise should be of the form ip:port or hostname:port when using --replication")
+		}
+		leases, ok := discovery.Primary(d).(discovery.LeaseService)
+		if !ok {
+			log.Fatal("replication is not supported by this discovery service")
+		}
+		candidate := leadership.NewCandidate(leases, addr, time.Duration(c.Int("replication-ttl"))*time.Second)
+		go candidate.Run()
+		elector = candidate
+		options.IsLeader = candidate.IsLeader
 	}
 
 	cluster := swarm.NewCluster(sched, store, eventsHandler, options)
 
-	// see https://github.com/codegangsta/cli/issues/160
-	hosts := c.StringSlice("host")
-	if c.IsSet("host") || c.IsSet("H") {
-		hosts = hosts[1:]
+	hooks := []api.CreateHook{}
+	if c.Bool("deny-privileged") {
+		hooks = append(hooks, api.DenyPrivileged)
 	}
-	log.Fatal(api.ListenAndServe(cluster, hosts, c.Bool("cors"), tlsConfig, eventsHandler))
+	for _, url := range c.StringSlice("create-webhook") {
+		hooks = append(hooks, api.NewWebhook(url))
+	}
+
+	var access *api.AccessControl
+	if file := c.String("access-control"); file != "" {
+		if access, err = api.LoadAccessControl(file); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	log.Fatal(api.ListenAndServe(cluster, hosts, c.Bool("cors"), tlsConfig, eventsHandler, elector, authority, sched.AuditLog(), access, reloader, hooks))
 }
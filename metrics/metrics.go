@@ -0,0 +1,246 @@
+// Package metrics collects the metrics of the manager and serves them in the
+// Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Buckets of latencies, in seconds, used by default by the histograms.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// A Registry holds metrics, registered once each, and serves them.
+type Registry struct {
+	sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// The registry the metrics of the manager are registered in, and which the
+// package level functions use.
+var DefaultRegistry = NewRegistry()
+
+// A family holds the series of a metric, one per combination of label values.
+type family struct {
+	sync.Mutex
+
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+
+	// Histograms only.
+	counts []uint64
+	count  uint64
+}
+
+func (r *Registry) newFamily(name, help, kind string, buckets []float64, labels []string) *family {
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	if _, exists := r.families[name]; exists {
+		panic(fmt.Sprintf("metric %s registered twice", name))
+	}
+	r.families[name] = f
+	return f
+}
+
+// get returns the series of `labelValues`, to be called with the lock held.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects the labels %v, got %v", f.name, f.labels, labelValues))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, exists := f.series[key]
+	if !exists {
+		s = &series{labelValues: labelValues, counts: make([]uint64, len(f.buckets))}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) write(w io.Writer) {
+	f.Lock()
+	defer f.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labels, s.labelValues), formatValue(s.value))
+			continue
+		}
+
+		names := append(append([]string{}, f.labels...), "le")
+		for i, bound := range f.buckets {
+			values := append(append([]string{}, s.labelValues...), formatValue(bound))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(names, values), s.counts[i])
+		}
+		values := append(append([]string{}, s.labelValues...), "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(names, values), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, formatLabels(f.labels, s.labelValues), formatValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, formatLabels(f.labels, s.labelValues), s.count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// A Counter is a metric which only goes up.
+type Counter struct {
+	f *family
+}
+
+// NewCounter registers a counter broken down by `labels`.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.newFamily(name, help, "counter", nil, labels)}
+}
+
+// NewCounter registers a counter in the default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return DefaultRegistry.NewCounter(name, help, labels...)
+}
+
+// Inc adds one to the series of `labelValues`.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds `v`, which must not be negative, to the series of `labelValues`.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.f.Lock()
+	defer c.f.Unlock()
+	c.f.get(labelValues).value += v
+}
+
+// A Gauge is a metric which can go up and down.
+type Gauge struct {
+	f *family
+}
+
+// NewGauge registers a gauge broken down by `labels`.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.newFamily(name, help, "gauge", nil, labels)}
+}
+
+// NewGauge registers a gauge in the default registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return DefaultRegistry.NewGauge(name, help, labels...)
+}
+
+// Set sets the series of `labelValues` to `v`.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.Lock()
+	defer g.f.Unlock()
+	g.f.get(labelValues).value = v
+}
+
+// Delete removes the series of `labelValues`.
+func (g *Gauge) Delete(labelValues ...string) {
+	g.f.Lock()
+	defer g.f.Unlock()
+	delete(g.f.series, strings.Join(labelValues, "\xff"))
+}
+
+// A Histogram counts observations, such as latencies, in buckets.
+type Histogram struct {
+	f *family
+}
+
+// NewHistogram registers a histogram with the upper bounds `buckets`, in
+// increasing order, broken down by `labels`.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{r.newFamily(name, help, "histogram", buckets, labels)}
+}
+
+// NewHistogram registers a histogram in the default registry.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return DefaultRegistry.NewHistogram(name, help, buckets, labels...)
+}
+
+// Observe records `v` in the series of `labelValues`.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.Lock()
+	defer h.f.Unlock()
+
+	s := h.f.get(labelValues)
+	for i, bound := range h.f.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+// Handler serves all the metrics of the registry.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.Lock()
+		names := make([]string, 0, len(r.families))
+		for name := range r.families {
+			names = append(names, name)
+		}
+		r.Unlock()
+		sort.Strings(names)
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, name := range names {
+			r.Lock()
+			f := r.families[name]
+			r.Unlock()
+			f.write(w)
+		}
+	})
+}
+
+// Handler serves all the metrics of the default registry.
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serve(t *testing.T, registry *Registry) string {
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	assert.NoError(t, err)
+	registry.Handler().ServeHTTP(r, req)
+	assert.Equal(t, r.Code, http.StatusOK)
+	return r.Body.String()
+}
+
+func TestCounter(t *testing.T) {
+	registry := NewRegistry()
+	c := registry.NewCounter("test_counter_total", "A test counter.", "name")
+	c.Inc("a")
+	c.Add(2, "a")
+	c.Inc(`b"\`)
+
+	out := serve(t, registry)
+	assert.Contains(t, out, "# HELP test_counter_total A test counter.\n# TYPE test_counter_total counter\n")
+	assert.Contains(t, out, "test_counter_total{name=\"a\"} 3\n")
+	assert.Contains(t, out, "test_counter_total{name=\"b\\\"\\\\\"} 1\n")
+
+	assert.Panics(t, func() { registry.NewCounter("test_counter_total", "Registered twice.") })
+	assert.NotPanics(t, func() { NewRegistry().NewCounter("test_counter_total", "Another registry.") })
+	assert.Panics(t, func() { c.Inc() })
+}
+
+func TestGauge(t *testing.T) {
+	registry := NewRegistry()
+	g := registry.NewGauge("test_gauge", "A test gauge.", "name")
+	g.Set(1, "a")
+	g.Set(0.5, "b")
+	assert.Contains(t, serve(t, registry), "test_gauge{name=\"a\"} 1\ntest_gauge{name=\"b\"} 0.5\n")
+
+	g.Delete("a")
+	out := serve(t, registry)
+	assert.NotContains(t, out, "test_gauge{name=\"a\"}")
+	assert.Contains(t, out, "test_gauge{name=\"b\"} 0.5\n")
+}
+
+func TestHistogram(t *testing.T) {
+	registry := NewRegistry()
+	h := registry.NewHistogram("test_seconds", "A test histogram.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	assert.Contains(t, serve(t, registry), `# TYPE test_seconds histogram
+test_seconds_bucket{le="0.1"} 1
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 2.55
+test_seconds_count 3
+`)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+// managerURL turns the address of a manager, as given to -H, into the base
+// URL of its API.
+func managerURL(host string) string {
+	if strings.HasPrefix(host, "tcp://") {
+		return "http://" + strings.TrimPrefix(host, "tcp://")
+	}
+	if !strings.Contains(host, "://") {
+		return "http://" + host
+	}
+	return host
+}
+
+// managerClient returns the client to talk to the manager with, and the
+// scheme of its API, using the certificates given with --tlscert and
+// --tlskey if --tls or --tlsverify are set.
+func managerClient(c *cli.Context) (*http.Client, string) {
+	if !c.Bool("tls") && !c.Bool("tlsverify") {
+		if c.IsSet("tlscert") || c.IsSet("tlskey") || c.IsSet("tlscacert") {
+			log.Fatal("--tlscert, --tlskey and --tlscacert require the use of either --tls or --tlsverify")
+		}
+		return http.DefaultClient, "http"
+	}
+	if !c.IsSet("tlscert") || !c.IsSet("tlskey") {
+		log.Fatal("--tlscert and --tlskey must be provided when using --tls")
+	}
+	if c.Bool("tlsverify") && !c.IsSet("tlscacert") {
+		log.Fatal("--tlscacert must be provided when using --tlsverify")
+	}
+	tlsConfig, err := loadTlsConfig(
+		c.String("tlscacert"),
+		c.String("tlscert"),
+		c.String("tlskey"),
+		c.Bool("tlsverify"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}, "https"
+}
+
+func drain(c *cli.Context) {
+	nodeAction(c, "drain", url.Values{"containers": {c.String("containers")}})
+}
+
+func activate(c *cli.Context) {
+	nodeAction(c, "activate", url.Values{})
+}
+
+// Ask the manager to apply `action` to the node given as argument.
+func nodeAction(c *cli.Context, action string, params url.Values) {
+	if len(c.Args()) != 1 {
+		log.Fatalf("a node is required. See '%s %s --help'.", c.App.Name, action)
+	}
+
+	client, scheme := managerClient(c)
+	base := managerURL(c.String("host"))
+	if scheme == "https" {
+		base = "https://" + strings.TrimPrefix(base, "http://")
+	}
+	u := fmt.Sprintf("%s/nodes/%s/%s?%s", base, url.QueryEscape(c.Args()[0]), action, params.Encode())
+	req, err := http.NewRequest("PUT", u, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if token := c.String("auth-token"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Fatalf("%s failed: %s", action, strings.TrimSpace(string(body)))
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManagerURL(t *testing.T) {
+	assert.Equal(t, managerURL("tcp://1.1.1.1:2375"), "http://1.1.1.1:2375")
+	assert.Equal(t, managerURL("1.1.1.1:2375"), "http://1.1.1.1:2375")
+	assert.Equal(t, managerURL("https://1.1.1.1:2376"), "https://1.1.1.1:2376")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/swarm/discovery"
+	"github.com/docker/swarm/scheduler"
+	"github.com/docker/swarm/scheduler/filter"
+	"github.com/docker/swarm/scheduler/strategy"
+)
+
+// managerConfig is the part of the configuration of the manager read from the
+// --config file, which can be reloaded while running. Its fields default to
+// the values of the flags.
+type managerConfig struct {
+	Strategy     string
+	StrategyOpts []string
+	Filters      []string
+	Heartbeat    int
+}
+
+// The fields of managerConfig. The other options, such as the discovery
+// service, are only read from the flags: they can't be reloaded.
+var reloadable = []string{"Strategy", "StrategyOpts", "Filters", "Heartbeat"}
+
+// A reloader applies the --config file to the running manager.
+type reloader struct {
+	sync.Mutex
+
+	path      string
+	defaults  managerConfig
+	scheduler *scheduler.Scheduler
+	discovery discovery.DiscoveryService
+	// The heartbeat in effect.
+	heartbeat int
+}
+
+// load reads the config file, if any, over the defaults.
+func (r *reloader) load() (*managerConfig, error) {
+	config := r.defaults
+	// Unmarshalled into, the slices of the defaults would be overwritten.
+	config.StrategyOpts = append([]string(nil), config.StrategyOpts...)
+	config.Filters = append([]string(nil), config.Filters...)
+	if r.path == "" {
+		return &config, nil
+	}
+
+	data, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", r.path, err)
+	}
+	for field := range fields {
+		if !isReloadable(field) {
+			return nil, fmt.Errorf("%s can't be set in %s, only %s can: restart the manager to change it", field, r.path, strings.Join(reloadable, ", "))
+		}
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", r.path, err)
+	}
+	if config.Heartbeat <= 0 {
+		return nil, fmt.Errorf("invalid heartbeat %d in %s", config.Heartbeat, r.path)
+	}
+	return &config, nil
+}
+
+// isReloadable tells whether `field` is one of managerConfig, which the JSON
+// decoder matches case-insensitively.
+func isReloadable(field string) bool {
+	for _, name := range reloadable {
+		if strings.EqualFold(field, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// placement returns the strategy and the filters of `config`.
+func (config *managerConfig) placement() (strategy.PlacementStrategy, []filter.Filter, error) {
+	s, err := strategy.New(config.Strategy, config.StrategyOpts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("strategy %s: %v", config.Strategy, err)
+	}
+	fs, err := filter.New(config.Filters)
+	if err != nil {
+		return nil, nil, fmt.Errorf("filters %v: %v", config.Filters, err)
+	}
+	return s, fs, nil
+}
+
+// Reload applies the config file. Nothing is changed if it is invalid.
+func (r *reloader) Reload() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.path == "" {
+		return fmt.Errorf("no --config file to reload")
+	}
+	config, err := r.load()
+	if err != nil {
+		return err
+	}
+	s, fs, err := config.placement()
+	if err != nil {
+		return err
+	}
+	d, polling := r.discovery.(discovery.HeartbeatService)
+	if config.Heartbeat != r.heartbeat && !polling {
+		return fmt.Errorf("the heartbeat of the discovery service can't be changed without restarting the manager")
+	}
+
+	r.scheduler.Update(s, fs)
+	if polling {
+		d.SetHeartbeat(config.Heartbeat)
+	}
+	r.heartbeat = config.Heartbeat
+	log.WithFields(log.Fields{"strategy": config.Strategy, "filters": config.Filters, "heartbeat": config.Heartbeat}).Info("Configuration reloaded")
+	return nil
+}
+
+// reloadOnSignal reloads the config file on every SIGHUP.
+func (r *reloader) reloadOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for _ = range c {
+		if err := r.Reload(); err != nil {
+			log.Errorf("Failed to reload the configuration: %v", err)
+		}
+	}
+}
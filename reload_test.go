@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/swarm/discovery"
+	"github.com/docker/swarm/discovery/testutil"
+	"github.com/docker/swarm/scheduler"
+	"github.com/docker/swarm/scheduler/filter"
+	"github.com/docker/swarm/scheduler/strategy"
+	"github.com/samalba/dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+type pollingDiscovery struct {
+	*testutil.FakeDiscoveryService
+	discovery.Heartbeat
+}
+
+func TestReload(t *testing.T) {
+	file, err := ioutil.TempFile("", "swarm-config")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	binpacking, err := strategy.New("binpacking", nil)
+	assert.NoError(t, err)
+	sched := scheduler.New(binpacking, []filter.Filter{})
+	d := &pollingDiscovery{FakeDiscoveryService: testutil.NewFakeDiscoveryService()}
+	d.SetHeartbeat(25)
+	r := &reloader{
+		defaults:  managerConfig{Strategy: "binpacking", Filters: []string{"health"}, Heartbeat: 25},
+		scheduler: sched,
+		discovery: d,
+		heartbeat: 25,
+	}
+	strategyOf := func() string {
+		return sched.Explain(nil, &dockerclient.ContainerConfig{}, "", false).Strategy
+	}
+
+	assert.EqualError(t, r.Reload(), "no --config file to reload")
+
+	// Invalid configs are left out.
+	r.path = file.Name()
+	for _, config := range []string{`{`, `{"Strategy":"unknown"}`, `{"Filters":["unknown"]}`, `{"Strategy":"weighted","StrategyOpts":["cpu=high"]}`, `{"Heartbeat":-1}`, `{"Discovery":"consul://127.0.0.1/swarm"}`} {
+		assert.NoError(t, ioutil.WriteFile(file.Name(), []byte(config), 0600))
+		assert.Error(t, r.Reload(), config)
+	}
+	assert.Equal(t, strategyOf(), "binpacking")
+	assert.Equal(t, d.Heartbeat.Heartbeat(), 25*time.Second)
+
+	assert.NoError(t, ioutil.WriteFile(file.Name(), []byte(`{"Strategy":"weighted","StrategyOpts":["cpu=2"],"Heartbeat":10}`), 0600))
+	assert.NoError(t, r.Reload())
+	assert.Equal(t, strategyOf(), "weighted")
+	assert.Equal(t, d.Heartbeat.Heartbeat(), 10*time.Second)
+
+	// The fields missing from the file keep the values of the flags.
+	config, err := r.load()
+	assert.NoError(t, err)
+	assert.Equal(t, config.Filters, []string{"health"})
+
+	assert.NoError(t, ioutil.WriteFile(file.Name(), []byte(`{"discovery":"consul://127.0.0.1/swarm"}`), 0600))
+	assert.EqualError(t, r.Reload(), "discovery can't be set in "+file.Name()+", only Strategy, StrategyOpts, Filters, Heartbeat can: restart the manager to change it")
+
+	// The heartbeat of the services watching the changes can't be changed.
+	r.discovery = testutil.NewFakeDiscoveryService()
+	assert.NoError(t, ioutil.WriteFile(file.Name(), []byte(`{"Strategy":"binpacking","Heartbeat":5}`), 0600))
+	assert.Error(t, r.Reload())
+	assert.Equal(t, strategyOf(), "weighted")
+	assert.NoError(t, ioutil.WriteFile(file.Name(), []byte(`{"Strategy":"binpacking","Heartbeat":10}`), 0600))
+	assert.NoError(t, r.Reload())
+	assert.Equal(t, strategyOf(), "binpacking")
+}
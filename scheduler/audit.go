@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/docker/swarm/cluster"
+)
+
+// Number of decisions kept in memory.
+const auditSize = 200
+
+// An AuditLog keeps the latest decisions of the scheduler, and optionally
+// appends all of them as JSON lines to a file.
+type AuditLog struct {
+	sync.Mutex
+
+	decisions []*cluster.Decision
+	next      int
+	file      *os.File
+}
+
+func newAuditLog() *AuditLog {
+	return &AuditLog{decisions: make([]*cluster.Decision, 0, auditSize)}
+}
+
+// OpenFile appends the decisions to the file at `path`.
+func (a *AuditLog) OpenFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	a.file = file
+	return nil
+}
+
+func (a *AuditLog) record(d *cluster.Decision) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if len(a.decisions) < auditSize {
+		a.decisions = append(a.decisions, d)
+	} else {
+		a.decisions[a.next] = d
+	}
+	a.next = (a.next + 1) % auditSize
+
+	if a.file == nil {
+		return nil
+	}
+	return json.NewEncoder(a.file).Encode(d)
+}
+
+// Decisions returns the latest decisions first, at most `limit` of them if
+// positive, only those of the container `name` if not empty.
+func (a *AuditLog) Decisions(name string, limit int) []*cluster.Decision {
+	a.Lock()
+	defer a.Unlock()
+
+	decisions := []*cluster.Decision{}
+	for i := range a.decisions {
+		// Walk the ring backwards from the latest decision.
+		d := a.decisions[(a.next-1-i+2*len(a.decisions))%len(a.decisions)]
+		if name != "" && d.Name != name {
+			continue
+		}
+		if limit > 0 && len(decisions) == limit {
+			break
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions
+}
@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	a := newAuditLog()
+	for i := 0; i < auditSize+10; i++ {
+		assert.NoError(t, a.record(&cluster.Decision{Name: fmt.Sprintf("c%d", i%20)}))
+	}
+
+	// Only the latest decisions are kept, the latest first.
+	decisions := a.Decisions("", 0)
+	assert.Len(t, decisions, auditSize)
+	assert.Equal(t, decisions[0].Name, fmt.Sprintf("c%d", (auditSize+9)%20))
+
+	decisions = a.Decisions("c3", 2)
+	assert.Len(t, decisions, 2)
+	assert.Equal(t, decisions[0].Name, "c3")
+	assert.Equal(t, decisions[1].Name, "c3")
+
+	assert.Empty(t, a.Decisions("unknown", 0))
+}
+
+func TestAuditLogFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "swarm-audit")
+	assert.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	a := newAuditLog()
+	assert.NoError(t, a.OpenFile(file.Name()))
+	assert.NoError(t, a.record(&cluster.Decision{Name: "c1", Selected: []string{"node-1"}}))
+	assert.NoError(t, a.record(&cluster.Decision{Name: "c2", Error: "no resources available"}))
+
+	content, err := ioutil.ReadFile(file.Name())
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, 2)
+
+	decision := &cluster.Decision{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), decision))
+	assert.Equal(t, decision.Name, "c2")
+	assert.Equal(t, decision.Error, "no resources available")
+}
@@ -1,7 +1,6 @@
 package filter
 
 import (
-	"fmt"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
@@ -18,39 +17,43 @@ func (f *AffinityFilter) Filter(config *dockerclient.ContainerConfig, nodes []cl
 	if err != nil {
 		return nil, err
 	}
+	return filterExprs("affinity", affinities, false, nodes, matchAffinity)
+}
 
-	for _, affinity := range affinities {
-		log.Debugf("matching affinity: %s%s%s", affinity.key, OPERATORS[affinity.operator], affinity.value)
-
-		candidates := []cluster.Node{}
-		for _, node := range nodes {
-			switch affinity.key {
-			case "container":
-				containers := []string{}
-				for _, container := range node.Containers() {
-					containers = append(containers, container.Id, strings.TrimPrefix(container.Names[0], "/"))
-				}
-				if affinity.Match(containers...) {
-					candidates = append(candidates, node)
-				}
-			case "image":
-				images := []string{}
-				for _, image := range node.Images() {
-					images = append(images, image.Id)
-					images = append(images, image.RepoTags...)
-					for _, tag := range image.RepoTags {
-						images = append(images, strings.Split(tag, ":")[0])
-					}
-				}
-				if affinity.Match(images...) {
-					candidates = append(candidates, node)
-				}
-			}
+// filterSoft prefers the nodes satisfying the soft affinities.
+func (f *AffinityFilter) filterSoft(config *dockerclient.ContainerConfig, nodes []cluster.Node) []cluster.Node {
+	affinities, err := parseExprs("affinity", config.Env)
+	if err != nil {
+		return nodes
+	}
+	preferred, _ := filterExprs("affinity", affinities, true, nodes, matchAffinity)
+	return preferred
+}
+
+func matchAffinity(affinity expr, node cluster.Node) bool {
+	log.Debugf("matching affinity: %s%s%s", affinity.key, OPERATORS[affinity.operator], affinity.value)
+
+	switch affinity.key {
+	case "container":
+		containers := []string{}
+		for _, container := range node.Containers() {
+			containers = append(containers, container.Id, strings.TrimPrefix(container.Names[0], "/"))
 		}
-		if len(candidates) == 0 {
-			return nil, fmt.Errorf("unable to find a node that satisfies %s%s%s", affinity.key, OPERATORS[affinity.operator], affinity.value)
+		return affinity.Match(containers...)
+	case "image":
+		images := []string{}
+		for _, image := range node.Images() {
+			images = append(images, image.Id)
+			images = append(images, image.RepoTags...)
+			for _, tag := range image.RepoTags {
+				images = append(images, strings.Split(tag, ":")[0])
+			}
 		}
-		nodes = candidates
+		return affinity.Match(images...)
 	}
-	return nodes, nil
+	return false
+}
+
+func (f *AffinityFilter) Explain(config *dockerclient.ContainerConfig) string {
+	return "the node doesn't satisfy " + describeExprs("affinity", config.Env)
 }
@@ -206,4 +206,18 @@ func TestAffinityFilter(t *testing.T) {
 	}, nodes)
 	assert.Error(t, err)
 	assert.Len(t, result, 0)
+
+	// Soft affinities fall back to all the nodes.
+	result, err = ApplyFilters([]Filter{&f}, &dockerclient.ContainerConfig{
+		Env: []string{"affinity:container==~container-n0-0-name"},
+	}, nodes)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[0])
+
+	result, err = ApplyFilters([]Filter{&f}, &dockerclient.ContainerConfig{
+		Env: []string{"affinity:container==~does-not-exist"},
+	}, nodes)
+	assert.NoError(t, err)
+	assert.Len(t, result, 3)
 }
@@ -1,8 +1,6 @@
 package filter
 
 import (
-	"fmt"
-
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/swarm/cluster"
 	"github.com/samalba/dockerclient"
@@ -17,28 +15,31 @@ func (f *ConstraintFilter) Filter(config *dockerclient.ContainerConfig, nodes []
 	if err != nil {
 		return nil, err
 	}
+	return filterExprs("constraint", constraints, false, nodes, matchConstraint)
+}
 
-	for _, constraint := range constraints {
-		log.Debugf("matching constraint: %s %s %s", constraint.key, OPERATORS[constraint.operator], constraint.value)
+// filterSoft prefers the nodes satisfying the soft constraints.
+func (f *ConstraintFilter) filterSoft(config *dockerclient.ContainerConfig, nodes []cluster.Node) []cluster.Node {
+	constraints, err := parseExprs("constraint", config.Env)
+	if err != nil {
+		return nodes
+	}
+	preferred, _ := filterExprs("constraint", constraints, true, nodes, matchConstraint)
+	return preferred
+}
+
+func matchConstraint(constraint expr, node cluster.Node) bool {
+	log.Debugf("matching constraint: %s %s %s", constraint.key, OPERATORS[constraint.operator], constraint.value)
 
-		candidates := []cluster.Node{}
-		for _, node := range nodes {
-			switch constraint.key {
-			case "node":
-				// "node" label is a special case pinning a container to a specific node.
-				if constraint.Match(node.ID(), node.Name()) {
-					candidates = append(candidates, node)
-				}
-			default:
-				if constraint.Match(node.Labels()[constraint.key]) {
-					candidates = append(candidates, node)
-				}
-			}
-		}
-		if len(candidates) == 0 {
-			return nil, fmt.Errorf("unable to find a node that satisfies %s%s%s", constraint.key, OPERATORS[constraint.operator], constraint.value)
-		}
-		nodes = candidates
+	switch constraint.key {
+	case "node":
+		// "node" label is a special case pinning a container to a specific node.
+		return constraint.Match(node.ID(), node.Name())
+	default:
+		return constraint.Match(node.Labels()[constraint.key])
 	}
-	return nodes, nil
+}
+
+func (f *ConstraintFilter) Explain(config *dockerclient.ContainerConfig) string {
+	return "the node doesn't satisfy " + describeExprs("constraint", config.Env)
 }
@@ -246,3 +246,63 @@ func TestUnsupportedOperators(t *testing.T) {
 	assert.Error(t, err)
 	assert.Len(t, result, 0)
 }
+
+func TestSoftConstraints(t *testing.T) {
+	var (
+		f       = ConstraintFilter{}
+		filters = []Filter{&f}
+		nodes   = testFixtures()
+		result  []cluster.Node
+		err     error
+	)
+
+	// Matching nodes are preferred.
+	result, err = ApplyFilters(filters, &dockerclient.ContainerConfig{Env: []string{"constraint:region==~us-east"}}, nodes)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[1])
+
+	// Without any matching node, all the nodes are kept.
+	result, err = ApplyFilters(filters, &dockerclient.ContainerConfig{Env: []string{"constraint:region==~ap-south"}}, nodes)
+	assert.NoError(t, err)
+	assert.Len(t, result, 4)
+
+	// Hard constraints still apply.
+	result, err = ApplyFilters(filters, &dockerclient.ContainerConfig{Env: []string{"constraint:region==~ap-south", "constraint:group==1"}}, nodes)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+
+	// And first: the soft ones only pick among the nodes they accept.
+	result, err = ApplyFilters(filters, &dockerclient.ContainerConfig{Env: []string{"constraint:region==~eu", "constraint:group==1"}}, nodes)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+
+	// Filter alone only applies the hard ones.
+	result, err = f.Filter(&dockerclient.ContainerConfig{Env: []string{"constraint:region==~us-east"}}, nodes)
+	assert.NoError(t, err)
+	assert.Len(t, result, 4)
+
+	result, err = ApplyFilters(filters, &dockerclient.ContainerConfig{Env: []string{"constraint:region!=~us-*"}}, nodes)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+
+	_, err = f.Filter(&dockerclient.ContainerConfig{Env: []string{"constraint:region==ap-south"}}, nodes)
+	assert.Error(t, err)
+}
+
+func TestSoftConstraintsAfterHardFilters(t *testing.T) {
+	nodes := testFixtures()
+	// Only node-1 is in us-east, and it has the volume the container needs
+	// elsewhere than on it.
+	nodes[0].(*FakeNode).volumes = []*cluster.Volume{{Name: "data"}}
+	config := &dockerclient.ContainerConfig{
+		Env:        []string{"constraint:region==~us-east"},
+		HostConfig: dockerclient.HostConfig{Binds: []string{"data:/data"}},
+	}
+
+	result, rejected, err := ExplainFilters([]Filter{&ConstraintFilter{}, &VolumeFilter{}}, config, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, result, nodes[:1])
+	assert.Len(t, rejected, 1)
+	assert.Equal(t, rejected[0].Filter, "volume")
+}
@@ -45,6 +45,10 @@ func (f *DependencyFilter) Filter(config *dockerclient.ContainerConfig, nodes []
 	return candidates, nil
 }
 
+func (f *DependencyFilter) Explain(config *dockerclient.ContainerConfig) string {
+	return "the node doesn't run all the dependencies: " + f.String(config)
+}
+
 // Get a string representation of the dependencies found in the container config.
 func (f *DependencyFilter) String(config *dockerclient.ContainerConfig) string {
 	dependencies := []string{}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/docker/swarm/cluster"
 )
 
 const (
@@ -19,6 +20,37 @@ type expr struct {
 	key      string
 	operator int
 	value    string
+	// Soft expressions (==~ and !=~) are best-effort: they only pick among
+	// the nodes all the filters accepted, and are ignored when none of them
+	// satisfies them.
+	isSoft bool
+}
+
+// filterExprs keeps the `nodes` matching the hard `key` expressions of
+// `exprs`, or the soft ones if `soft`. The soft expressions no node matches
+// are ignored.
+func filterExprs(key string, exprs []expr, soft bool, nodes []cluster.Node, match func(expr, cluster.Node) bool) ([]cluster.Node, error) {
+	for _, e := range exprs {
+		if e.isSoft != soft {
+			continue
+		}
+		candidates := []cluster.Node{}
+		for _, node := range nodes {
+			if match(e, node) {
+				candidates = append(candidates, node)
+			}
+		}
+		if len(candidates) == 0 {
+			if e.isSoft {
+				// Best-effort, keep all the nodes.
+				log.Debugf("no node satisfies the soft %s %s, ignoring it", key, e.String())
+				continue
+			}
+			return nil, fmt.Errorf("unable to find a node that satisfies %s", e.String())
+		}
+		nodes = candidates
+	}
+	return nodes, nil
 }
 
 func parseExprs(key string, env []string) ([]expr, error) {
@@ -43,6 +75,8 @@ func parseExprs(key string, env []string) ([]expr, error) {
 					}
 
 					if len(parts) == 2 {
+						isSoft := strings.HasPrefix(parts[1], "~")
+						parts[1] = strings.TrimPrefix(parts[1], "~")
 
 						// validate value
 						// allow leading = in case of using ==
@@ -55,7 +89,7 @@ func parseExprs(key string, env []string) ([]expr, error) {
 						if matched == false {
 							return nil, fmt.Errorf("Value '%s' is invalid", parts[1])
 						}
-						exprs = append(exprs, expr{key: strings.ToLower(parts[0]), operator: i, value: parts[1]})
+						exprs = append(exprs, expr{key: strings.ToLower(parts[0]), operator: i, value: parts[1], isSoft: isSoft})
 					} else {
 						exprs = append(exprs, expr{key: strings.ToLower(parts[0]), operator: i})
 					}
@@ -72,6 +106,27 @@ func parseExprs(key string, env []string) ([]expr, error) {
 	return exprs, nil
 }
 
+// describeExprs lists the `key` expressions of `env`.
+func describeExprs(key string, env []string) string {
+	exprs, err := parseExprs(key, env)
+	if err != nil {
+		return err.Error()
+	}
+	descriptions := make([]string, len(exprs))
+	for i, e := range exprs {
+		descriptions[i] = key + ":" + e.String()
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+func (e *expr) String() string {
+	soft := ""
+	if e.isSoft {
+		soft = "~"
+	}
+	return e.key + OPERATORS[e.operator] + soft + e.value
+}
+
 func (e *expr) Match(whats ...string) bool {
 	var (
 		pattern string
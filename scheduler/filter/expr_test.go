@@ -34,6 +34,13 @@ func TestParseExprs(t *testing.T) {
 	// Allow regexp in value
 	_, err = parseExprs("constraint", []string{"constraint:node==/(?i)^[a-b]+c*$/"})
 	assert.NoError(t, err)
+
+	// Allow soft expressions
+	exprs, err := parseExprs("constraint", []string{"constraint:node==~node1", "constraint:region!=~us-*"})
+	assert.NoError(t, err)
+	assert.Equal(t, exprs[0], expr{key: "node", operator: EQ, value: "node1", isSoft: true})
+	assert.Equal(t, exprs[1], expr{key: "region", operator: NOTEQ, value: "us-*", isSoft: true})
+	assert.Equal(t, exprs[1].String(), "region!=~us-*")
 }
 
 func TestMatch(t *testing.T) {
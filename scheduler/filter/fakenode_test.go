@@ -8,6 +8,9 @@ type FakeNode struct {
 	addr       string
 	containers []*cluster.Container
 	images     []*cluster.Image
+	volumes    []*cluster.Volume
+	drivers    []string
+	networks   []*cluster.Network
 	labels     map[string]string
 }
 
@@ -15,6 +18,7 @@ func (fn *FakeNode) ID() string               { return fn.id }
 func (fn *FakeNode) Name() string             { return fn.name }
 func (fn *FakeNode) IP() string               { return "" }
 func (fn *FakeNode) Addr() string             { return fn.addr }
+func (fn *FakeNode) Version() string          { return "1.6.0" }
 func (fn *FakeNode) Images() []*cluster.Image { return fn.images }
 func (fn *FakeNode) Image(id string) *cluster.Image {
 	for _, image := range fn.images {
@@ -33,12 +37,18 @@ func (fn *FakeNode) Container(id string) *cluster.Container {
 	}
 	return nil
 }
-func (fn *FakeNode) TotalCpus() int64          { return 0 }
-func (fn *FakeNode) UsedCpus() int64           { return 0 }
-func (fn *FakeNode) TotalMemory() int64        { return 0 }
-func (fn *FakeNode) UsedMemory() int64         { return 0 }
-func (fn *FakeNode) Labels() map[string]string { return fn.labels }
-func (fn *FakeNode) IsHealthy() bool           { return true }
+func (fn *FakeNode) TotalCpus() int64             { return 0 }
+func (fn *FakeNode) UsedCpus() int64              { return 0 }
+func (fn *FakeNode) TotalMemory() int64           { return 0 }
+func (fn *FakeNode) UsedMemory() int64            { return 0 }
+func (fn *FakeNode) Labels() map[string]string    { return fn.labels }
+func (fn *FakeNode) IsHealthy() bool              { return true }
+func (fn *FakeNode) IsDrained() bool              { return false }
+func (fn *FakeNode) Volumes() []*cluster.Volume   { return fn.volumes }
+func (fn *FakeNode) VolumeDrivers() []string      { return fn.drivers }
+func (fn *FakeNode) Networks() []*cluster.Network { return fn.networks }
+func (fn *FakeNode) CpuUsage() float64            { return 0 }
+func (fn *FakeNode) MemoryUsage() float64         { return 0 }
 
 func (fn *FakeNode) AddContainer(container *cluster.Container) error {
 	fn.containers = append(fn.containers, container)
@@ -5,17 +5,35 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/swarm/cluster"
+	"github.com/docker/swarm/metrics"
 	"github.com/samalba/dockerclient"
 )
 
 type Filter interface {
 	// Return a subset of nodes that were accepted by the filtering policy.
 	Filter(*dockerclient.ContainerConfig, []cluster.Node) ([]cluster.Node, error)
+	// Explain why a node was rejected for a container.
+	Explain(*dockerclient.ContainerConfig) string
+}
+
+// A clusterFilter also needs the nodes the previous filters ruled out.
+type clusterFilter interface {
+	// filterCluster is Filter, `all` being all the nodes the filters were
+	// applied to.
+	filterCluster(config *dockerclient.ContainerConfig, nodes, all []cluster.Node) ([]cluster.Node, error)
+}
+
+// A softFilter also prefers some of the nodes all the filters accepted.
+type softFilter interface {
+	// filterSoft returns the preferred `nodes`, all of them if none is.
+	filterSoft(config *dockerclient.ContainerConfig, nodes []cluster.Node) []cluster.Node
 }
 
 var (
 	filters         map[string]Filter
 	ErrNotSupported = errors.New("filter not supported")
+
+	rejections = metrics.NewCounter("swarm_scheduler_filter_rejections_total", "Nodes rejected by each filter while scheduling containers.", "filter")
 )
 
 func init() {
@@ -25,6 +43,8 @@ func init() {
 		"constraint": &ConstraintFilter{},
 		"port":       &PortFilter{},
 		"dependency": &DependencyFilter{},
+		"volume":     &VolumeFilter{},
+		"network":    &NetworkFilter{},
 	}
 }
 
@@ -42,15 +62,94 @@ func New(names []string) ([]Filter, error) {
 	return selectedFilters, nil
 }
 
+// Name returns the name `filter` is registered under.
+func Name(filter Filter) string {
+	for name, f := range filters {
+		if f == filter {
+			return name
+		}
+	}
+	return "unknown"
+}
+
 // Apply a set of filters in batch.
 func ApplyFilters(filters []Filter, config *dockerclient.ContainerConfig, nodes []cluster.Node) ([]cluster.Node, error) {
-	var err error
+	accepted, _, err := ExplainFilters(filters, config, nodes)
+	return accepted, err
+}
 
+// ExplainFilters applies a set of filters in batch, and also returns the nodes
+// each filter rejected.
+func ExplainFilters(filters []Filter, config *dockerclient.ContainerConfig, nodes []cluster.Node) ([]cluster.Node, []cluster.Rejection, error) {
+	rejected := []cluster.Rejection{}
+	all := nodes
 	for _, filter := range filters {
-		nodes, err = filter.Filter(config, nodes)
+		var (
+			accepted []cluster.Node
+			err      error
+		)
+		if f, ok := filter.(clusterFilter); ok {
+			accepted, err = f.filterCluster(config, nodes, all)
+		} else {
+			accepted, err = filter.Filter(config, nodes)
+		}
+		rejections.Add(float64(len(nodes)-len(accepted)), Name(filter))
+
 		if err != nil {
-			return nil, err
+			rejected = append(rejected, cluster.Rejection{Filter: Name(filter), Nodes: NodeNames(nodes), Reason: err.Error()})
+			return nil, rejected, err
+		}
+		if len(accepted) < len(nodes) {
+			rejected = append(rejected, cluster.Rejection{
+				Filter: Name(filter),
+				Nodes:  NodeNames(difference(nodes, accepted)),
+				Reason: filter.Explain(config),
+			})
 		}
+		nodes = accepted
+	}
+
+	// The soft constraints and affinities only pick among the nodes the hard
+	// filters accepted, so that they can't rule them all out.
+	for _, filter := range filters {
+		f, ok := filter.(softFilter)
+		if !ok {
+			continue
+		}
+		preferred := f.filterSoft(config, nodes)
+		rejections.Add(float64(len(nodes)-len(preferred)), Name(filter))
+		if len(preferred) < len(nodes) {
+			rejected = append(rejected, cluster.Rejection{
+				Filter: Name(filter),
+				Nodes:  NodeNames(difference(nodes, preferred)),
+				Reason: filter.Explain(config),
+			})
+		}
+		nodes = preferred
+	}
+	return nodes, rejected, nil
+}
+
+// difference returns the nodes of `all` missing from `some`.
+func difference(all, some []cluster.Node) []cluster.Node {
+	kept := make(map[string]bool, len(some))
+	for _, node := range some {
+		kept[node.ID()] = true
+	}
+	missing := []cluster.Node{}
+	for _, node := range all {
+		if !kept[node.ID()] {
+			missing = append(missing, node)
+		}
+	}
+	return missing
+}
+
+// NodeNames returns the names of `nodes`.
+func NodeNames(nodes []cluster.Node) []string {
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = node.Name()
 	}
-	return nodes, nil
+	return names
 }
@@ -0,0 +1,39 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/samalba/dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainFilters(t *testing.T) {
+	var (
+		filters = []Filter{&ConstraintFilter{}, &PortFilter{}}
+		nodes   = []cluster.Node{
+			&FakeNode{id: "node-0-id", name: "node-0", labels: map[string]string{"storage": "ssd"}},
+			&FakeNode{id: "node-1-id", name: "node-1", labels: map[string]string{"storage": "disk"}},
+		}
+		config = &dockerclient.ContainerConfig{Env: []string{"constraint:storage==ssd"}}
+	)
+
+	accepted, rejected, err := ExplainFilters(filters, config, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, accepted, nodes[:1])
+	assert.Equal(t, rejected, []cluster.Rejection{{
+		Filter: "constraint",
+		Nodes:  []string{"node-1"},
+		Reason: "the node doesn't satisfy constraint:storage==ssd",
+	}})
+
+	// The failing filter rejects all the nodes left.
+	config.Env = []string{"constraint:storage==tape"}
+	_, rejected, err = ExplainFilters(filters, config, nodes)
+	assert.Error(t, err)
+	assert.Equal(t, rejected, []cluster.Rejection{{
+		Filter: "constraint",
+		Nodes:  []string{"node-0", "node-1"},
+		Reason: err.Error(),
+	}})
+}
@@ -29,3 +29,7 @@ func (f *HealthFilter) Filter(_ *dockerclient.ContainerConfig, nodes []cluster.N
 
 	return result, nil
 }
+
+func (f *HealthFilter) Explain(_ *dockerclient.ContainerConfig) string {
+	return "the node is unhealthy"
+}
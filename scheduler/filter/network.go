@@ -0,0 +1,59 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/samalba/dockerclient"
+)
+
+// NetworkFilter schedules the containers joining a network on the nodes where
+// the network exists.
+type NetworkFilter struct {
+}
+
+func (f *NetworkFilter) Filter(config *dockerclient.ContainerConfig, nodes []cluster.Node) ([]cluster.Node, error) {
+	network := requestedNetwork(config)
+	if network == "" {
+		return nodes, nil
+	}
+
+	candidates := []cluster.Node{}
+	for _, node := range nodes {
+		if hasNetwork(node, network) {
+			candidates = append(candidates, node)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("unable to find a node with the network %s", network)
+	}
+	return candidates, nil
+}
+
+func (f *NetworkFilter) Explain(config *dockerclient.ContainerConfig) string {
+	return "the node doesn't have the network " + requestedNetwork(config)
+}
+
+// requestedNetwork returns the network a container joins, empty for the
+// networks every node has.
+func requestedNetwork(config *dockerclient.ContainerConfig) string {
+	switch mode := config.HostConfig.NetworkMode; {
+	case mode == "", mode == "default", mode == "bridge", mode == "host", mode == "none":
+		return ""
+	case strings.HasPrefix(mode, "container:"):
+		// The dependency filter takes care of it.
+		return ""
+	default:
+		return mode
+	}
+}
+
+func hasNetwork(node cluster.Node, IdOrName string) bool {
+	for _, network := range node.Networks() {
+		if network.ID == IdOrName || network.Name == IdOrName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/samalba/dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetworkFilter(t *testing.T) {
+	var (
+		f     = NetworkFilter{}
+		nodes = []cluster.Node{
+			&FakeNode{id: "node-0-id", name: "node-0"},
+			&FakeNode{id: "node-1-id", name: "node-1"},
+		}
+	)
+	nodes[1].(*FakeNode).networks = []*cluster.Network{{ID: "3ac1e4", Name: "backend", Driver: "overlay", Scope: "global"}}
+
+	// The default networks are everywhere.
+	for _, mode := range []string{"", "bridge", "host", "none", "container:db"} {
+		config := &dockerclient.ContainerConfig{HostConfig: dockerclient.HostConfig{NetworkMode: mode}}
+		result, err := f.Filter(config, nodes)
+		assert.NoError(t, err)
+		assert.Equal(t, result, nodes, mode)
+	}
+
+	for _, mode := range []string{"backend", "3ac1e4"} {
+		config := &dockerclient.ContainerConfig{HostConfig: dockerclient.HostConfig{NetworkMode: mode}}
+		result, err := f.Filter(config, nodes)
+		assert.NoError(t, err)
+		assert.Equal(t, result, nodes[1:], mode)
+	}
+
+	config := &dockerclient.ContainerConfig{HostConfig: dockerclient.HostConfig{NetworkMode: "frontend"}}
+	_, err := f.Filter(config, nodes)
+	assert.EqualError(t, err, "unable to find a node with the network frontend")
+}
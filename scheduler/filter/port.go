@@ -2,6 +2,9 @@ package filter
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/docker/swarm/cluster"
 	"github.com/samalba/dockerclient"
@@ -9,12 +12,13 @@ import (
 
 // PortFilter guarantees that, when scheduling a container binding a public
 // port, only nodes that have not already allocated that same port will be
-// considered.
+// considered. Host ports may be ranges (e.g. 8000-8100), and containers using
+// the host network are accounted for with the ports they expose.
 type PortFilter struct {
 }
 
 func (p *PortFilter) Filter(config *dockerclient.ContainerConfig, nodes []cluster.Node) ([]cluster.Node, error) {
-	for _, port := range config.HostConfig.PortBindings {
+	for _, port := range requestedBindings(config) {
 		for _, binding := range port {
 			candidates := []cluster.Node{}
 			for _, node := range nodes {
@@ -31,6 +35,24 @@ func (p *PortFilter) Filter(config *dockerclient.ContainerConfig, nodes []cluste
 	return nodes, nil
 }
 
+func (p *PortFilter) Explain(config *dockerclient.ContainerConfig) string {
+	return "the host ports are already in use: " + strings.Join(HostPorts(config), ", ")
+}
+
+// HostPorts returns the host ports, or ranges of ports, `config` binds, sorted.
+func HostPorts(config *dockerclient.ContainerConfig) []string {
+	ports := []string{}
+	for _, port := range requestedBindings(config) {
+		for _, binding := range port {
+			if binding.HostPort != "" {
+				ports = append(ports, binding.HostPort)
+			}
+		}
+	}
+	sort.Strings(ports)
+	return ports
+}
+
 func (p *PortFilter) portAlreadyInUse(node cluster.Node, requested dockerclient.PortBinding) bool {
 	for _, c := range node.Containers() {
 		// HostConfig.PortBindings contains the requested ports.
@@ -48,10 +70,34 @@ func (p *PortFilter) portAlreadyInUse(node cluster.Node, requested dockerclient.
 		if p.compare(requested, c.Info.HostConfig.PortBindings) || p.compare(requested, c.Info.NetworkSettings.Ports) {
 			return true
 		}
+
+		// Containers on the host network listen directly on the ports they
+		// expose.
+		if c.Info.HostConfig.NetworkMode == "host" && c.Info.Config != nil && p.compare(requested, hostBindings(c.Info.Config.ExposedPorts)) {
+			return true
+		}
 	}
 	return false
 }
 
+// requestedBindings returns the host ports `config` needs.
+func requestedBindings(config *dockerclient.ContainerConfig) map[string][]dockerclient.PortBinding {
+	if config.HostConfig.NetworkMode == "host" {
+		return hostBindings(config.ExposedPorts)
+	}
+	return config.HostConfig.PortBindings
+}
+
+// hostBindings returns the bindings of a container on the host network,
+// listening on every interface of the host.
+func hostBindings(exposedPorts map[string]struct{}) map[string][]dockerclient.PortBinding {
+	bindings := make(map[string][]dockerclient.PortBinding)
+	for port := range exposedPorts {
+		bindings[port] = []dockerclient.PortBinding{{HostPort: strings.SplitN(port, "/", 2)[0]}}
+	}
+	return bindings
+}
+
 func (p *PortFilter) compare(requested dockerclient.PortBinding, bindings map[string][]dockerclient.PortBinding) bool {
 	for _, binding := range bindings {
 		for _, b := range binding {
@@ -61,7 +107,7 @@ func (p *PortFilter) compare(requested dockerclient.PortBinding, bindings map[st
 				continue
 			}
 
-			if b.HostPort == requested.HostPort {
+			if PortsOverlap(b.HostPort, requested.HostPort) {
 				// Another container on the same host is binding on the same
 				// port/protocol.  Verify if they are requesting the same
 				// binding IP, or if the other container is already binding on
@@ -78,3 +124,33 @@ func (p *PortFilter) compare(requested dockerclient.PortBinding, bindings map[st
 func bindsAllInterfaces(binding dockerclient.PortBinding) bool {
 	return binding.HostIp == "0.0.0.0" || binding.HostIp == ""
 }
+
+// PortsOverlap returns true if the host ports `a` and `b`, each a single port
+// or a range like 8000-8100, have a port in common.
+func PortsOverlap(a, b string) bool {
+	aStart, aEnd, errA := parsePortRange(a)
+	bStart, bEnd, errB := parsePortRange(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return aStart <= bEnd && bStart <= aEnd
+}
+
+func parsePortRange(ports string) (int, int, error) {
+	parts := strings.SplitN(ports, "-", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(parts) == 1 {
+		return start, start, nil
+	}
+	end, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("invalid port range %s", ports)
+	}
+	return start, end, nil
+}
@@ -283,3 +283,110 @@ func TestPortFilterRandomAssignment(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotContains(t, result, nodes[0])
 }
+
+func TestPortFilterRanges(t *testing.T) {
+	var (
+		p     = PortFilter{}
+		nodes = []cluster.Node{
+			&FakeNode{
+				id:   "node-0-id",
+				name: "node-0-name",
+				addr: "node-0",
+			},
+			&FakeNode{
+				id:   "node-1-id",
+				name: "node-1-name",
+				addr: "node-1",
+			},
+		}
+		result []cluster.Node
+		err    error
+	)
+
+	// Add a container publishing the 8000-8100 range to nodes[0].
+	container := &cluster.Container{Container: dockerclient.Container{Id: "c1"}, Info: dockerclient.ContainerInfo{HostConfig: &dockerclient.HostConfig{PortBindings: makeBinding("", "8000-8100")}}}
+	if n, ok := nodes[0].(*FakeNode); ok {
+		assert.NoError(t, n.AddContainer(container))
+	}
+
+	// A port within the range is taken.
+	config := &dockerclient.ContainerConfig{HostConfig: dockerclient.HostConfig{
+		PortBindings: makeBinding("", "8042"),
+	}}
+	result, err = p.Filter(config, nodes)
+	assert.NoError(t, err)
+	assert.NotContains(t, result, nodes[0])
+
+	// So is an overlapping range.
+	config = &dockerclient.ContainerConfig{HostConfig: dockerclient.HostConfig{
+		PortBindings: makeBinding("", "8100-8200"),
+	}}
+	result, err = p.Filter(config, nodes)
+	assert.NoError(t, err)
+	assert.NotContains(t, result, nodes[0])
+
+	// But not a disjoint one.
+	config = &dockerclient.ContainerConfig{HostConfig: dockerclient.HostConfig{
+		PortBindings: makeBinding("", "8101-8200"),
+	}}
+	result, err = p.Filter(config, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, result, nodes)
+}
+
+func TestPortFilterHostNetwork(t *testing.T) {
+	var (
+		p     = PortFilter{}
+		nodes = []cluster.Node{
+			&FakeNode{
+				id:   "node-0-id",
+				name: "node-0-name",
+				addr: "node-0",
+			},
+			&FakeNode{
+				id:   "node-1-id",
+				name: "node-1-name",
+				addr: "node-1",
+			},
+		}
+		result []cluster.Node
+		err    error
+	)
+
+	// Add a container on the host network exposing port 80 to nodes[0].
+	container := &cluster.Container{Container: dockerclient.Container{Id: "c1"}, Info: dockerclient.ContainerInfo{
+		Config:     &dockerclient.ContainerConfig{ExposedPorts: map[string]struct{}{"80/tcp": {}}},
+		HostConfig: &dockerclient.HostConfig{NetworkMode: "host"},
+	}}
+	if n, ok := nodes[0].(*FakeNode); ok {
+		assert.NoError(t, n.AddContainer(container))
+	}
+
+	// Publishing port 80 conflicts with it, on any interface.
+	config := &dockerclient.ContainerConfig{HostConfig: dockerclient.HostConfig{
+		PortBindings: makeBinding("127.0.0.1", "80"),
+	}}
+	result, err = p.Filter(config, nodes)
+	assert.NoError(t, err)
+	assert.NotContains(t, result, nodes[0])
+
+	// Add a container publishing port 443 to nodes[1].
+	container = &cluster.Container{Container: dockerclient.Container{Id: "c2"}, Info: dockerclient.ContainerInfo{HostConfig: &dockerclient.HostConfig{PortBindings: makeBinding("", "443")}}}
+	if n, ok := nodes[1].(*FakeNode); ok {
+		assert.NoError(t, n.AddContainer(container))
+	}
+
+	// A container on the host network exposing port 443 can only go to nodes[0].
+	config = &dockerclient.ContainerConfig{
+		ExposedPorts: map[string]struct{}{"443/tcp": {}},
+		HostConfig:   dockerclient.HostConfig{NetworkMode: "host"},
+	}
+	result, err = p.Filter(config, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, result, []cluster.Node{nodes[0]})
+
+	// And neither node is available if it also exposes port 80.
+	config.ExposedPorts["80/tcp"] = struct{}{}
+	result, err = p.Filter(config, nodes)
+	assert.Error(t, err)
+}
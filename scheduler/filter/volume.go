@@ -0,0 +1,101 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/samalba/dockerclient"
+)
+
+// VolumeFilter schedules the containers mounting a named volume on the nodes
+// where the volume exists or, if no node has it yet, on the nodes having its
+// driver.
+type VolumeFilter struct {
+}
+
+func (f *VolumeFilter) Filter(config *dockerclient.ContainerConfig, nodes []cluster.Node) ([]cluster.Node, error) {
+	return f.filterCluster(config, nodes, nodes)
+}
+
+func (f *VolumeFilter) filterCluster(config *dockerclient.ContainerConfig, nodes, all []cluster.Node) ([]cluster.Node, error) {
+	for _, name := range namedVolumes(config) {
+		candidates := withVolume(nodes, name)
+		if len(candidates) > 0 {
+			nodes = candidates
+			continue
+		}
+
+		// Rather than hand the container a new, empty, volume of the same
+		// name.
+		if len(withVolume(all, name)) > 0 {
+			return nil, fmt.Errorf("the volume %s only exists on nodes ruled out for the container", name)
+		}
+		// A new volume is created on the node, with the driver of the
+		// container.
+		driver := cluster.VolumeDriver(config)
+		candidates = withVolumeDriver(nodes, driver)
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("unable to find a node with the volume driver %s", driver)
+		}
+		nodes = candidates
+	}
+	return nodes, nil
+}
+
+func (f *VolumeFilter) Explain(config *dockerclient.ContainerConfig) string {
+	explanation := "the node doesn't have the volumes " + strings.Join(namedVolumes(config), ", ")
+	if driver := cluster.VolumeDriver(config); driver != "" && driver != "local" {
+		explanation += " or the volume driver " + driver
+	}
+	return explanation
+}
+
+// namedVolumes returns the named volumes mounted by a container, as opposed to
+// the host directories.
+func namedVolumes(config *dockerclient.ContainerConfig) []string {
+	names := []string{}
+	for _, bind := range config.HostConfig.Binds {
+		source := strings.SplitN(bind, ":", 2)[0]
+		if source != "" && !strings.HasPrefix(source, "/") {
+			names = append(names, source)
+		}
+	}
+	return names
+}
+
+func withVolume(nodes []cluster.Node, name string) []cluster.Node {
+	candidates := []cluster.Node{}
+	for _, node := range nodes {
+		for _, volume := range node.Volumes() {
+			if volume.Name == name {
+				candidates = append(candidates, node)
+				break
+			}
+		}
+	}
+	return candidates
+}
+
+// withVolumeDriver returns the nodes having the volume `driver`, or which
+// don't report their drivers. All of them have the local one.
+func withVolumeDriver(nodes []cluster.Node, driver string) []cluster.Node {
+	if driver == "" || driver == "local" {
+		return nodes
+	}
+	candidates := []cluster.Node{}
+	for _, node := range nodes {
+		drivers := node.VolumeDrivers()
+		if drivers == nil {
+			candidates = append(candidates, node)
+			continue
+		}
+		for _, d := range drivers {
+			if d == driver {
+				candidates = append(candidates, node)
+				break
+			}
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,67 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/samalba/dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeFilter(t *testing.T) {
+	var (
+		f     = VolumeFilter{}
+		nodes = []cluster.Node{
+			&FakeNode{id: "node-0-id", name: "node-0"},
+			&FakeNode{id: "node-1-id", name: "node-1"},
+		}
+	)
+	nodes[1].(*FakeNode).volumes = []*cluster.Volume{{Name: "data", Driver: "local"}}
+
+	// Host directories go anywhere.
+	config := &dockerclient.ContainerConfig{HostConfig: dockerclient.HostConfig{Binds: []string{"/var/lib/data:/data"}}}
+	result, err := f.Filter(config, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, result, nodes)
+
+	// Named volumes go where they are.
+	config.HostConfig.Binds = []string{"data:/data:ro"}
+	result, err = f.Filter(config, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, result, nodes[1:])
+	assert.Equal(t, f.Explain(config), "the node doesn't have the volumes data")
+
+	// New volumes can be created anywhere.
+	config.HostConfig.Binds = []string{"new:/data"}
+	result, err = f.Filter(config, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, result, nodes)
+
+	// But only where their driver is, or may be.
+	nodes = append(nodes, &FakeNode{id: "node-2-id", name: "node-2", drivers: []string{"local", "flocker"}})
+	nodes[0].(*FakeNode).drivers = []string{"local"}
+	cluster.SetVolumeDriver(config, "flocker")
+	result, err = f.Filter(config, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, result, nodes[1:])
+	assert.Equal(t, f.Explain(config), "the node doesn't have the volumes new or the volume driver flocker")
+	cluster.SetVolumeDriver(config, "convoy")
+	_, err = f.Filter(config, nodes[:1])
+	assert.EqualError(t, err, "unable to find a node with the volume driver convoy")
+}
+
+func TestVolumeFilterRuledOut(t *testing.T) {
+	nodes := []cluster.Node{
+		&FakeNode{id: "node-0-id", name: "node-0", labels: map[string]string{"storage": "ssd"}},
+		&FakeNode{id: "node-1-id", name: "node-1", volumes: []*cluster.Volume{{Name: "data", Driver: "local"}}},
+	}
+	config := &dockerclient.ContainerConfig{
+		Env:        []string{"constraint:storage==ssd"},
+		HostConfig: dockerclient.HostConfig{Binds: []string{"data:/data"}},
+	}
+
+	// The container doesn't get an empty volume on another node than the
+	// one having it.
+	_, err := ApplyFilters([]Filter{&ConstraintFilter{}, &VolumeFilter{}}, config, nodes)
+	assert.EqualError(t, err, "the volume data only exists on nodes ruled out for the container")
+}
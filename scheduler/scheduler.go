@@ -1,30 +1,157 @@
 package scheduler
 
 import (
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
 	"github.com/docker/swarm/cluster"
+	"github.com/docker/swarm/metrics"
 	"github.com/docker/swarm/scheduler/filter"
 	"github.com/docker/swarm/scheduler/strategy"
 	"github.com/samalba/dockerclient"
 )
 
+var (
+	placementLatency = metrics.NewHistogram("swarm_scheduler_placement_seconds", "Time spent selecting a node for a container.", metrics.DefaultBuckets, "strategy")
+	placements       = metrics.NewCounter("swarm_scheduler_placements_total", "Containers placed, or failed to, by each strategy.", "strategy", "result")
+)
+
 type Scheduler struct {
+	sync.RWMutex
+
 	strategy strategy.PlacementStrategy
 	filters  []filter.Filter
+	audit    *AuditLog
 }
 
 func New(strategy strategy.PlacementStrategy, filters []filter.Filter) *Scheduler {
 	return &Scheduler{
 		strategy: strategy,
 		filters:  filters,
+		audit:    newAuditLog(),
 	}
 }
 
+// Update replaces the strategy and the filters, for the next placements.
+func (s *Scheduler) Update(strategy strategy.PlacementStrategy, filters []filter.Filter) {
+	s.Lock()
+	defer s.Unlock()
+	s.strategy, s.filters = strategy, filters
+}
+
+// AuditLog returns the log of the decisions of the scheduler.
+func (s *Scheduler) AuditLog() *AuditLog {
+	return s.audit
+}
+
 // Find a nice home for our container.
-func (s *Scheduler) SelectNodeForContainer(nodes []cluster.Node, config *dockerclient.ContainerConfig) (cluster.Node, error) {
-	accepted, err := filter.ApplyFilters(s.filters, config, nodes)
+func (s *Scheduler) SelectNodeForContainer(nodes []cluster.Node, config *dockerclient.ContainerConfig, name string) (cluster.Node, error) {
+	start := time.Now()
+	selected, decision, err := s.decide(nodes, config, name, false)
+
+	strategyName, result := decision.Strategy, "success"
+	if err != nil {
+		result = "failure"
+	}
+	placementLatency.Observe(time.Since(start).Seconds(), strategyName)
+	placements.Inc(strategyName, result)
+	s.record(decision, err)
 	if err != nil {
 		return nil, err
 	}
+	return selected[0], nil
+}
+
+// Find all the nodes a global container should run on.
+func (s *Scheduler) SelectNodesForGlobalContainer(nodes []cluster.Node, config *dockerclient.ContainerConfig, name string) ([]cluster.Node, error) {
+	selected, decision, err := s.decide(nodes, config, name, true)
+	s.record(decision, err)
+	return selected, err
+}
 
-	return s.strategy.PlaceContainer(config, accepted)
+// Explain returns the decision the scheduler would make for the container,
+// without recording it. With the random strategy, the node actually selected
+// may differ.
+func (s *Scheduler) Explain(nodes []cluster.Node, config *dockerclient.ContainerConfig, name string, global bool) *cluster.Decision {
+	_, decision, err := s.decide(nodes, config, name, global)
+	if err != nil {
+		decision.Error = err.Error()
+	}
+	return decision
+}
+
+// decide selects the node of the container, or all the nodes accepted by the
+// filters if `global`.
+func (s *Scheduler) decide(nodes []cluster.Node, config *dockerclient.ContainerConfig, name string, global bool) ([]cluster.Node, *cluster.Decision, error) {
+	s.RLock()
+	placement, filters := s.strategy, s.filters
+	s.RUnlock()
+
+	decision := s.newDecision(nodes, config, name)
+	decision.Global = global
+	if !global {
+		decision.Strategy = strategy.Name(placement)
+	}
+
+	accepted, rejected, err := filter.ExplainFilters(filters, config, nodes)
+	decision.Rejected = rejected
+	if err != nil {
+		return nil, decision, err
+	}
+	if global {
+		decision.Selected = filter.NodeNames(accepted)
+		return accepted, decision, nil
+	}
+
+	if scorer, ok := placement.(strategy.ScoringStrategy); ok {
+		decision.Scores = scoresOf(scorer.Score(config, accepted))
+	}
+	node, err := placement.PlaceContainer(config, accepted)
+	if err != nil {
+		return nil, decision, err
+	}
+	decision.Selected = []string{node.Name()}
+	return []cluster.Node{node}, decision, nil
+}
+
+func (s *Scheduler) newDecision(nodes []cluster.Node, config *dockerclient.ContainerConfig, name string) *cluster.Decision {
+	return &cluster.Decision{
+		Time:       time.Now(),
+		Name:       name,
+		Image:      config.Image,
+		Considered: filter.NodeNames(nodes),
+		Selected:   []string{},
+	}
+}
+
+func (s *Scheduler) record(decision *cluster.Decision, err error) {
+	if err != nil {
+		decision.Error = err.Error()
+	}
+	if err := s.audit.record(decision); err != nil {
+		log.Errorf("Failed to write the scheduling decision of %s to the audit log: %v", decision.Name, err)
+	}
+}
+
+// scoresOf sorts `scores` from the best node to the worst.
+func scoresOf(scores map[cluster.Node]float64) []cluster.NodeScore {
+	sorted := make([]cluster.NodeScore, 0, len(scores))
+	for node, score := range scores {
+		sorted = append(sorted, cluster.NodeScore{Node: node.Name(), Score: score})
+	}
+	sort.Sort(byScore(sorted))
+	return sorted
+}
+
+type byScore []cluster.NodeScore
+
+func (s byScore) Len() int      { return len(s) }
+func (s byScore) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool {
+	if s[i].Score != s[j].Score {
+		return s[i].Score > s[j].Score
+	}
+	return s[i].Node < s[j].Node
 }
@@ -2,7 +2,9 @@ package strategy
 
 import (
 	"errors"
+	"fmt"
 	"sort"
+	"strconv"
 
 	"github.com/docker/swarm/cluster"
 	"github.com/samalba/dockerclient"
@@ -12,13 +14,55 @@ var (
 	ErrNoResourcesAvailable = errors.New("no resources available to schedule container")
 )
 
-type BinPackingPlacementStrategy struct{}
+type BinPackingPlacementStrategy struct {
+	// Weight of the actual usage of the nodes against the resources reserved
+	// by their containers, from 0 (reservations only) to 1 (usage only).
+	usage float64
+}
 
-func (p *BinPackingPlacementStrategy) Initialize() error {
+func (p *BinPackingPlacementStrategy) Initialize(opts map[string]string) error {
+	p.usage = 0
+	for key, value := range opts {
+		if key != "usage" {
+			return fmt.Errorf("unknown option %q for the binpacking strategy", key)
+		}
+		usage, err := strconv.ParseFloat(value, 64)
+		if err != nil || usage < 0 || usage > 1 {
+			return fmt.Errorf("invalid usage weight %q, expected a number between 0 and 1", value)
+		}
+		p.usage = usage
+	}
 	return nil
 }
 
+// Blend the resources reserved on a node with the fraction actually used.
+func (p *BinPackingPlacementStrategy) used(reserved int64, usage float64, total int64) int64 {
+	return int64((1-p.usage)*float64(reserved) + p.usage*usage*float64(total))
+}
+
 func (p *BinPackingPlacementStrategy) PlaceContainer(config *dockerclient.ContainerConfig, nodes []cluster.Node) (cluster.Node, error) {
+	weightedNodes := p.weigh(config, nodes)
+	if len(weightedNodes) == 0 {
+		return nil, ErrNoResourcesAvailable
+	}
+
+	// sort by highest weight
+	sort.Sort(sort.Reverse(weightedNodes))
+
+	return weightedNodes[0].Node, nil
+}
+
+func (p *BinPackingPlacementStrategy) Score(config *dockerclient.ContainerConfig, nodes []cluster.Node) map[cluster.Node]float64 {
+	scores := make(map[cluster.Node]float64)
+	for _, n := range p.weigh(config, nodes) {
+		scores[n.Node] = float64(n.Weight)
+	}
+	return scores
+}
+
+// weigh the nodes with room for the container, the fullest ones weighing the
+// most.
+func (p *BinPackingPlacementStrategy) weigh(config *dockerclient.ContainerConfig, nodes []cluster.Node) weightedNodeList {
 	weightedNodes := weightedNodeList{}
 
 	for _, node := range nodes {
@@ -36,23 +80,15 @@ func (p *BinPackingPlacementStrategy) PlaceContainer(config *dockerclient.Contai
 		)
 
 		if config.CpuShares > 0 {
-			cpuScore = (node.UsedCpus() + config.CpuShares) * 100 / nodeCpus
+			cpuScore = (p.used(node.UsedCpus(), node.CpuUsage(), nodeCpus) + config.CpuShares) * 100 / nodeCpus
 		}
 		if config.Memory > 0 {
-			memoryScore = (node.UsedMemory() + config.Memory) * 100 / nodeMemory
+			memoryScore = (p.used(node.UsedMemory(), node.MemoryUsage(), nodeMemory) + config.Memory) * 100 / nodeMemory
 		}
 
 		if cpuScore <= 100 && memoryScore <= 100 {
 			weightedNodes = append(weightedNodes, &weightedNode{Node: node, Weight: cpuScore + memoryScore})
 		}
 	}
-
-	if len(weightedNodes) == 0 {
-		return nil, ErrNoResourcesAvailable
-	}
-
-	// sort by highest weight
-	sort.Sort(sort.Reverse(weightedNodes))
-
-	return weightedNodes[0].Node, nil
+	return weightedNodes
 }
@@ -114,7 +114,7 @@ func TestPlaceContainerHuge(t *testing.T) {
 }
 
 func TestPlaceContainerOvercommit(t *testing.T) {
-	s, err := New("binpacking")
+	s, err := New("binpacking", nil)
 	assert.NoError(t, err)
 
 	nodes := []cluster.Node{createNode("node-1", 100, 1)}
@@ -261,3 +261,46 @@ func TestComplexPlacement(t *testing.T) {
 	// check that it ends up on the same node as the 3G
 	assert.Equal(t, node2.ID(), node3.ID())
 }
+
+func TestPlaceContainerUsage(t *testing.T) {
+	s := &BinPackingPlacementStrategy{}
+	assert.Error(t, s.Initialize(map[string]string{"usage": "2"}))
+	assert.Error(t, s.Initialize(map[string]string{"cpu": "1"}))
+	assert.NoError(t, s.Initialize(map[string]string{"usage": "1"}))
+
+	nodes := []cluster.Node{createNode("node-1", 2, 2), createNode("node-2", 2, 2)}
+
+	// node-1 runs a non reserved workload using most of its memory.
+	nodes[0].(*FakeNode).memoryUsage = 0.9
+
+	// Containers can't fit on node-1 anymore.
+	node, err := s.PlaceContainer(createConfig(1, 0), nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, node.ID(), "node-2")
+
+	// Reservations only, node-1 is as good as any.
+	assert.NoError(t, s.Initialize(map[string]string{}))
+	assert.NoError(t, AddContainer(nodes[0], createContainer("c1", createConfig(0, 1))))
+	node, err = s.PlaceContainer(createConfig(0, 1), nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, node.ID(), "node-1")
+}
+
+func TestBinPackingScore(t *testing.T) {
+	s := &BinPackingPlacementStrategy{}
+	assert.NoError(t, s.Initialize(map[string]string{}))
+
+	empty := createNode("empty", 2, 2)
+	busy := createNode("busy", 2, 2)
+	small := createNode("small", 1, 1)
+	assert.NoError(t, AddContainer(busy, createContainer("c1", createConfig(1, 0))))
+
+	// The fuller the node, the higher its score; the nodes too small have none.
+	scores := s.Score(createConfig(1, 2), []cluster.Node{empty, busy, small})
+	assert.Len(t, scores, 2)
+	assert.True(t, scores[busy] > scores[empty])
+
+	node, err := s.PlaceContainer(createConfig(1, 2), []cluster.Node{empty, busy, small})
+	assert.NoError(t, err)
+	assert.Equal(t, node.ID(), "busy")
+}
@@ -15,12 +15,17 @@ type FakeNode struct {
 	cpus       int64
 	usedcpus   int64
 	containers []*cluster.Container
+	labels     map[string]string
+
+	cpuUsage    float64
+	memoryUsage float64
 }
 
 func (fn *FakeNode) ID() string                            { return fn.id }
 func (fn *FakeNode) Name() string                          { return fn.name }
 func (fn *FakeNode) IP() string                            { return "" }
 func (fn *FakeNode) Addr() string                          { return fn.addr }
+func (fn *FakeNode) Version() string                       { return "1.6.0" }
 func (fn *FakeNode) Images() []*cluster.Image              { return nil }
 func (fn *FakeNode) Image(_ string) *cluster.Image         { return nil }
 func (fn *FakeNode) Containers() []*cluster.Container      { return fn.containers }
@@ -29,8 +34,14 @@ func (fn *FakeNode) TotalCpus() int64                      { return fn.cpus }
 func (fn *FakeNode) UsedCpus() int64                       { return fn.usedcpus }
 func (fn *FakeNode) TotalMemory() int64                    { return fn.memory }
 func (fn *FakeNode) UsedMemory() int64                     { return fn.usedmemory }
-func (fn *FakeNode) Labels() map[string]string             { return nil }
+func (fn *FakeNode) Labels() map[string]string             { return fn.labels }
 func (fn *FakeNode) IsHealthy() bool                       { return true }
+func (fn *FakeNode) IsDrained() bool                       { return false }
+func (fn *FakeNode) Volumes() []*cluster.Volume            { return nil }
+func (fn *FakeNode) VolumeDrivers() []string               { return nil }
+func (fn *FakeNode) Networks() []*cluster.Network          { return nil }
+func (fn *FakeNode) CpuUsage() float64                     { return fn.cpuUsage }
+func (fn *FakeNode) MemoryUsage() float64                  { return fn.memoryUsage }
 
 func (fn *FakeNode) AddContainer(container *cluster.Container) error {
 	memory := container.Info.Config.Memory
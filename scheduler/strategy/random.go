@@ -12,7 +12,10 @@ import (
 // Randomly place the container into the cluster.
 type RandomPlacementStrategy struct{}
 
-func (p *RandomPlacementStrategy) Initialize() error {
+func (p *RandomPlacementStrategy) Initialize(opts map[string]string) error {
+	if err := noOpts("random", opts); err != nil {
+		return err
+	}
 	rand.Seed(time.Now().UTC().UnixNano())
 	return nil
 }
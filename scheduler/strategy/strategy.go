@@ -2,6 +2,9 @@ package strategy
 
 import (
 	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/swarm/cluster"
@@ -9,12 +12,20 @@ import (
 )
 
 type PlacementStrategy interface {
-	Initialize() error
+	// Initialize the strategy with its `--strategy-opt` options.
+	Initialize(opts map[string]string) error
 	// Given a container configuration and a set of nodes, select the target
 	// node where the container should be scheduled.
 	PlaceContainer(config *dockerclient.ContainerConfig, nodes []cluster.Node) (cluster.Node, error)
 }
 
+// A ScoringStrategy places the containers on the node with the highest score.
+type ScoringStrategy interface {
+	PlacementStrategy
+	// Score the nodes with room for the container.
+	Score(config *dockerclient.ContainerConfig, nodes []cluster.Node) map[cluster.Node]float64
+}
+
 var (
 	strategies      map[string]PlacementStrategy
 	ErrNotSupported = errors.New("strategy not supported")
@@ -24,15 +35,57 @@ func init() {
 	strategies = map[string]PlacementStrategy{
 		"binpacking": &BinPackingPlacementStrategy{},
 		"random":     &RandomPlacementStrategy{},
+		"weighted":   &WeightedPlacementStrategy{},
 	}
 }
 
-func New(name string) (PlacementStrategy, error) {
-	if strategy, exists := strategies[name]; exists {
+// New initializes a new instance of the strategy `name` with `opts`, a list
+// of key=value options, each of them possibly holding several comma separated
+// options. The instances in use are left untouched, so that the strategy can
+// be changed while placing containers.
+func New(name string, opts []string) (PlacementStrategy, error) {
+	if registered, exists := strategies[name]; exists {
 		log.WithField("name", name).Debugf("Initializing strategy")
-		err := strategy.Initialize()
+		parsed, err := parseOpts(opts)
+		if err != nil {
+			return nil, err
+		}
+		strategy := reflect.New(reflect.TypeOf(registered).Elem()).Interface().(PlacementStrategy)
+		err = strategy.Initialize(parsed)
 		return strategy, err
 	}
 
 	return nil, ErrNotSupported
 }
+
+// Name returns the name the strategy of `strategy` is registered under.
+func Name(strategy PlacementStrategy) string {
+	for name, s := range strategies {
+		if reflect.TypeOf(s) == reflect.TypeOf(strategy) {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+func parseOpts(opts []string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	for _, opt := range opts {
+		for _, kv := range strings.Split(opt, ",") {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return nil, fmt.Errorf("invalid strategy option %q, expected key=value", kv)
+			}
+			parsed[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return parsed, nil
+}
+
+// noOpts is used by the strategies taking no option.
+func noOpts(name string, opts map[string]string) error {
+	for key := range opts {
+		return fmt.Errorf("unknown option %q for the %s strategy", key, name)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package strategy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/samalba/dockerclient"
+)
+
+// Prefix of the options weighting a numeric node label.
+const labelOptPrefix = "label."
+
+// WeightedPlacementStrategy scores the nodes with a weighted sum of their
+// available CPUs, available memory, number of containers and numeric labels,
+// each normalized against the highest value among the nodes, and of their
+// idle CPUs and memory as actually sampled. It picks the node with the highest
+// score.
+type WeightedPlacementStrategy struct {
+	cpu         float64
+	memory      float64
+	containers  float64
+	cpuUsage    float64
+	memoryUsage float64
+	labels      map[string]float64
+}
+
+func (p *WeightedPlacementStrategy) Initialize(opts map[string]string) error {
+	// By default, favor the nodes with the most resources available.
+	p.cpu, p.memory, p.containers = 1, 1, 0
+	p.cpuUsage, p.memoryUsage = 0, 0
+	p.labels = make(map[string]float64)
+
+	for key, value := range opts {
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid weight %q for %s: %v", value, key, err)
+		}
+
+		switch {
+		case key == "cpu":
+			p.cpu = weight
+		case key == "mem" || key == "memory":
+			p.memory = weight
+		case key == "containers":
+			p.containers = weight
+		case key == "cpu_usage":
+			p.cpuUsage = weight
+		case key == "mem_usage" || key == "memory_usage":
+			p.memoryUsage = weight
+		case strings.HasPrefix(key, labelOptPrefix) && len(key) > len(labelOptPrefix):
+			p.labels[strings.TrimPrefix(key, labelOptPrefix)] = weight
+		default:
+			return fmt.Errorf("unknown option %q for the weighted strategy", key)
+		}
+	}
+	return nil
+}
+
+// Values a node is scored on.
+type nodeMetrics struct {
+	cpu, memory, containers float64
+	cpuIdle, memoryIdle     float64
+	labels                  map[string]float64
+}
+
+func (p *WeightedPlacementStrategy) PlaceContainer(config *dockerclient.ContainerConfig, nodes []cluster.Node) (cluster.Node, error) {
+	candidates, scores := p.score(config, nodes)
+	if len(candidates) == 0 {
+		return nil, ErrNoResourcesAvailable
+	}
+
+	var (
+		best      cluster.Node
+		bestScore float64
+	)
+	for i, score := range scores {
+		if best == nil || score > bestScore {
+			best, bestScore = candidates[i], score
+		}
+	}
+	return best, nil
+}
+
+func (p *WeightedPlacementStrategy) Score(config *dockerclient.ContainerConfig, nodes []cluster.Node) map[cluster.Node]float64 {
+	candidates, scores := p.score(config, nodes)
+	scored := make(map[cluster.Node]float64, len(candidates))
+	for i, node := range candidates {
+		scored[node] = scores[i]
+	}
+	return scored
+}
+
+// score returns the nodes with room for the container, and their scores.
+func (p *WeightedPlacementStrategy) score(config *dockerclient.ContainerConfig, nodes []cluster.Node) ([]cluster.Node, []float64) {
+	var (
+		candidates = []cluster.Node{}
+		metrics    = []*nodeMetrics{}
+		max        = &nodeMetrics{labels: make(map[string]float64)}
+	)
+
+	for _, node := range nodes {
+		freeCpus := node.TotalCpus() - node.UsedCpus() - config.CpuShares
+		freeMemory := node.TotalMemory() - node.UsedMemory() - config.Memory
+
+		// Skip nodes without room for the container.
+		if (config.CpuShares > 0 && freeCpus < 0) || (config.Memory > 0 && freeMemory < 0) {
+			continue
+		}
+
+		m := &nodeMetrics{
+			cpu:        float64(freeCpus),
+			memory:     float64(freeMemory),
+			containers: float64(len(node.Containers())),
+			cpuIdle:    1 - node.CpuUsage(),
+			memoryIdle: 1 - node.MemoryUsage(),
+			labels:     make(map[string]float64),
+		}
+		for key := range p.labels {
+			// Non numeric labels don't count.
+			if value, err := strconv.ParseFloat(node.Labels()[key], 64); err == nil {
+				m.labels[key] = value
+			}
+		}
+
+		max.cpu = maxFloat(max.cpu, m.cpu)
+		max.memory = maxFloat(max.memory, m.memory)
+		max.containers = maxFloat(max.containers, m.containers)
+		for key, value := range m.labels {
+			max.labels[key] = maxFloat(max.labels[key], value)
+		}
+
+		candidates = append(candidates, node)
+		metrics = append(metrics, m)
+	}
+
+	scores := make([]float64, len(metrics))
+	for i, m := range metrics {
+		score := p.cpu*ratio(m.cpu, max.cpu) +
+			p.memory*ratio(m.memory, max.memory) +
+			// The fewer containers, the better.
+			p.containers*(1-ratio(m.containers, max.containers)) +
+			p.cpuUsage*m.cpuIdle +
+			p.memoryUsage*m.memoryIdle
+		for key, weight := range p.labels {
+			score += weight * ratio(m.labels[key], max.labels[key])
+		}
+		scores[i] = score
+	}
+	return candidates, scores
+}
+
+func ratio(value, max float64) float64 {
+	if max <= 0 {
+		return 0
+	}
+	return value / max
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,120 @@
+package strategy
+
+import (
+	"testing"
+
+	"github.com/docker/swarm/cluster"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightedInitialize(t *testing.T) {
+	s := &WeightedPlacementStrategy{}
+	assert.NoError(t, s.Initialize(map[string]string{}))
+	assert.Equal(t, s.cpu, 1.0)
+	assert.Equal(t, s.memory, 1.0)
+
+	assert.NoError(t, s.Initialize(map[string]string{"cpu": "0.7", "mem": "0.3", "containers": "-1", "label.disks": "2"}))
+	assert.Equal(t, s.cpu, 0.7)
+	assert.Equal(t, s.memory, 0.3)
+	assert.Equal(t, s.containers, -1.0)
+	assert.Equal(t, s.labels, map[string]float64{"disks": 2})
+
+	assert.Error(t, s.Initialize(map[string]string{"cpu": "a lot"}))
+	assert.Error(t, s.Initialize(map[string]string{"disk": "1"}))
+	assert.Error(t, s.Initialize(map[string]string{"label.": "1"}))
+}
+
+func TestWeightedResources(t *testing.T) {
+	s := &WeightedPlacementStrategy{}
+	assert.NoError(t, s.Initialize(map[string]string{"cpu": "0.7", "mem": "0.3"}))
+
+	manyCPUs := createNode("8-cpus-2gb", 2, 8)
+	muchMemory := createNode("2-cpus-8gb", 8, 2)
+	nodes := []cluster.Node{manyCPUs, muchMemory}
+
+	// CPUs matter more than memory.
+	node, err := s.PlaceContainer(createConfig(1, 1), nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, node, manyCPUs)
+
+	assert.NoError(t, s.Initialize(map[string]string{"cpu": "0.3", "mem": "0.7"}))
+	node, err = s.PlaceContainer(createConfig(1, 1), nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, node, muchMemory)
+
+	// Nodes without room are skipped.
+	assert.NoError(t, s.Initialize(map[string]string{"cpu": "1", "mem": "0"}))
+	node, err = s.PlaceContainer(createConfig(4, 1), nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, node, muchMemory)
+
+	_, err = s.PlaceContainer(createConfig(16, 1), nodes)
+	assert.Equal(t, err, ErrNoResourcesAvailable)
+}
+
+func TestWeightedContainersAndLabels(t *testing.T) {
+	s := &WeightedPlacementStrategy{}
+	assert.NoError(t, s.Initialize(map[string]string{"cpu": "0", "mem": "0", "containers": "1"}))
+
+	busy := createNode("busy", 2, 2)
+	idle := createNode("idle", 2, 2)
+	assert.NoError(t, AddContainer(busy, createContainer("c1", createConfig(0, 0))))
+	nodes := []cluster.Node{busy, idle}
+
+	node, err := s.PlaceContainer(createConfig(0, 0), nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, node.ID(), "idle")
+
+	busy.(*FakeNode).labels = map[string]string{"disks": "4"}
+	idle.(*FakeNode).labels = map[string]string{"disks": "not a number"}
+	assert.NoError(t, s.Initialize(map[string]string{"cpu": "0", "mem": "0", "containers": "1", "label.disks": "2"}))
+	node, err = s.PlaceContainer(createConfig(0, 0), nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, node.ID(), "busy")
+}
+
+func TestNewWithOpts(t *testing.T) {
+	s, err := New("weighted", []string{"cpu=0.7,mem=0.3", "containers=1"})
+	assert.NoError(t, err)
+	weighted := s.(*WeightedPlacementStrategy)
+	assert.Equal(t, weighted.cpu, 0.7)
+	assert.Equal(t, weighted.memory, 0.3)
+	assert.Equal(t, weighted.containers, 1.0)
+
+	_, err = New("weighted", []string{"cpu"})
+	assert.Error(t, err)
+	_, err = New("binpacking", []string{"cpu=1"})
+	assert.Error(t, err)
+}
+
+func TestWeightedUsage(t *testing.T) {
+	s := &WeightedPlacementStrategy{}
+	assert.NoError(t, s.Initialize(map[string]string{"cpu": "0", "mem": "0", "cpu_usage": "1", "mem_usage": "0.5"}))
+
+	nodes := []cluster.Node{createNode("loaded", 4, 4), createNode("idle", 2, 2)}
+	nodes[0].(*FakeNode).cpuUsage = 0.95
+	nodes[0].(*FakeNode).memoryUsage = 0.8
+
+	node, err := s.PlaceContainer(createConfig(1, 1), nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, node.ID(), "idle")
+
+	// Without looking at the usage, the bigger node wins.
+	assert.NoError(t, s.Initialize(map[string]string{}))
+	node, err = s.PlaceContainer(createConfig(1, 1), nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, node.ID(), "loaded")
+}
+
+func TestWeightedScore(t *testing.T) {
+	s := &WeightedPlacementStrategy{}
+	assert.NoError(t, s.Initialize(map[string]string{"cpu": "1", "mem": "0"}))
+
+	twoCPUs := createNode("2-cpus", 2, 2)
+	eightCPUs := createNode("8-cpus", 2, 8)
+	oneCPU := createNode("1-cpu", 2, 1)
+	scores := s.Score(createConfig(1, 2), []cluster.Node{twoCPUs, eightCPUs, oneCPU})
+
+	// The node without room for the container isn't scored.
+	assert.Equal(t, scores, map[cluster.Node]float64{twoCPUs: 0, eightCPUs: 1})
+}
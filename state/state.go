@@ -8,4 +8,7 @@ type RequestedState struct {
 	ID     string
 	Name   string
 	Config *dockerclient.ContainerConfig
+
+	// ID shared by all the instances of a global container.
+	GlobalID string `json:",omitempty"`
 }